@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/devmail"
+	"github.com/ahmedkhaeld/booking/emails"
 	"github.com/ahmedkhaeld/booking/handlers"
+	"github.com/ahmedkhaeld/booking/jobs"
 	"github.com/ahmedkhaeld/booking/middleware"
 	"github.com/ahmedkhaeld/jazz"
+	"github.com/robfig/cron/v3"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type application struct {
@@ -17,7 +27,8 @@ type application struct {
 	Middleware *middleware.Middleware
 }
 
-func run() *application {
+// newApplication reads the settings of the app and connects it to its database
+func newApplication() *application {
 	gob.Register(data.Reservation{})
 	gob.Register(data.User{})
 	gob.Register(data.Restriction{})
@@ -33,7 +44,9 @@ func run() *application {
 	j := &jazz.Jazz{}
 
 	//init the jazz
+	restore := hideMySQL(rootPath)
 	err = j.New(rootPath)
+	restore()
 	if err != nil {
 		j.ErrorLog.Fatal(err)
 	}
@@ -50,9 +63,314 @@ func run() *application {
 		Handlers:   h,
 		Middleware: m,
 	}
+	if app.usesMySQL() {
+		app.connectMySQL()
+	}
+	if app.usesSQLite() {
+		app.connectSQLite()
+	}
+	return app
+}
+
+func run() *application {
+	app := newApplication()
+	app.migrateOnStart()
+	data.QueryTimeout = app.queryTimeout()
 	app.Models = data.New(app.Jazz.DB.SqlPool)
+	if app.inMemory() {
+		app.seedMemory()
+	}
+	app.Handlers.Models = app.Models
 	app.Middleware.Models = app.Models
+	app.Middleware.RateLimiter = app.rateLimiter()
+	app.Handlers.Emails = app.emailsConfig()
+	app.Handlers.MailCatcher = app.mailCatcher()
+	var sender jobs.MailSender = &app.Mailer
+	if app.Handlers.MailCatcher != nil {
+		sender = app.Handlers.MailCatcher
+	}
+	app.Handlers.MailQueue = jobs.NewMailQueue(app.Models, sender, app.ErrorLog, app.InfoLog)
+	// without the tables of the webhooks Webhooks stays nil and publishes nothing
+	if app.fullSchema() {
+		app.Handlers.Webhooks = jobs.NewWebhooks(app.Models, app.ErrorLog, app.InfoLog)
+	}
+	app.Handlers.CalendarImporter = jobs.NewCalendarImporter(app.Models, app.Handlers.Webhooks, app.ErrorLog, app.InfoLog)
+	app.scheduleJobs()
 	//add new routes with default ones
 	app.Jazz.Routes = app.routes()
 	return app
 }
+
+// inMemory reports whether the models keep their data in memory, DATABASE_TYPE=memory
+func (a *application) inMemory() bool {
+	return os.Getenv("DATABASE_TYPE") == "memory"
+}
+
+// usesMySQL reports whether the models talk to MySQL or MariaDB, DATABASE_TYPE=mysql or mariadb
+func (a *application) usesMySQL() bool {
+	return data.DialectOf(os.Getenv("DATABASE_TYPE")) == data.MySQL
+}
+
+// usesSQLite reports whether the models keep their data in a SQLite file, DATABASE_TYPE=sqlite
+func (a *application) usesSQLite() bool {
+	return data.DialectOf(os.Getenv("DATABASE_TYPE")) == data.SQLite
+}
+
+// fullSchema reports whether the database has the tables of every feature. The MySQL and SQLite schemas only
+// have the ones of the bookings, the staff and the mail queue; the api keys, calendar imports, webhooks and
+// invoices need postgres or the in-memory models
+func (a *application) fullSchema() bool {
+	return !a.usesMySQL() && !a.usesSQLite()
+}
+
+// seedMemory fills the empty in-memory models with the two rooms of the site, and a staff user when
+// DEMO_ADMIN_EMAIL and DEMO_ADMIN_PASSWORD are set
+func (a *application) seedMemory() {
+	ctx := context.Background()
+	for _, name := range []string{"Generals Quarters", "Majors Suite"} {
+		_, err := a.Models.Rooms.Create(ctx, data.Room{Name: name})
+		if err != nil {
+			a.ErrorLog.Fatal(err)
+		}
+	}
+
+	email, password := os.Getenv("DEMO_ADMIN_EMAIL"), os.Getenv("DEMO_ADMIN_PASSWORD")
+	if email != "" && password != "" {
+		_, err := a.Models.Users.Insert(ctx, data.User{
+			FirstName:   "Demo",
+			LastName:    "Admin",
+			Email:       email,
+			Password:    password,
+			AccessLevel: data.AccessAdmin,
+		})
+		if err != nil {
+			a.ErrorLog.Fatal(err)
+		}
+	}
+	a.InfoLog.Println("data is kept in memory and lost when the app stops")
+}
+
+// queryTimeout is the longest a database query may take, DB_QUERY_TIMEOUT as a duration like 5s, default 3s.
+// Queries made for a request also end when its client goes away
+func (a *application) queryTimeout() time.Duration {
+	value := os.Getenv("DB_QUERY_TIMEOUT")
+	if value == "" {
+		return 3 * time.Second
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		a.ErrorLog.Fatal("DB_QUERY_TIMEOUT: expected a duration like 5s, got ", value)
+	}
+	return timeout
+}
+
+// mailCatcher builds the catcher that keeps mail instead of sending it, nil when mail is sent.
+//
+// MAIL_BACKEND is smtp (default), which sends through the jazz mailer, memory, which keeps the mail
+// until the app stops, or file, which keeps each message as json in MAIL_DIR, default tmp/mail
+func (a *application) mailCatcher() *devmail.Catcher {
+	var store devmail.Store
+	switch backend := os.Getenv("MAIL_BACKEND"); backend {
+	case "", "smtp":
+		return nil
+	case "memory":
+		store = devmail.NewMemoryStore()
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = filepath.Join(a.RootPath, "tmp", "mail")
+		}
+		fs, err := devmail.NewFileStore(dir)
+		if err != nil {
+			a.ErrorLog.Fatal("MAIL_DIR: ", err)
+		}
+		store = fs
+	default:
+		a.ErrorLog.Fatal("MAIL_BACKEND: expected smtp, memory or file, got ", backend)
+	}
+	a.InfoLog.Println("mail is not sent, it is kept by the", os.Getenv("MAIL_BACKEND"), "mail catcher")
+	return devmail.New(a.Mailer.Templates, store)
+}
+
+// rateLimiter builds the per client rate limiter from the environment.
+//
+// RATE_LIMIT_BACKEND is memory (default), redis or off; RATE_LIMIT_SEARCH and RATE_LIMIT_BOOKING
+// set the limit for each route group, e.g. "60/m". RATE_LIMIT_TRUSTED_PROXIES lists the reverse proxies
+// whose headers name the client, none by default
+func (a *application) rateLimiter() *middleware.RateLimiter {
+	backend := os.Getenv("RATE_LIMIT_BACKEND")
+	if backend == "off" {
+		return nil
+	}
+
+	limits := make(map[string]middleware.RateLimit)
+	for group, env := range map[string]string{
+		middleware.RateLimitSearch:  "RATE_LIMIT_SEARCH",
+		middleware.RateLimitBooking: "RATE_LIMIT_BOOKING",
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			value = defaultRateLimits[group]
+		}
+		limit, err := middleware.ParseRateLimit(value)
+		if err != nil {
+			a.ErrorLog.Fatal(env, ": ", err)
+		}
+		limits[group] = limit
+	}
+
+	rl, err := middleware.NewRateLimiter(backend, limits,
+		os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PASSWORD"), os.Getenv("REDIS_PREFIX"))
+	if err != nil {
+		a.ErrorLog.Fatal(err)
+	}
+	rl.TrustedProxies, err = middleware.ParseTrustedProxies(os.Getenv("RATE_LIMIT_TRUSTED_PROXIES"))
+	if err != nil {
+		a.ErrorLog.Fatal("RATE_LIMIT_TRUSTED_PROXIES: ", err)
+	}
+	return rl
+}
+
+// scheduleJobs adds the background jobs to the scheduler and starts it.
+//
+// ICAL_SYNC_SCHEDULE is a cron spec for importing outside calendars, default "@every 30m"; "off" disables it.
+// GUEST_MAIL_SCHEDULE is when the reminders and thank-yous are sent, default every day at 9:00; "off" disables them.
+// REMINDER_DAYS is how many days before arrival the reminder goes out, default 3; 0 sends none.
+// With MySQL or SQLite only the mail queue runs; the other jobs need postgres or the in-memory models
+func (a *application) scheduleJobs() {
+	// jazz only creates the scheduler for some cache and session setups, and never starts it
+	if a.Scheduler == nil {
+		a.Scheduler = cron.New()
+	}
+
+	// retries of failed mail
+	_, err := a.Scheduler.AddFunc("@every 1m", a.Handlers.MailQueue.SendDue)
+	if err != nil {
+		a.ErrorLog.Fatal(err)
+	}
+	if !a.fullSchema() {
+		a.Scheduler.Start()
+		return
+	}
+
+	spec := os.Getenv("GUEST_MAIL_SCHEDULE")
+	if spec == "" {
+		spec = "0 9 * * *"
+	}
+	if spec != "off" {
+		reminderDays := 3
+		if days := os.Getenv("REMINDER_DAYS"); days != "" {
+			n, err := strconv.Atoi(days)
+			if err != nil || n < 0 {
+				a.ErrorLog.Fatal("REMINDER_DAYS: expected a number of days, got ", days)
+			}
+			reminderDays = n
+		}
+		guestMail := jobs.NewGuestMail(a.Models, a.Handlers.MailQueue, a.Handlers.Emails, reminderDays, a.ErrorLog, a.InfoLog)
+		_, err = a.Scheduler.AddFunc(spec, guestMail.RunDaily)
+		if err != nil {
+			a.ErrorLog.Fatal("GUEST_MAIL_SCHEDULE: ", err)
+		}
+	}
+
+	spec = os.Getenv("ICAL_SYNC_SCHEDULE")
+	if spec == "" {
+		spec = "@every 30m"
+	}
+	if spec != "off" {
+		_, err = a.Scheduler.AddFunc(spec, a.Handlers.CalendarImporter.SyncAll)
+		if err != nil {
+			a.ErrorLog.Fatal("ICAL_SYNC_SCHEDULE: ", err)
+		}
+	}
+
+	// retries of failed webhook deliveries
+	_, err = a.Scheduler.AddFunc("@every 1m", a.Handlers.Webhooks.DeliverDue)
+	if err != nil {
+		a.ErrorLog.Fatal(err)
+	}
+
+	a.Scheduler.Start()
+}
+
+// emailsConfig builds the settings of the mail from the environment.
+//
+// FROM_ADDRESS and FROM_NAME are the sender, PROPERTY_NAME and CURRENCY how the property and prices are written,
+// OWNER_EMAILS who gets the owner notices. PROPERTY_ADDRESS, CHECK_IN_TIME, CHECK_OUT_TIME and PROPERTY_TIMEZONE
+// go into the calendar invites and documents. TAX_NAME and TAX_RATE, a percentage, are added to every stay,
+// INVOICE_PREFIX is written before invoice numbers
+func (a *application) emailsConfig() emails.Config {
+	c := emails.Config{
+		From:          os.Getenv("FROM_ADDRESS"),
+		FromName:      os.Getenv("FROM_NAME"),
+		SiteURL:       a.Server.URL,
+		PropertyName:  os.Getenv("PROPERTY_NAME"),
+		Currency:      os.Getenv("CURRENCY"),
+		TaxName:       os.Getenv("TAX_NAME"),
+		InvoicePrefix: os.Getenv("INVOICE_PREFIX"),
+		Address:       os.Getenv("PROPERTY_ADDRESS"),
+		CheckIn:       os.Getenv("CHECK_IN_TIME"),
+		CheckOut:      os.Getenv("CHECK_OUT_TIME"),
+		Location:      time.Local,
+		Owners:        splitEmails(os.Getenv("OWNER_EMAILS")),
+	}
+	if c.From == "" {
+		c.From = "breadandbreakfast@booking.com"
+	}
+	if c.PropertyName == "" {
+		c.PropertyName = "Fort Smythe Bed and Breakfast"
+	}
+	if c.Currency == "" {
+		c.Currency = "USD"
+	}
+	if rate := os.Getenv("TAX_RATE"); rate != "" {
+		percent, err := strconv.ParseFloat(rate, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			a.ErrorLog.Fatal("TAX_RATE: expected a percentage like 12.5, got ", rate)
+		}
+		c.TaxRate = int(math.Round(percent * 100))
+	}
+	if c.TaxName == "" {
+		c.TaxName = "Tax"
+	}
+	if c.InvoicePrefix == "" {
+		c.InvoicePrefix = "INV-"
+	}
+	if c.CheckIn == "" {
+		c.CheckIn = "15:00"
+	}
+	if c.CheckOut == "" {
+		c.CheckOut = "11:00"
+	}
+	for name, clock := range map[string]string{"CHECK_IN_TIME": c.CheckIn, "CHECK_OUT_TIME": c.CheckOut} {
+		if _, err := time.Parse("15:04", clock); err != nil {
+			a.ErrorLog.Fatal(name, ": expected a time like 15:00, got ", clock)
+		}
+	}
+	if tz := os.Getenv("PROPERTY_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			a.ErrorLog.Fatal("PROPERTY_TIMEZONE: ", err)
+		}
+		c.Location = loc
+	}
+	return c
+}
+
+// splitEmails reads a comma separated list of addresses, skipping empty entries
+func splitEmails(s string) []string {
+	var emails []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			emails = append(emails, e)
+		}
+	}
+	return emails
+}
+
+// defaultRateLimits apply when the environment does not set a limit for a group
+var defaultRateLimits = map[string]string{
+	middleware.RateLimitSearch:  "60/m",
+	middleware.RateLimitBooking: "10/m",
+}
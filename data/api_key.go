@@ -0,0 +1,265 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// scopes an api key can be granted
+const (
+	ScopeReadAvailability   = "availability:read"
+	ScopeCreateReservations = "reservations:write"
+	ScopeReadReservations   = "reservations:read"
+	ScopeAdmin              = "admin"
+)
+
+// AllScopes lists every scope in the order they are shown to staff
+var AllScopes = []string{ScopeReadAvailability, ScopeCreateReservations, ScopeReadReservations, ScopeAdmin}
+
+// apiKeyTokenPrefix marks a string as one of our api keys, so leaked keys are easy to spot
+const apiKeyTokenPrefix = "bk_"
+
+// ErrInvalidAPIKey is returned when a token is malformed, unknown, revoked or does not match its hash
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey is a credential that lets a partner call the json api on behalf of a user.
+//
+// only a sha256 hash of the secret is stored; the plain token is shown once when the key is issued.
+// Prefix is the public part of the token used to find the key without scanning every hash
+type APIKey struct {
+	ID         int
+	UserID     int
+	Name       string
+	Prefix     string
+	Hash       string
+	Scopes     []string
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	User       User
+}
+
+func (k *APIKey) Table() string {
+	return "api_keys"
+}
+
+// HasScope reports whether the key was granted scope; the admin scope grants everything
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoked reports whether the key can no longer be used
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt.Valid
+}
+
+// hashAPIKeyToken returns the hex sha256 of a token; tokens are random so a slow hash is not needed
+func hashAPIKeyToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Issue creates a key for key.UserID with key.Name and key.Scopes,
+// and returns the new id and the plain token. The token cannot be recovered later
+func (k *APIKey) Issue(ctx context.Context, key APIKey) (int, string, error) {
+	prefix, err := randomHex(4)
+	if err != nil {
+		return 0, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return 0, "", err
+	}
+	token := apiKeyTokenPrefix + prefix + "_" + secret
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	query := `insert into api_keys (user_id, name, prefix, key_hash, scopes, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	err = DB.QueryRowContext(ctx, query,
+		key.UserID,
+		key.Name,
+		prefix,
+		hashAPIKeyToken(token),
+		strings.Join(key.Scopes, ","),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, "", err
+	}
+	return newID, token, nil
+}
+
+// Authenticate returns the active key matching token, or ErrInvalidAPIKey
+func (k *APIKey) Authenticate(ctx context.Context, token string) (APIKey, error) {
+	var key APIKey
+
+	if !strings.HasPrefix(token, apiKeyTokenPrefix) {
+		return key, ErrInvalidAPIKey
+	}
+	parts := strings.SplitN(strings.TrimPrefix(token, apiKeyTokenPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return key, ErrInvalidAPIKey
+	}
+
+	key, err := k.getByPrefix(ctx, parts[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return key, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKeyToken(token))) != 1 || key.Revoked() {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+func (k *APIKey) getByPrefix(ctx context.Context, prefix string) (APIKey, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select k.id, k.user_id, k.name, k.prefix, k.key_hash, k.scopes, k.last_used_at, k.revoked_at,
+		k.created_at, k.updated_at, u.id, u.first_name, u.last_name, u.email, u.access_level
+		from api_keys k
+		left join users u on (k.user_id = u.id)
+		where k.prefix = $1`
+
+	var key APIKey
+	var scopes string
+	row := DB.QueryRowContext(ctx, query, prefix)
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		&scopes,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+		&key.User.ID,
+		&key.User.FirstName,
+		&key.User.LastName,
+		&key.User.Email,
+		&key.User.AccessLevel,
+	)
+	if err != nil {
+		return key, err
+	}
+	key.Scopes = splitList(scopes)
+	return key, nil
+}
+
+// GetAll returns every key, newest first, with its owner
+func (k *APIKey) GetAll(ctx context.Context) ([]APIKey, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var keys []APIKey
+
+	query := `
+		select k.id, k.user_id, k.name, k.prefix, k.scopes, k.last_used_at, k.revoked_at,
+		k.created_at, k.updated_at, u.id, u.first_name, u.last_name, u.email
+		from api_keys k
+		left join users u on (k.user_id = u.id)
+		order by k.created_at desc`
+
+	rows, err := DB.QueryContext(ctx, query)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key APIKey
+		var scopes string
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&scopes,
+			&key.LastUsedAt,
+			&key.RevokedAt,
+			&key.CreatedAt,
+			&key.UpdatedAt,
+			&key.User.ID,
+			&key.User.FirstName,
+			&key.User.LastName,
+			&key.User.Email,
+		)
+		if err != nil {
+			return keys, err
+		}
+		key.Scopes = splitList(scopes)
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+// TouchLastUsed records that the key was just used
+func (k *APIKey) TouchLastUsed(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "update api_keys set last_used_at = $1 where id = $2", time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Revoke disables a key; revoked keys are kept so their history stays visible
+func (k *APIKey) Revoke(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "update api_keys set revoked_at = $1, updated_at = $1 where id = $2 and revoked_at is null"
+	_, err := DB.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// splitList reads a comma separated column
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,267 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// who makes the changes in the audit log
+const (
+	ActorUser   = "user"   // a staff user, or a partner with the api key of one
+	ActorGuest  = "guest"  // someone booking or looking up their reservation on the site
+	ActorSystem = "system" // the app itself: the jobs, the commands and anything outside a request
+)
+
+// what the audit log records
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	AuditMerge  = "merge" // a guest merged into another, see Guest.Merge
+)
+
+// passwordChanged stands in for a password in the audit log, which never holds one or its hash
+const passwordChanged = "(changed)"
+
+// Actor is who changes the data: Type is ActorUser, ActorGuest or ActorSystem, and ID the user or guest, 0 when
+// not known
+type Actor struct {
+	Type string
+	ID   int
+}
+
+type auditContextKey int
+
+const (
+	actorContextKey auditContextKey = iota
+	requestIDContextKey
+)
+
+// WithActor returns ctx with the actor the models record their changes under
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFrom returns the actor of ctx, the system when there is none
+func ActorFrom(ctx context.Context) Actor {
+	actor, ok := ctx.Value(actorContextKey).(Actor)
+	if !ok {
+		return Actor{Type: ActorSystem}
+	}
+	return actor
+}
+
+// WithRequestID returns ctx with the id of the request the changes are made for, to find them in the logs
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// Change is a field before and after a change, nil when it was created or deleted
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditEntry is a change to a reservation, restriction, user or guest. Entries are only added, by the models as
+// they change the data, in the same transaction
+type AuditEntry struct {
+	ID    int
+	Actor Actor
+	// ActorName is the name of the user or the email of the guest, empty when they are gone
+	ActorName string
+	Action    string
+	// Entity is the table of what changed, EntityID its id
+	Entity   string
+	EntityID int
+	// ReservationID is the reservation the change belongs to: its own changes, and those of its restriction
+	ReservationID int
+	// Changes has the fields that changed by column; all of them for a create or a delete
+	Changes   map[string]Change
+	RequestID string
+	CreatedAt time.Time
+}
+
+func (a *AuditEntry) Table() string {
+	return "audit_log"
+}
+
+// newAuditEntry is the entry of a change from before to after, made by the actor of ctx. It is false for an
+// update that changed nothing
+func newAuditEntry(ctx context.Context, action, entity string, id, reservationID int, before, after map[string]any) (AuditEntry, bool) {
+	changes := make(map[string]Change)
+	for field, value := range before {
+		if after[field] != value {
+			changes[field] = Change{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = Change{After: value}
+		}
+	}
+	if len(changes) == 0 && action == AuditUpdate {
+		return AuditEntry{}, false
+	}
+
+	return AuditEntry{
+		Actor:         ActorFrom(ctx),
+		Action:        action,
+		Entity:        entity,
+		EntityID:      id,
+		ReservationID: reservationID,
+		Changes:       changes,
+		RequestID:     requestIDFrom(ctx),
+		CreatedAt:     time.Now(),
+	}, true
+}
+
+// audit writes a change to the audit log on q, see newAuditEntry
+func audit(ctx context.Context, q dbtx, action, entity string, id, reservationID int, before, after map[string]any) error {
+	entry, ok := newAuditEntry(ctx, action, entity, id, reservationID, before, after)
+	if !ok {
+		return nil
+	}
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `insert into audit_log (actor_type, actor_id, action, entity, entity_id, reservation_id, changes,
+			request_id, created_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err = inDialect(q).ExecContext(ctx, query,
+		entry.Actor.Type,
+		entry.Actor.ID,
+		entry.Action,
+		entry.Entity,
+		entry.EntityID,
+		entry.ReservationID,
+		string(changes),
+		entry.RequestID,
+		entry.CreatedAt,
+	)
+	return err
+}
+
+// decodeChanges reads the changes column. Numbers stay as they were written instead of becoming floats
+func decodeChanges(s string) (map[string]Change, error) {
+	changes := make(map[string]Change)
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	err := d.Decode(&changes)
+	return changes, err
+}
+
+// auditDate is how dates are kept in the audit log
+func auditDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// reservationFields are the fields of a reservation the audit log follows
+func reservationFields(res Reservation) map[string]any {
+	return map[string]any{
+		"code":         res.Code,
+		"guest_id":     res.GuestID,
+		"first_name":   res.FirstName,
+		"last_name":    res.LastName,
+		"email":        res.Email,
+		"phone":        res.Phone,
+		"start_date":   auditDate(res.StartDate),
+		"end_date":     auditDate(res.EndDate),
+		"room_id":      res.RoomID,
+		"nightly_rate": res.NightlyRate,
+		"processed":    res.Processed,
+	}
+}
+
+// restrictionFields are the fields of a restriction the audit log follows
+func restrictionFields(rest Restriction) map[string]any {
+	return map[string]any{
+		"restriction_type": rest.Type,
+		"start_date":       auditDate(rest.StartDate),
+		"end_date":         auditDate(rest.EndDate),
+		"room_id":          rest.RoomID,
+		"reservation_id":   rest.ReservationID,
+		"ical_import_id":   rest.ICalImportID,
+		"external_uid":     rest.ExternalUID,
+	}
+}
+
+// userFields are the fields of a user the audit log follows, all but the password
+func userFields(user User) map[string]any {
+	return map[string]any{
+		"first_name":   user.FirstName,
+		"last_name":    user.LastName,
+		"email":        user.Email,
+		"access_level": user.AccessLevel,
+	}
+}
+
+// GetForReservation returns the history of a reservation and its restriction, the latest change first. It is
+// kept after the reservation is deleted
+func (a *AuditEntry) GetForReservation(ctx context.Context, reservationID int) ([]AuditEntry, error) {
+	return a.query(ctx, "a.reservation_id = $1", reservationID)
+}
+
+// GetForEntity returns the history of one row of entity, a table like "users", the latest change first
+func (a *AuditEntry) GetForEntity(ctx context.Context, entity string, id int) ([]AuditEntry, error) {
+	return a.query(ctx, "a.entity = $1 and a.entity_id = $2", entity, id)
+}
+
+func (a *AuditEntry) query(ctx context.Context, where string, args ...any) ([]AuditEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select a.id, a.actor_type, a.actor_id, coalesce(` + concat("u.first_name", "' '", "u.last_name") + `, g.email, ''),
+		a.action, a.entity, a.entity_id, a.reservation_id, a.changes, a.request_id, a.created_at
+		from audit_log a
+		left join users u on (a.actor_type = 'user' and u.id = a.actor_id)
+		left join guests g on (a.actor_type = 'guest' and g.id = a.actor_id)
+		where ` + where + `
+		order by a.id desc`
+
+	rows, err := inDialect(DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var i AuditEntry
+		var changes string
+		err := rows.Scan(
+			&i.ID,
+			&i.Actor.Type,
+			&i.Actor.ID,
+			&i.ActorName,
+			&i.Action,
+			&i.Entity,
+			&i.EntityID,
+			&i.ReservationID,
+			&changes,
+			&i.RequestID,
+			&i.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		i.Changes, err = decodeChanges(changes)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
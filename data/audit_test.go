@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// history lists the entries as action, entity and the fields that changed from one value to another
+func history(entries []AuditEntry) []string {
+	var got []string
+	for _, e := range entries {
+		s := e.Action + " " + e.Entity
+		if e.Action == AuditUpdate {
+			for field, c := range e.Changes {
+				s += " " + field + " " + fmtChange(c.Before) + ">" + fmtChange(c.After)
+			}
+		}
+		got = append(got, s)
+	}
+	return got
+}
+
+func fmtChange(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestAudit(t *testing.T) {
+	for _, backend := range listingBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := backend.models(t)
+			room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+
+			staff, err := m.Users.Insert(ctx, User{FirstName: "Sam", LastName: "Staff", Email: "sam@example.com",
+				Password: "password", AccessLevel: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a guest books on the site, the calendar sync moves it as the system and staff change and cancel it
+			guestCtx := WithRequestID(WithActor(ctx, Actor{Type: ActorGuest}), "host/abc-000001")
+			id, err := m.Reservations.Create(guestCtx, Reservation{FirstName: "Jane", LastName: "Smith",
+				Email: "jane@example.com", Phone: "555-0100", StartDate: day(3), EndDate: day(5), RoomID: room})
+			if err != nil {
+				t.Fatal(err)
+			}
+			restID, err := m.Restrictions.Create(guestCtx, Restriction{StartDate: day(3), EndDate: day(5),
+				RoomID: room, ReservationID: id})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			staffCtx := WithActor(ctx, Actor{Type: ActorUser, ID: staff})
+			res, _ := m.Reservations.GetByID(ctx, id)
+			res.Phone = "555-0199"
+			if err := m.Reservations.Update(staffCtx, res); err != nil {
+				t.Fatal(err)
+			}
+			// saving without a change leaves no entry
+			if err := m.Reservations.Update(staffCtx, res); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Restrictions.UpdateDates(ctx, restID, day(4), day(5)); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Reservations.Delete(staffCtx, id); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := m.Audit.GetForReservation(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{
+				"delete reservations",
+				`update restrictions start_date "` + auditDate(day(3)) + `">"` + auditDate(day(4)) + `"`,
+				`update reservations phone "555-0100">"555-0199"`,
+				"create restrictions",
+				"create reservations",
+			}
+			if got := history(entries); !reflect.DeepEqual(got, want) {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+
+			created := entries[4]
+			if created.Actor.Type != ActorGuest || created.Actor.ID != res.GuestID || created.ActorName != "jane@example.com" {
+				t.Errorf("expected the guest who booked, got %+v", created)
+			}
+			if created.RequestID != "host/abc-000001" || created.EntityID != id {
+				t.Errorf("expected the request and the reservation, got %+v", created)
+			}
+			if c := created.Changes["nightly_rate"]; c.Before != nil || c.After != json.Number("0") {
+				t.Errorf("expected the number of the new reservation, got %+v", c)
+			}
+			if entries[2].Actor != (Actor{Type: ActorUser, ID: staff}) || entries[2].ActorName != "Sam Staff" {
+				t.Errorf("expected the staff user, got %+v", entries[2])
+			}
+			if entries[1].Actor.Type != ActorSystem || entries[1].RequestID != "" {
+				t.Errorf("expected the system outside a request, got %+v", entries[1])
+			}
+			if c := entries[0].Changes["email"]; c.Before != "jane@example.com" || c.After != nil {
+				t.Errorf("expected the deleted reservation, got %+v", c)
+			}
+
+			// the users are followed too, without their password
+			user, _ := m.Users.GetByID(ctx, staff)
+			user.AccessLevel = 3
+			if err := m.Users.Update(staffCtx, user); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Users.UpdatePassword(staffCtx, user, []byte("hash")); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Users.Delete(staffCtx, staff); err != nil {
+				t.Fatal(err)
+			}
+			entries, err = m.Audit.GetForEntity(ctx, "users", staff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = []string{
+				"delete users",
+				`update users password null>"` + passwordChanged + `"`,
+				"update users access_level 1>3",
+				"create users",
+			}
+			if got := history(entries); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+			if entries[0].ActorName != "" {
+				t.Errorf("expected no name for a deleted user, got %q", entries[0].ActorName)
+			}
+		})
+	}
+}
+
+func TestAudit_Rollback(t *testing.T) {
+	for _, backend := range listingBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := backend.models(t)
+			room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+
+			// a booking that fails leaves no history
+			_ = m.Transaction(ctx, func(tx *Tx) error {
+				_, err := m.Reservations.CreateTx(ctx, tx, Reservation{FirstName: "Jane", LastName: "Smith",
+					Email: "jane@example.com", StartDate: day(3), EndDate: day(5), RoomID: room})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return errors.New("payment declined")
+			})
+			if entries, _ := m.Audit.GetForReservation(ctx, 1); len(entries) != 0 {
+				t.Errorf("expected no entries, got %+v", entries)
+			}
+		})
+	}
+}
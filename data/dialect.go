@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect is the flavour of sql the database speaks. The queries of the models are written for postgres,
+// with $n placeholders; on MySQL and MariaDB they are rewritten as they run. SQLite takes them as they are
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	MySQL
+	SQLite
+)
+
+// dialect is the Dialect of DB, set by New
+var dialect = Postgres
+
+// DialectOf returns the Dialect of a DATABASE_TYPE; mariadb speaks MySQL and anything else postgres
+func DialectOf(databaseType string) Dialect {
+	switch strings.ToLower(databaseType) {
+	case "mysql", "mariadb":
+		return MySQL
+	case "sqlite", "sqlite3":
+		return SQLite
+	}
+	return Postgres
+}
+
+// inDialect returns q running its queries in the dialect of the database
+func inDialect(q dbtx) dbtx {
+	switch dialect {
+	case MySQL:
+		return mysqlDB{q}
+	case SQLite:
+		return sqliteDB{q}
+	}
+	return q
+}
+
+// concat is the sql joining the text of exprs: || on postgres and SQLite, concat() on MySQL, where || means or
+func concat(exprs ...string) string {
+	if dialect == MySQL {
+		return "concat(" + strings.Join(exprs, ", ") + ")"
+	}
+	return strings.Join(exprs, " || ")
+}
+
+// insertID runs an insert on q and returns the id of the new row: postgres and SQLite return it from the insert,
+// MySQL has no returning and reports it in the result
+func insertID(ctx context.Context, q dbtx, query string, args ...any) (int, error) {
+	if dialect == MySQL {
+		result, err := inDialect(q).ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		return int(id), nil
+	}
+
+	var id int
+	err := inDialect(q).QueryRowContext(ctx, query+" returning id", args...).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// mysqlDB runs the postgres queries of the models on a MySQL q
+type mysqlDB struct {
+	q dbtx
+}
+
+func (m mysqlDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	query, args, err := rebindMySQL(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.q.ExecContext(ctx, query, args...)
+}
+
+func (m mysqlDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	query, args, err := rebindMySQL(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.q.QueryContext(ctx, query, args...)
+}
+
+func (m mysqlDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	query, args, err := rebindMySQL(query, args)
+	if err != nil {
+		// a bad query is a bug; let the database report it on Scan
+		return m.q.QueryRowContext(ctx, query)
+	}
+	return m.q.QueryRowContext(ctx, query, args...)
+}
+
+// placeholder is a postgres placeholder like $1
+var placeholder = regexp.MustCompile(`\$[0-9]+`)
+
+// rebindMySQL turns the $n placeholders of query into the ? of MySQL. A ? stands for the next argument,
+// so args are repeated and reordered to follow the placeholders
+func rebindMySQL(query string, args []any) (string, []any, error) {
+	var bound []any
+	var err error
+	query = placeholder.ReplaceAllStringFunc(query, func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+		if n < 1 || n > len(args) {
+			err = fmt.Errorf("data: query uses %s but has %d arguments", p, len(args))
+			return p
+		}
+		bound = append(bound, args[n-1])
+		return "?"
+	})
+	return query, bound, err
+}
+
+// sqliteDB runs the queries of the models on a SQLite q. SQLite has no date type: dates are kept as text and
+// compared as text, so every time is written in UTC to keep them in order
+type sqliteDB struct {
+	q dbtx
+}
+
+func (s sqliteDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.q.ExecContext(ctx, query, inUTC(args)...)
+}
+
+func (s sqliteDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.q.QueryContext(ctx, query, inUTC(args)...)
+}
+
+func (s sqliteDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.q.QueryRowContext(ctx, query, inUTC(args)...)
+}
+
+// inUTC returns args with the times in UTC
+func inUTC(args []any) []any {
+	utc := make([]any, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			arg = t.UTC()
+		}
+		utc[i] = arg
+	}
+	return utc
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestRebindMySQL(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		args      []any
+		wantQuery string
+		wantArgs  []any
+	}{
+		{"in order", "update rooms set name=$1 where id=$2", []any{"a", 1}, "update rooms set name=? where id=?", []any{"a", 1}},
+		{"repeated", "select 1 where $1 = '' or status = $1 limit $2", []any{"", 5}, "select 1 where ? = '' or status = ? limit ?", []any{"", "", 5}},
+		{"out of order", "select 1 where a = $2 and b = $1", []any{"b", "a"}, "select 1 where a = ? and b = ?", []any{"a", "b"}},
+		{"two digits", "values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)", []any{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+			"values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", []any{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+		{"no placeholders", "select count(*) from users", nil, "select count(*) from users", nil},
+	}
+	for _, tt := range tests {
+		query, args, err := rebindMySQL(tt.query, tt.args)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if query != tt.wantQuery || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: expected %q %v, got %q %v", tt.name, tt.wantQuery, tt.wantArgs, query, args)
+		}
+	}
+
+	if _, _, err := rebindMySQL("select 1 where id = $2", []any{1}); err == nil {
+		t.Error("expected an error for a placeholder without an argument")
+	}
+}
+
+func TestDialectOf(t *testing.T) {
+	for databaseType, want := range map[string]Dialect{
+		"postgres": Postgres, "postgresql": Postgres, "mysql": MySQL, "MariaDB": MySQL, "sqlite": SQLite, "": Postgres,
+	} {
+		if got := DialectOf(databaseType); got != want {
+			t.Errorf("%q: expected %v, got %v", databaseType, want, got)
+		}
+	}
+}
+
+// recordingDB keeps the statements run on it
+type recordingDB struct {
+	query string
+	args  []any
+}
+
+func (r *recordingDB) ExecContext(_ context.Context, query string, args ...any) (sql.Result, error) {
+	r.query, r.args = query, args
+	return insertResult(42), nil
+}
+
+func (r *recordingDB) QueryContext(context.Context, string, ...any) (*sql.Rows, error) {
+	panic("not used")
+}
+
+func (r *recordingDB) QueryRowContext(context.Context, string, ...any) *sql.Row {
+	panic("not used")
+}
+
+type insertResult int64
+
+func (id insertResult) LastInsertId() (int64, error) { return int64(id), nil }
+func (id insertResult) RowsAffected() (int64, error) { return 1, nil }
+
+func TestInsertID_MySQL(t *testing.T) {
+	dialect = MySQL
+	defer func() { dialect = Postgres }()
+
+	db := &recordingDB{}
+	id, err := insertID(context.Background(), db, "insert into rooms (name, nightly_rate) values ($1, $2)", "majors suite", 12900)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 {
+		t.Errorf("expected the id of the result, got %d", id)
+	}
+	if db.query != "insert into rooms (name, nightly_rate) values (?, ?)" || len(db.args) != 2 {
+		t.Errorf("unexpected statement %q %v", db.query, db.args)
+	}
+}
@@ -0,0 +1,209 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrSameGuest is returned when a guest is to be merged into themselves
+var ErrSameGuest = errors.New("data: cannot merge a guest into themselves")
+
+// Guest is someone who stays with us, the profile their reservations share. Returning guests are matched by
+// email; the profile has the details of their latest booking, each reservation keeps those it was booked with
+type Guest struct {
+	ID        int
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (g *Guest) Table() string {
+	return "guests"
+}
+
+// matchGuest returns the id of the guest with the email of res, adding them when the email is new. The email of
+// a merged guest finds the guest they were merged into, see Merge. A returning guest gets the name and phone of res
+func matchGuest(ctx context.Context, q dbtx, res Reservation) (int, error) {
+	var guestID int
+	err := inDialect(q).QueryRowContext(ctx, "select guest_id from guest_emails where email = $1",
+		strings.ToLower(res.Email)).Scan(&guestID)
+	if err == nil {
+		_, err = inDialect(q).ExecContext(ctx,
+			"update guests set first_name = $1, last_name = $2, phone = $3, updated_at = $4 where id = $5",
+			strings.ToLower(res.FirstName), strings.ToLower(res.LastName), res.Phone, time.Now(), guestID)
+		return guestID, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	query := `insert into guests (first_name, last_name, email, phone, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6)`
+	if dialect == MySQL {
+		// last_insert_id(id) makes the id of the guest already there the one reported
+		query += ` on duplicate key update id = last_insert_id(id), first_name = values(first_name),
+			last_name = values(last_name), phone = values(phone), updated_at = values(updated_at)`
+	} else {
+		query += ` on conflict (email) do update set first_name = excluded.first_name,
+			last_name = excluded.last_name, phone = excluded.phone, updated_at = excluded.updated_at`
+	}
+	return insertID(ctx, q, query,
+		strings.ToLower(res.FirstName),
+		strings.ToLower(res.LastName),
+		strings.ToLower(res.Email),
+		res.Phone,
+		time.Now(),
+		time.Now(),
+	)
+}
+
+// GetByID returns the guest with the given id
+func (g *Guest) GetByID(ctx context.Context, id int) (Guest, error) {
+	return g.get(ctx, "id = $1", id)
+}
+
+// GetByEmail returns the guest booking with email, ignoring case, or the guest the one with email was merged into
+func (g *Guest) GetByEmail(ctx context.Context, email string) (Guest, error) {
+	return g.get(ctx, "email = $1 or id in (select guest_id from guest_emails where email = $1)",
+		strings.ToLower(email))
+}
+
+func (g *Guest) get(ctx context.Context, where string, args ...any) (Guest, error) {
+	guests, err := g.query(ctx, where, args...)
+	if err != nil {
+		return Guest{}, err
+	}
+	if len(guests) == 0 {
+		return Guest{}, sql.ErrNoRows
+	}
+	return guests[0], nil
+}
+
+// Duplicates returns the other guests that may be the same person as guest: with the same phone, or the same
+// first and last name
+func (g *Guest) Duplicates(ctx context.Context, guest Guest) ([]Guest, error) {
+	return g.query(ctx, "id <> $1 and (phone = $2 or (first_name = $3 and last_name = $4))",
+		guest.ID, guest.Phone, strings.ToLower(guest.FirstName), strings.ToLower(guest.LastName))
+}
+
+func (g *Guest) query(ctx context.Context, where string, args ...any) ([]Guest, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select id, first_name, last_name, email, phone, created_at, updated_at
+		from guests
+		where ` + where + `
+		order by id`
+
+	rows, err := inDialect(DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var guests []Guest
+	for rows.Next() {
+		var i Guest
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		guests = append(guests, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return guests, nil
+}
+
+// Merge moves the reservations of the guest mergeID to the guest keepID and deletes mergeID, for a guest who
+// booked under two emails. keepID keeps their details, and the emails of mergeID stay with keepID in guest_emails
+// so that later bookings with them find keepID. It returns sql.ErrNoRows when either guest is missing
+func (g *Guest) Merge(ctx context.Context, keepID, mergeID int) error {
+	if keepID == mergeID {
+		return ErrSameGuest
+	}
+
+	return transaction(ctx, func(tx *sql.Tx) error {
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
+
+		var found int
+		err := inDialect(tx).QueryRowContext(ctx, "select count(*) from guests where id in ($1, $2)",
+			keepID, mergeID).Scan(&found)
+		if err != nil {
+			return err
+		}
+		if found != 2 {
+			return sql.ErrNoRows
+		}
+
+		// the reservations that move, for the audit log
+		var moved []int
+		rows, err := inDialect(tx).QueryContext(ctx, "select id from reservations where guest_id = $1", mergeID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			moved = append(moved, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		_, err = inDialect(tx).ExecContext(ctx, "update reservations set guest_id = $1 where guest_id = $2",
+			keepID, mergeID)
+		if err != nil {
+			return err
+		}
+		// the emails of mergeID, and those of guests merged into mergeID before, now find keepID
+		_, err = inDialect(tx).ExecContext(ctx, "update guest_emails set guest_id = $1 where guest_id = $2",
+			keepID, mergeID)
+		if err != nil {
+			return err
+		}
+		var email string
+		err = inDialect(tx).QueryRowContext(ctx, "select email from guests where id = $1", mergeID).Scan(&email)
+		if err != nil {
+			return err
+		}
+		_, err = inDialect(tx).ExecContext(ctx,
+			"insert into guest_emails (email, guest_id, created_at) values ($1, $2, $3)", email, keepID, time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = inDialect(tx).ExecContext(ctx, "delete from guests where id = $1", mergeID)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range moved {
+			err = audit(ctx, tx, AuditUpdate, "reservations", id, id,
+				map[string]any{"guest_id": mergeID}, map[string]any{"guest_id": keepID})
+			if err != nil {
+				return err
+			}
+		}
+		return audit(ctx, tx, AuditMerge, g.Table(), mergeID, 0, nil, map[string]any{"merged_into": keepID})
+	})
+}
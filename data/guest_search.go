@@ -0,0 +1,272 @@
+package data
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// fields a guest search matches on, GuestMatch.Field
+const (
+	MatchCode  = "code"
+	MatchEmail = "email"
+	MatchName  = "name"
+	MatchPhone = "phone"
+)
+
+// sizes of a guest search
+const (
+	// MinSearchLength is the shortest search text, shorter ones find nothing
+	MinSearchLength    = 2
+	DefaultSearchLimit = 20
+)
+
+// scores of a GuestMatch: the whole field, the start of it or of a name, anywhere in it, and else how alike
+// they are. minSimilarity is the least a fuzzy match needs, the default threshold of the % operator of pg_trgm
+const (
+	scoreExact     = 1.0
+	scorePrefix    = 0.9
+	scoreSubstring = 0.6
+	minSimilarity  = 0.3
+)
+
+// GuestMatch is a reservation found by a guest search
+type GuestMatch struct {
+	Reservation Reservation
+	// Field is what matched best: MatchCode, MatchEmail, MatchName or MatchPhone
+	Field string
+	// Score ranks the matches, 1 for a whole code, email, name or phone, down to the least similarity a fuzzy
+	// match needs
+	Score float64
+}
+
+// phoneKey is a phone number without the spaces and punctuation it is written with, the way phoneDigits does it
+var phoneKey = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "", "+", "").Replace
+
+// phoneDigits is the sql of phoneKey
+const phoneDigits = `replace(replace(replace(replace(replace(replace(r.phone, ' ', ''), '-', ''), '(', ''), ')', ''), '.', ''), '+', '')`
+
+// guestSearch is the text of a guest search made ready to run
+type guestSearch struct {
+	text string
+	// phone is the text as a phone number, empty when it has no digits
+	phone string
+	limit int
+}
+
+func newGuestSearch(text string, limit int) (guestSearch, bool) {
+	s := guestSearch{text: strings.Join(strings.Fields(strings.ToLower(text)), " "), limit: limit}
+	if len([]rune(s.text)) < MinSearchLength {
+		return s, false
+	}
+	if strings.IndexFunc(s.text, unicode.IsDigit) >= 0 {
+		s.phone = phoneKey(s.text)
+	}
+	if s.limit <= 0 {
+		s.limit = DefaultSearchLimit
+	}
+	if s.limit > MaxPageSize {
+		s.limit = MaxPageSize
+	}
+	return s, true
+}
+
+// match scores res on the field it matches best; the earlier field wins a tie. Fuzzy matches compare the
+// code, the name and the part of the email before the @; phone numbers alike are still other people's
+func (s guestSearch) match(res Reservation) GuestMatch {
+	m := GuestMatch{Reservation: res}
+	consider := func(field, value, text, similar string, names ...string) {
+		score := 0.0
+		if similar != "" {
+			score = similarity(similar, text)
+		}
+		switch {
+		case value == text:
+			score = scoreExact
+		case strings.HasPrefix(value, text):
+			score = scorePrefix
+		case strings.Contains(value, text):
+			score = math.Max(score, scoreSubstring)
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, text) {
+				score = math.Max(score, scorePrefix)
+			}
+		}
+		if score > m.Score {
+			m.Field, m.Score = field, score
+		}
+	}
+
+	code, email := strings.ToLower(res.Code), strings.ToLower(res.Email)
+	name := strings.ToLower(res.FirstName + " " + res.LastName)
+	local, _, _ := strings.Cut(email, "@")
+	consider(MatchCode, code, s.text, code)
+	consider(MatchEmail, email, s.text, local)
+	consider(MatchName, name, s.text, name, strings.ToLower(res.FirstName), strings.ToLower(res.LastName))
+	if s.phone != "" {
+		consider(MatchPhone, phoneKey(res.Phone), s.phone, "")
+	}
+	return m
+}
+
+// rank scores the reservations and returns the best of those that match, the best first; equal matches
+// put the latest arrival first
+func (s guestSearch) rank(reservations []Reservation) []GuestMatch {
+	var matches []GuestMatch
+	for _, res := range reservations {
+		if m := s.match(res); m.Score >= minSimilarity {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.Reservation.StartDate.Equal(b.Reservation.StartDate) {
+			return a.Reservation.StartDate.After(b.Reservation.StartDate)
+		}
+		return a.Reservation.ID > b.Reservation.ID
+	})
+	if len(matches) > s.limit {
+		matches = matches[:s.limit]
+	}
+	return matches
+}
+
+// trigrams returns the trigrams of text the way pg_trgm makes them: each word of letters and digits, lowercased
+// and padded with two spaces in front and one behind, cut in every run of three
+func trigrams(text string) map[string]bool {
+	set := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// similarity is the similarity of pg_trgm: the trigrams a and b share out of all the trigrams of both
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// Search finds the reservations of a guest by name, email, phone or confirmation code, ignoring case, and
+// returns at most limit of them, the best match first. A whole field ranks first, then the start of one or of
+// a name, then text anywhere in one. On postgres, misspelt text finds the names, emails and codes it is similar
+// to as well, through the trigram indexes of pg_trgm; MySQL and SQLite only find the text as it is written
+func (r *Reservation) Search(ctx context.Context, text string, limit int) ([]GuestMatch, error) {
+	s, ok := newGuestSearch(text, limit)
+	if !ok {
+		return nil, nil
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	// each field with the sql of what it is matched on, and of what fuzzy matches compare
+	name := "lower(" + concat("r.first_name", "' '", "r.last_name") + ")"
+	fields := []struct{ field, similar string }{
+		{"lower(r.code)", "lower(r.code)"},
+		{"lower(r.email)", "split_part(lower(r.email), '@', 1)"},
+		{name, name},
+	}
+
+	exact, prefix, contains := arg(s.text), arg(escapeLike(s.text)+"%"), arg(likePattern(s.text))
+	var isExact, hasPrefix, hasText, isSimilar, similarities []string
+	for _, f := range fields {
+		isExact = append(isExact, f.field+" = "+exact)
+		hasPrefix = append(hasPrefix, f.field+" like "+prefix+" escape '!'")
+		hasText = append(hasText, f.field+" like "+contains+" escape '!'")
+		isSimilar = append(isSimilar, f.similar+" % "+exact)
+		similarities = append(similarities, "similarity("+f.similar+", "+exact+")")
+	}
+	for _, field := range []string{"lower(r.first_name)", "lower(r.last_name)"} {
+		hasPrefix = append(hasPrefix, field+" like "+prefix+" escape '!'")
+	}
+	if s.phone != "" {
+		isExact = append(isExact, phoneDigits+" = "+arg(s.phone))
+		hasPrefix = append(hasPrefix, phoneDigits+" like "+arg(escapeLike(s.phone)+"%")+" escape '!'")
+		hasText = append(hasText, phoneDigits+" like "+arg(likePattern(s.phone))+" escape '!'")
+	}
+
+	// the where clause finds the candidates and the order keeps the best of them, ranked again by rank
+	where := strings.Join(hasText, " or ")
+	order := `case when ` + strings.Join(isExact, " or ") + ` then 0 when ` + strings.Join(hasPrefix, " or ") +
+		` then 1 when ` + strings.Join(hasText, " or ") + ` then 2 else 3 end`
+	if dialect == Postgres {
+		where += " or " + strings.Join(isSimilar, " or ")
+		order += ", greatest(" + strings.Join(similarities, ", ") + ") desc"
+	}
+
+	query := `
+	select r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+	r.end_date, r.room_id, r.nightly_rate, r.created_at, r.updated_at, r.processed, r.guest_id, rm.id, rm.name
+	from reservations r
+	left join rooms rm on (r.room_id = rm.id)
+	where ` + where + `
+	order by ` + order + `, r.start_date desc, r.id desc
+	limit ` + arg(s.limit)
+
+	rows, err := inDialect(DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []Reservation
+	for rows.Next() {
+		var i Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.NightlyRate,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.GuestID,
+			&i.Room.ID,
+			&i.Room.Name,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.rank(reservations), nil
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	// the values pg_trgm gives
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"word", "two words", 4.0 / 11},
+		{"Smith", "smith", 1},
+		{"smith", "smiht", 3.0 / 9},
+		{"cooper", "", 0},
+		{"--", "--", 0},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("similarity(%q, %q): expected %f, got %f", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+// matched lists the first names of the matches, which the models keep in lower case, with the field that matched
+func matched(matches []GuestMatch) []string {
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Reservation.FirstName+" "+m.Field)
+	}
+	return got
+}
+
+// literal keeps the matches that are more than similar, the ones every database finds
+func literal(matches []GuestMatch) []GuestMatch {
+	var kept []GuestMatch
+	for _, m := range matches {
+		if m.Score >= scoreSubstring {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+func TestReservations_Search(t *testing.T) {
+	for _, backend := range listingBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := backend.models(t)
+			seedListing(t, m)
+
+			tests := []struct {
+				name string
+				text string
+				want []string
+			}{
+				{"last name, latest arrival first", "ARCHER", []string{"eve name", "ann name"}},
+				{"start of a name", "arch", []string{"eve name", "ann name"}},
+				{"start of the first name", "bo", []string{"bob email"}},
+				{"whole name", "  ann   archer ", []string{"ann name"}},
+				{"whole email before the start of one", "dan_d@example.com", []string{"dan email"}},
+				{"phone however it is written", "(555) 0103", []string{"cleo phone"}},
+				{"end of a phone", "0104", []string{"dan phone"}},
+				{"confirmation code", "tpk8wx5rhg", []string{"cleo code"}},
+				{"wildcards are text", "n_d", []string{"dan email"}},
+				{"too short", "a", nil},
+				{"nothing", "zed", nil},
+			}
+			for _, tt := range tests {
+				matches, err := m.Reservations.Search(ctx, tt.text, 0)
+				if err != nil {
+					t.Fatalf("%s: %s", tt.name, err)
+				}
+				if got := matched(literal(matches)); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+				}
+			}
+
+			// the start of a field ranks above text inside one, and the limit keeps the best
+			matches, _ := m.Reservations.Search(ctx, "an", 0)
+			if got := matched(literal(matches)); !reflect.DeepEqual(got, []string{"ann email", "dan email"}) {
+				t.Errorf("expected the email starting with an first, got %v", got)
+			}
+			matches, _ = m.Reservations.Search(ctx, "example", 2)
+			if len(matches) != 2 || matches[0].Score != scoreSubstring {
+				t.Errorf("expected two matches inside the email, got %+v", matches)
+			}
+		})
+	}
+}
+
+func TestReservations_SearchMisspelt(t *testing.T) {
+	// only the memory models and postgres find similar text
+	ctx := context.Background()
+	m := NewMemory()
+	seedListing(t, m)
+
+	matches, err := m.Reservations.Search(ctx, "cleo kuper", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := matched(matches); !reflect.DeepEqual(got, []string{"cleo name"}) {
+		t.Errorf("expected the similar name, got %v", got)
+	}
+	if matches[0].Score >= scoreSubstring || matches[0].Score < minSimilarity {
+		t.Errorf("expected a fuzzy score, got %f", matches[0].Score)
+	}
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestGuests(t *testing.T) {
+	for _, backend := range listingBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := backend.models(t)
+			room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+
+			book := func(first, email, phone string, start int) Reservation {
+				t.Helper()
+				id, err := m.Reservations.Create(ctx, Reservation{FirstName: first, LastName: "Smith", Email: email,
+					Phone: phone, StartDate: day(start), EndDate: day(start + 2), RoomID: room})
+				if err != nil {
+					t.Fatal(err)
+				}
+				res, err := m.Reservations.GetByID(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return res
+			}
+
+			// the second stay finds the guest by email and brings the profile up to date
+			first := book("Jane", "jane@example.com", "555-0100", 3)
+			second := book("Janet", "JANE@example.com", "555-0111", 10)
+			if first.GuestID == 0 || second.GuestID != first.GuestID {
+				t.Fatalf("expected one guest for both stays, got %d and %d", first.GuestID, second.GuestID)
+			}
+			jane, err := m.Guests.GetByEmail(ctx, "Jane@Example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jane.ID != first.GuestID || jane.FirstName != "janet" || jane.Phone != "555-0111" {
+				t.Errorf("expected the latest details on the profile, got %+v", jane)
+			}
+			if first.FirstName != "jane" {
+				t.Errorf("expected the reservation to keep its details, got %s", first.FirstName)
+			}
+
+			stays, err := m.Reservations.GetForGuest(ctx, jane.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stays) != 2 || stays[0].ID != second.ID || stays[1].ID != first.ID {
+				t.Errorf("expected both stays, the latest first, got %+v", stays)
+			}
+
+			// the same person under another email is a duplicate, and merging them leaves one guest
+			other := book("Jane", "j.smith@example.com", "555-0199", 20)
+			if other.GuestID == jane.ID {
+				t.Fatal("expected a new guest for a new email")
+			}
+			duplicates, err := m.Guests.Duplicates(ctx, Guest{ID: other.GuestID, FirstName: "Jane", LastName: "Smith"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(duplicates) != 0 {
+				t.Errorf("expected no guest with the same name once the profile says janet, got %+v", duplicates)
+			}
+			duplicates, _ = m.Guests.Duplicates(ctx, Guest{ID: other.GuestID, Phone: "555-0111"})
+			if len(duplicates) != 1 || duplicates[0].ID != jane.ID {
+				t.Errorf("expected jane by her phone, got %+v", duplicates)
+			}
+
+			if err := m.Guests.Merge(ctx, jane.ID, jane.ID); !errors.Is(err, ErrSameGuest) {
+				t.Errorf("expected ErrSameGuest, got %v", err)
+			}
+			if err := m.Guests.Merge(ctx, jane.ID, 999); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected sql.ErrNoRows for a missing guest, got %v", err)
+			}
+			err = m.Guests.Merge(ctx, jane.ID, other.GuestID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Guests.GetByID(ctx, other.GuestID); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected the merged guest to be gone, got %v", err)
+			}
+			if stays, _ := m.Reservations.GetForGuest(ctx, jane.ID); len(stays) != 3 || stays[0].ID != other.ID {
+				t.Errorf("expected the three stays with jane, got %+v", stays)
+			}
+
+			// the merged email still finds jane, for the staff and for the next booking
+			if found, err := m.Guests.GetByEmail(ctx, "J.Smith@example.com"); err != nil || found.ID != jane.ID {
+				t.Errorf("expected jane by her merged email, got %+v %v", found, err)
+			}
+			again := book("Jane", "J.Smith@example.com", "555-0199", 30)
+			if again.GuestID != jane.ID {
+				t.Errorf("expected the booking with the merged email to go to jane %d, got %d", jane.ID, again.GuestID)
+			}
+			if jane, _ = m.Guests.GetByID(ctx, jane.ID); jane.FirstName != "jane" || jane.Phone != "555-0199" {
+				t.Errorf("expected the latest details on the profile, got %+v", jane)
+			}
+
+			// changing the email of a reservation moves it to the guest of that email
+			second.Email = "janet@example.com"
+			err = m.Reservations.Update(ctx, second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			janet, err := m.Guests.GetByEmail(ctx, "janet@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved, _ := m.Reservations.GetByID(ctx, second.ID); moved.GuestID != janet.ID {
+				t.Errorf("expected the reservation with guest %d, got %d", janet.ID, moved.GuestID)
+			}
+
+			// merged once more, both emails of jane go along
+			err = m.Guests.Merge(ctx, janet.ID, jane.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, email := range []string{"jane@example.com", "j.smith@example.com"} {
+				if res := book("Jane", email, "555-0100", 40); res.GuestID != janet.ID {
+					t.Errorf("expected the booking with %s to go to janet %d, got %d", email, janet.ID, res.GuestID)
+				}
+			}
+		})
+	}
+}
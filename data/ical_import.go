@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// sync statuses of an import
+const (
+	SyncStatusOK    = "ok"
+	SyncStatusError = "error"
+)
+
+// ICalImport is a calendar feed published by another booking platform for one of our rooms.
+// Its events are kept in sync as restrictions of type RestrictionExternal
+type ICalImport struct {
+	ID           int
+	RoomID       int
+	Name         string
+	URL          string
+	LastSyncedAt sql.NullTime
+	LastStatus   string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Room         Room
+}
+
+func (i *ICalImport) Table() string {
+	return "ical_imports"
+}
+
+// Insert adds an import and returns its id
+func (i *ICalImport) Insert(ctx context.Context, imp ICalImport) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	query := `insert into ical_imports (room_id, name, url, created_at, updated_at)
+			values ($1, $2, $3, $4, $5) returning id`
+	err := DB.QueryRowContext(ctx, query,
+		imp.RoomID,
+		imp.Name,
+		imp.URL,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+const icalImportColumns = `i.id, i.room_id, i.name, i.url, i.last_synced_at, i.last_status,
+		i.created_at, i.updated_at, r.id, r.name`
+
+func scanICalImport(row interface{ Scan(...any) error }) (ICalImport, error) {
+	var imp ICalImport
+	var updatedAt sql.NullTime
+	err := row.Scan(
+		&imp.ID,
+		&imp.RoomID,
+		&imp.Name,
+		&imp.URL,
+		&imp.LastSyncedAt,
+		&imp.LastStatus,
+		&imp.CreatedAt,
+		&updatedAt,
+		&imp.Room.ID,
+		&imp.Room.Name,
+	)
+	imp.UpdatedAt = updatedAt.Time
+	return imp, err
+}
+
+// GetAll returns every import with its room, ordered by room
+func (i *ICalImport) GetAll(ctx context.Context) ([]ICalImport, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var imports []ICalImport
+
+	query := `select ` + icalImportColumns + `
+		from ical_imports i
+		left join rooms r on (i.room_id = r.id)
+		order by r.name, i.name`
+
+	rows, err := DB.QueryContext(ctx, query)
+	if err != nil {
+		return imports, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		imp, err := scanICalImport(rows)
+		if err != nil {
+			return imports, err
+		}
+		imports = append(imports, imp)
+	}
+	if err = rows.Err(); err != nil {
+		return imports, err
+	}
+
+	return imports, nil
+}
+
+// GetByID returns an import with its room
+func (i *ICalImport) GetByID(ctx context.Context, id int) (ICalImport, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + icalImportColumns + `
+		from ical_imports i
+		left join rooms r on (i.room_id = r.id)
+		where i.id = $1`
+
+	return scanICalImport(DB.QueryRowContext(ctx, query, id))
+}
+
+// Delete removes an import; its restrictions and sync log go with it
+func (i *ICalImport) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "delete from ical_imports where id = $1", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkSynced records when an import was last synced and how it went
+func (i *ICalImport) MarkSynced(ctx context.Context, id int, status string, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `update ical_imports set last_synced_at = $1, last_status = $2, updated_at = $3 where id = $4`
+	_, err := DB.ExecContext(ctx, query, at, status, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ICalSyncLog is the outcome of one sync of an import
+type ICalSyncLog struct {
+	ID           int
+	ICalImportID int
+	Status       string
+	Created      int
+	Updated      int
+	Deleted      int
+	Message      string
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Import       ICalImport
+}
+
+func (l *ICalSyncLog) Table() string {
+	return "ical_sync_logs"
+}
+
+// Insert records a sync
+func (l *ICalSyncLog) Insert(ctx context.Context, entry ICalSyncLog) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `insert into ical_sync_logs (ical_import_id, status, created, updated, deleted, message, started_at, finished_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := DB.ExecContext(ctx, query,
+		entry.ICalImportID,
+		entry.Status,
+		entry.Created,
+		entry.Updated,
+		entry.Deleted,
+		entry.Message,
+		entry.StartedAt,
+		entry.FinishedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetRecent returns the latest limit syncs of every import, newest first
+func (l *ICalSyncLog) GetRecent(ctx context.Context, limit int) ([]ICalSyncLog, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var logs []ICalSyncLog
+
+	query := `
+		select l.id, l.ical_import_id, l.status, l.created, l.updated, l.deleted, l.message,
+		l.started_at, l.finished_at, i.name, r.name
+		from ical_sync_logs l
+		left join ical_imports i on (l.ical_import_id = i.id)
+		left join rooms r on (i.room_id = r.id)
+		order by l.started_at desc
+		limit $1`
+
+	rows, err := DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return logs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry ICalSyncLog
+		err := rows.Scan(
+			&entry.ID,
+			&entry.ICalImportID,
+			&entry.Status,
+			&entry.Created,
+			&entry.Updated,
+			&entry.Deleted,
+			&entry.Message,
+			&entry.StartedAt,
+			&entry.FinishedAt,
+			&entry.Import.Name,
+			&entry.Import.Room.Name,
+		)
+		if err != nil {
+			return logs, err
+		}
+		entry.Import.ID = entry.ICalImportID
+		logs = append(logs, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return logs, err
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Invoice is what a reservation was billed. It is a copy taken when the invoice was issued,
+// later changes to the reservation or the room rate do not change it
+type Invoice struct {
+	ID     int
+	Number int
+	// ReservationID is 0 once the reservation is cancelled, invoices are never deleted
+	ReservationID int
+	Code          string
+	GuestName     string
+	Email         string
+	RoomName      string
+	StartDate     time.Time
+	EndDate       time.Time
+	// amounts are in cents
+	NightlyRate int
+	Subtotal    int
+	TaxName     string
+	// TaxRate is in hundredths of a percent, 1250 is 12.5%
+	TaxRate  int
+	Tax      int
+	Total    int
+	Currency string
+	IssuedAt time.Time
+}
+
+func (i *Invoice) Table() string {
+	return "invoices"
+}
+
+// Nights is the length of the stay billed
+func (i *Invoice) Nights() int {
+	return int(i.EndDate.Sub(i.StartDate).Hours() / 24)
+}
+
+// Issue gives inv the next invoice number and stores it. A reservation only ever has one invoice,
+// when it already has one that invoice is returned instead.
+//
+// The number is taken from invoice_sequence in the same transaction as the insert, which holds the row
+// lock until it commits: invoices are numbered in the order they are issued, and a failed insert gives
+// its number back, so there are no gaps
+func (i *Invoice) Issue(ctx context.Context, inv Invoice) (Invoice, error) {
+	existing, err := i.GetByReservation(ctx, inv.ReservationID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return inv, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	err = transaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			"update invoice_sequence set last_number = last_number + 1 where id = 1 returning last_number",
+		).Scan(&inv.Number)
+		if err != nil {
+			return err
+		}
+
+		query := `insert into invoices (number, reservation_id, code, guest_name, email, room_name, start_date,
+				end_date, nightly_rate, subtotal, tax_name, tax_rate, tax, total, currency, issued_at)
+				values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) returning id`
+		inv.IssuedAt = time.Now()
+		return tx.QueryRowContext(ctx, query,
+			inv.Number,
+			inv.ReservationID,
+			inv.Code,
+			inv.GuestName,
+			inv.Email,
+			inv.RoomName,
+			inv.StartDate,
+			inv.EndDate,
+			inv.NightlyRate,
+			inv.Subtotal,
+			inv.TaxName,
+			inv.TaxRate,
+			inv.Tax,
+			inv.Total,
+			inv.Currency,
+			inv.IssuedAt,
+		).Scan(&inv.ID)
+	})
+	if err != nil {
+		// another request may have issued the invoice of the reservation first
+		if existing, getErr := i.GetByReservation(ctx, inv.ReservationID); getErr == nil {
+			return existing, nil
+		}
+		return inv, err
+	}
+	return inv, nil
+}
+
+const invoiceColumns = `id, number, coalesce(reservation_id, 0), code, guest_name, email, room_name, start_date,
+		end_date, nightly_rate, subtotal, tax_name, tax_rate, tax, total, currency, issued_at`
+
+func scanInvoice(row *sql.Row) (Invoice, error) {
+	var inv Invoice
+	err := row.Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.ReservationID,
+		&inv.Code,
+		&inv.GuestName,
+		&inv.Email,
+		&inv.RoomName,
+		&inv.StartDate,
+		&inv.EndDate,
+		&inv.NightlyRate,
+		&inv.Subtotal,
+		&inv.TaxName,
+		&inv.TaxRate,
+		&inv.Tax,
+		&inv.Total,
+		&inv.Currency,
+		&inv.IssuedAt,
+	)
+	return inv, err
+}
+
+// GetByReservation returns the invoice of a reservation, sql.ErrNoRows when none was issued
+func (i *Invoice) GetByReservation(ctx context.Context, reservationID int) (Invoice, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + invoiceColumns + ` from invoices where reservation_id = $1`
+	return scanInvoice(DB.QueryRowContext(ctx, query, reservationID))
+}
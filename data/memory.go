@@ -0,0 +1,1667 @@
+package data
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryDB holds the tables of the in-memory models.
+//
+// Transactions are serialised by txMu, which writes outside a transaction take as well. A transaction keeps
+// a copy of the tables and puts it back when it fails, so it is undone the way postgres would undo it
+type memoryDB struct {
+	txMu sync.Mutex
+	mu   sync.Mutex
+	memoryTables
+}
+
+// memoryTables are the rows of every table, and the last id of each like a serial column
+type memoryTables struct {
+	rooms        []Room
+	reservations []Reservation
+	guests       []Guest
+	guestEmails  map[string]int // the emails of merged guests, to the guest they were merged into
+	restrictions []Restriction
+	users        []User
+	outbox       []OutboxMessage
+	mails        []ReservationMail
+	auditLog     []AuditEntry
+	apiKeys      []APIKey
+	icalImports  []ICalImport
+	syncLogs     []ICalSyncLog
+	webhooks     []Webhook
+	deliveries   []WebhookDelivery
+	invoices     []Invoice
+	lastIDs      map[string]int
+}
+
+// clone copies the tables; the rows themselves are values, so the copy does not change with the tables
+func (t memoryTables) clone() memoryTables {
+	c := memoryTables{
+		rooms:        append([]Room(nil), t.rooms...),
+		reservations: append([]Reservation(nil), t.reservations...),
+		guests:       append([]Guest(nil), t.guests...),
+		guestEmails:  make(map[string]int),
+		restrictions: append([]Restriction(nil), t.restrictions...),
+		users:        append([]User(nil), t.users...),
+		outbox:       append([]OutboxMessage(nil), t.outbox...),
+		mails:        append([]ReservationMail(nil), t.mails...),
+		auditLog:     append([]AuditEntry(nil), t.auditLog...),
+		apiKeys:      append([]APIKey(nil), t.apiKeys...),
+		icalImports:  append([]ICalImport(nil), t.icalImports...),
+		syncLogs:     append([]ICalSyncLog(nil), t.syncLogs...),
+		webhooks:     append([]Webhook(nil), t.webhooks...),
+		deliveries:   append([]WebhookDelivery(nil), t.deliveries...),
+		invoices:     append([]Invoice(nil), t.invoices...),
+		lastIDs:      make(map[string]int),
+	}
+	for email, id := range t.guestEmails {
+		c.guestEmails[email] = id
+	}
+	for table, id := range t.lastIDs {
+		c.lastIDs[table] = id
+	}
+	return c
+}
+
+// NewMemory returns models that keep everything in memory, for tests and demos. Every call starts with empty
+// tables of its own
+func NewMemory() Models {
+	memory := &memoryDB{memoryTables: memoryTables{guestEmails: make(map[string]int), lastIDs: make(map[string]int)}}
+
+	return Models{
+		Rooms:            &memoryRooms{memory},
+		Users:            &memoryUsers{memory},
+		Reservations:     &memoryReservations{memory},
+		Guests:           &memoryGuests{memory},
+		Restrictions:     &memoryRestrictions{memory},
+		Audit:            &memoryAudit{memory},
+		APIKeys:          &memoryAPIKeys{memory},
+		ICalImports:      &memoryICalImports{memory},
+		ICalSyncLogs:     &memoryICalSyncLogs{memory},
+		Webhooks:         &memoryWebhooks{memory},
+		Deliveries:       &memoryDeliveries{memory},
+		Outbox:           &memoryOutbox{memory},
+		ReservationMails: &memoryReservationMails{memory},
+		Invoices:         &memoryInvoices{memory},
+		memory:           memory,
+	}
+}
+
+// nextID returns the next id of table, like a serial column
+func (m *memoryDB) nextID(table string) int {
+	m.lastIDs[table]++
+	return m.lastIDs[table]
+}
+
+// locked runs fn with the tables locked. The Tx methods write with it too, their transaction holds txMu
+func (m *memoryDB) locked(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fn()
+}
+
+// write runs fn with the tables locked, after any transaction in progress
+func (m *memoryDB) write(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fn()
+}
+
+// transaction runs fn and restores the tables when it fails. Like with postgres, fn writes with the Tx methods;
+// the others wait for the transaction to end
+func (m *memoryDB) transaction(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	m.mu.Lock()
+	saved := m.memoryTables.clone()
+	m.mu.Unlock()
+
+	err := fn(&Tx{})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		m.mu.Lock()
+		m.memoryTables = saved
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// overlaps is the overlap test of the availability queries: the stays share at least one night
+func overlaps(start, end time.Time, rest Restriction) bool {
+	return start.Before(rest.EndDate) && end.After(rest.StartDate)
+}
+
+///-----------------Rooms-----------------///
+
+type memoryRooms struct {
+	db *memoryDB
+}
+
+func (r *memoryRooms) Create(ctx context.Context, room Room) (int, error) {
+	token, err := randomHex(16)
+	if err != nil {
+		return 0, err
+	}
+	err = r.db.write(ctx, func() error {
+		room.ID = r.db.nextID("rooms")
+		room.Name = strings.ToLower(room.Name)
+		room.ICalToken = token
+		room.CreatedAt = time.Now()
+		room.UpdatedAt = time.Now()
+		r.db.rooms = append(r.db.rooms, room)
+		return nil
+	})
+	return room.ID, err
+}
+
+func (r *memoryRooms) GetAll(ctx context.Context) ([]Room, error) {
+	var rooms []Room
+	err := r.db.locked(ctx, func() error {
+		rooms = append(rooms, r.db.rooms...)
+		return nil
+	})
+	sort.SliceStable(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms, err
+}
+
+// find returns the index of the first room match accepts, -1 when there is none
+func (r *memoryRooms) find(match func(Room) bool) int {
+	for i, room := range r.db.rooms {
+		if match(room) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *memoryRooms) get(ctx context.Context, match func(Room) bool) (Room, error) {
+	var room Room
+	err := r.db.locked(ctx, func() error {
+		i := r.find(match)
+		if i < 0 {
+			return sql.ErrNoRows
+		}
+		room = r.db.rooms[i]
+		return nil
+	})
+	return room, err
+}
+
+func (r *memoryRooms) GetById(ctx context.Context, id int) (Room, error) {
+	return r.get(ctx, func(room Room) bool { return room.ID == id })
+}
+
+func (r *memoryRooms) GetByName(ctx context.Context, name string) (Room, error) {
+	name = strings.ToLower(name)
+	return r.get(ctx, func(room Room) bool { return room.Name == name })
+}
+
+func (r *memoryRooms) GetByICalToken(ctx context.Context, token string) (Room, error) {
+	return r.get(ctx, func(room Room) bool { return room.ICalToken == token })
+}
+
+func (r *memoryRooms) RegenerateICalToken(ctx context.Context, id int) (string, error) {
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	err = r.db.write(ctx, func() error {
+		if i := r.find(func(room Room) bool { return room.ID == id }); i >= 0 {
+			r.db.rooms[i].ICalToken = token
+			r.db.rooms[i].UpdatedAt = time.Now()
+		}
+		return nil
+	})
+	return token, err
+}
+
+func (r *memoryRooms) UpdateNightlyRate(ctx context.Context, id, rate int) error {
+	return r.db.write(ctx, func() error {
+		if i := r.find(func(room Room) bool { return room.ID == id }); i >= 0 {
+			r.db.rooms[i].NightlyRate = rate
+			r.db.rooms[i].UpdatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+// booked reports whether a restriction blocks the room for any night from start to end
+func (r *memoryRooms) booked(roomID int, start, end time.Time) bool {
+	for _, rest := range r.db.restrictions {
+		if rest.RoomID == roomID && overlaps(start, end, rest) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryRooms) IsAvailable(ctx context.Context, roomID int, start, end time.Time) (bool, error) {
+	var available bool
+	err := r.db.locked(ctx, func() error {
+		available = !r.booked(roomID, start, end)
+		return nil
+	})
+	return available, err
+}
+
+// IsAvailableTx needs no lock of its own: the transaction holds txMu, which every other write waits for
+func (r *memoryRooms) IsAvailableTx(ctx context.Context, tx *Tx, roomID int, start, end time.Time) (bool, error) {
+	return r.IsAvailable(ctx, roomID, start, end)
+}
+
+func (r *memoryRooms) GetAnyAvailable(ctx context.Context, start, end time.Time) ([]Room, error) {
+	var rooms []Room
+	err := r.db.locked(ctx, func() error {
+		for _, room := range r.db.rooms {
+			if !r.booked(room.ID, start, end) {
+				rooms = append(rooms, Room{ID: room.ID, Name: room.Name, NightlyRate: room.NightlyRate})
+			}
+		}
+		return nil
+	})
+	return rooms, err
+}
+
+///-----------------Reservations-----------------///
+
+type memoryReservations struct {
+	db *memoryDB
+}
+
+func (r *memoryReservations) Create(ctx context.Context, res Reservation) (int, error) {
+	var id int
+	err := r.db.write(ctx, func() error {
+		var err error
+		id, err = r.create(ctx, res)
+		return err
+	})
+	return id, err
+}
+
+func (r *memoryReservations) CreateTx(ctx context.Context, tx *Tx, res Reservation) (int, error) {
+	var id int
+	err := r.db.locked(ctx, func() error {
+		var err error
+		id, err = r.create(ctx, res)
+		return err
+	})
+	return id, err
+}
+
+func (r *memoryReservations) create(ctx context.Context, res Reservation) (int, error) {
+	res.FirstName = strings.ToLower(res.FirstName)
+	res.LastName = strings.ToLower(res.LastName)
+	res.Email = strings.ToLower(res.Email)
+
+	if res.Code == "" {
+		code, err := NewConfirmationCode()
+		if err != nil {
+			return 0, err
+		}
+		res.Code = code
+	}
+
+	// the unique constraint of the table
+	for _, existing := range r.db.reservations {
+		if existing.Code == res.Code {
+			return 0, fmt.Errorf("data: duplicate reservation code %s", res.Code)
+		}
+	}
+
+	res.GuestID = r.db.matchGuest(res)
+	res.ID = r.db.nextID("reservations")
+	res.Processed = 0
+	res.Room = Room{}
+	res.CreatedAt = time.Now()
+	res.UpdatedAt = time.Now()
+	r.db.reservations = append(r.db.reservations, res)
+
+	if actor := ActorFrom(ctx); actor.Type == ActorGuest && actor.ID == 0 {
+		ctx = WithActor(ctx, Actor{Type: ActorGuest, ID: res.GuestID})
+	}
+	r.db.audit(ctx, AuditCreate, res.Table(), res.ID, res.ID, nil, reservationFields(res))
+	return res.ID, nil
+}
+
+// withRoom is res as the queries return it, with the id and name of its room
+func (r *memoryReservations) withRoom(res Reservation) Reservation {
+	for _, room := range r.db.rooms {
+		if room.ID == res.RoomID {
+			res.Room = Room{ID: room.ID, Name: room.Name}
+		}
+	}
+	return res
+}
+
+func (r *memoryReservations) list(ctx context.Context, match func(Reservation) bool) ([]Reservation, error) {
+	var reservations []Reservation
+	err := r.db.locked(ctx, func() error {
+		for _, res := range r.db.reservations {
+			if match(res) {
+				reservations = append(reservations, r.withRoom(res))
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(reservations, func(i, j int) bool {
+		return reservations[i].StartDate.Before(reservations[j].StartDate)
+	})
+	return reservations, err
+}
+
+func (r *memoryReservations) get(ctx context.Context, match func(Reservation) bool) (Reservation, error) {
+	reservations, err := r.list(ctx, match)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if len(reservations) == 0 {
+		return Reservation{}, sql.ErrNoRows
+	}
+	return reservations[0], nil
+}
+
+func (r *memoryReservations) GetAll(ctx context.Context) ([]Reservation, error) {
+	return r.list(ctx, func(Reservation) bool { return true })
+}
+
+func (r *memoryReservations) GetByID(ctx context.Context, id int) (Reservation, error) {
+	return r.get(ctx, func(res Reservation) bool { return res.ID == id })
+}
+
+func (r *memoryReservations) GetByCode(ctx context.Context, code string) (Reservation, error) {
+	code = strings.ToUpper(code)
+	return r.get(ctx, func(res Reservation) bool { return res.Code == code })
+}
+
+func (r *memoryReservations) GetForGuest(ctx context.Context, guestID int) ([]Reservation, error) {
+	reservations, err := r.list(ctx, func(res Reservation) bool { return res.GuestID == guestID })
+	// latest arrival first
+	for i, j := 0, len(reservations)-1; i < j; i, j = i+1, j-1 {
+		reservations[i], reservations[j] = reservations[j], reservations[i]
+	}
+	return reservations, err
+}
+
+func (r *memoryReservations) List(ctx context.Context, q ReservationQuery) (ReservationPage, error) {
+	l, err := q.listing()
+	if err != nil {
+		return ReservationPage{}, err
+	}
+	matching, err := r.list(ctx, l.matches)
+	if err != nil {
+		return ReservationPage{}, err
+	}
+
+	var rows []Reservation
+	for _, res := range matching {
+		if l.afterCursor(res) {
+			rows = append(rows, res)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return l.order(rows[i], l.sort.key(rows[j]), rows[j].ID) < 0
+	})
+	if len(rows) > l.Limit+1 {
+		rows = rows[:l.Limit+1]
+	}
+	return l.page(rows, len(matching)), nil
+}
+
+// Search matches the reservations like postgres does, misspelt text included
+func (r *memoryReservations) Search(ctx context.Context, text string, limit int) ([]GuestMatch, error) {
+	s, ok := newGuestSearch(text, limit)
+	if !ok {
+		return nil, nil
+	}
+	reservations, err := r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.rank(reservations), nil
+}
+
+func (r *memoryReservations) Update(ctx context.Context, res Reservation) error {
+	return r.db.write(ctx, func() error { return r.update(ctx, res) })
+}
+
+func (r *memoryReservations) UpdateTx(ctx context.Context, tx *Tx, res Reservation) error {
+	return r.db.locked(ctx, func() error { return r.update(ctx, res) })
+}
+
+func (r *memoryReservations) update(ctx context.Context, res Reservation) error {
+	for i := range r.db.reservations {
+		if r.db.reservations[i].ID == res.ID {
+			stored := &r.db.reservations[i]
+			before := *stored
+			stored.FirstName = res.FirstName
+			stored.LastName = res.LastName
+			stored.Email = res.Email
+			stored.Phone = res.Phone
+			stored.GuestID = r.db.matchGuest(res)
+			stored.UpdatedAt = time.Now()
+			r.db.audit(ctx, AuditUpdate, res.Table(), res.ID, res.ID, reservationFields(before), reservationFields(*stored))
+		}
+	}
+	return nil
+}
+
+func (r *memoryReservations) UpdateProcessedStatus(ctx context.Context, processed, id int) error {
+	return r.db.write(ctx, func() error {
+		for i := range r.db.reservations {
+			if r.db.reservations[i].ID == id {
+				before := r.db.reservations[i]
+				r.db.reservations[i].Processed = processed
+				r.db.audit(ctx, AuditUpdate, before.Table(), id, id, reservationFields(before),
+					reservationFields(r.db.reservations[i]))
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryReservations) Delete(ctx context.Context, id int) error {
+	return r.db.write(ctx, func() error { return r.delete(ctx, id) })
+}
+
+func (r *memoryReservations) DeleteTx(ctx context.Context, tx *Tx, id int) error {
+	return r.db.locked(ctx, func() error { return r.delete(ctx, id) })
+}
+
+// delete removes the reservation and, like the foreign key, the restriction that blocks its room
+func (r *memoryReservations) delete(ctx context.Context, id int) error {
+	reservations := r.db.reservations[:0:0]
+	for _, res := range r.db.reservations {
+		if res.ID != id {
+			reservations = append(reservations, res)
+		} else {
+			r.db.audit(ctx, AuditDelete, res.Table(), id, id, reservationFields(res), nil)
+		}
+	}
+	r.db.reservations = reservations
+
+	restrictions := r.db.restrictions[:0:0]
+	for _, rest := range r.db.restrictions {
+		if rest.ReservationID != id {
+			restrictions = append(restrictions, rest)
+		}
+	}
+	r.db.restrictions = restrictions
+
+	mails := r.db.mails[:0:0]
+	for _, mail := range r.db.mails {
+		if mail.ReservationID != id {
+			mails = append(mails, mail)
+		}
+	}
+	r.db.mails = mails
+
+	// the invoice is kept, no longer pointing at the reservation
+	for i := range r.db.invoices {
+		if r.db.invoices[i].ReservationID == id {
+			r.db.invoices[i].ReservationID = 0
+		}
+	}
+	return nil
+}
+
+///-----------------Guests-----------------///
+
+type memoryGuests struct {
+	db *memoryDB
+}
+
+// matchGuest returns the id of the guest with the email of res, adding them when the email is new, like the
+// upsert of the sql models. It runs with the tables locked
+func (m *memoryDB) matchGuest(res Reservation) int {
+	email := strings.ToLower(res.Email)
+	merged, ok := m.guestEmails[email]
+	for i := range m.guests {
+		if g := &m.guests[i]; g.Email == email || (ok && g.ID == merged) {
+			g.FirstName = strings.ToLower(res.FirstName)
+			g.LastName = strings.ToLower(res.LastName)
+			g.Phone = res.Phone
+			g.UpdatedAt = time.Now()
+			return g.ID
+		}
+	}
+	g := Guest{
+		ID:        m.nextID("guests"),
+		FirstName: strings.ToLower(res.FirstName),
+		LastName:  strings.ToLower(res.LastName),
+		Email:     email,
+		Phone:     res.Phone,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	m.guests = append(m.guests, g)
+	return g.ID
+}
+
+func (g *memoryGuests) GetByID(ctx context.Context, id int) (Guest, error) {
+	return g.get(ctx, func(guest Guest) bool { return guest.ID == id })
+}
+
+func (g *memoryGuests) GetByEmail(ctx context.Context, email string) (Guest, error) {
+	email = strings.ToLower(email)
+	return g.get(ctx, func(guest Guest) bool {
+		merged, ok := g.db.guestEmails[email]
+		return guest.Email == email || (ok && guest.ID == merged)
+	})
+}
+
+func (g *memoryGuests) get(ctx context.Context, match func(Guest) bool) (Guest, error) {
+	guests, err := g.list(ctx, match)
+	if err != nil {
+		return Guest{}, err
+	}
+	if len(guests) == 0 {
+		return Guest{}, sql.ErrNoRows
+	}
+	return guests[0], nil
+}
+
+func (g *memoryGuests) Duplicates(ctx context.Context, guest Guest) ([]Guest, error) {
+	first, last := strings.ToLower(guest.FirstName), strings.ToLower(guest.LastName)
+	return g.list(ctx, func(other Guest) bool {
+		return other.ID != guest.ID && (other.Phone == guest.Phone || (other.FirstName == first && other.LastName == last))
+	})
+}
+
+func (g *memoryGuests) list(ctx context.Context, match func(Guest) bool) ([]Guest, error) {
+	var guests []Guest
+	err := g.db.locked(ctx, func() error {
+		for _, guest := range g.db.guests {
+			if match(guest) {
+				guests = append(guests, guest)
+			}
+		}
+		return nil
+	})
+	return guests, err
+}
+
+func (g *memoryGuests) Merge(ctx context.Context, keepID, mergeID int) error {
+	if keepID == mergeID {
+		return ErrSameGuest
+	}
+	return g.db.write(ctx, func() error {
+		found := 0
+		var email string
+		guests := g.db.guests[:0:0]
+		for _, guest := range g.db.guests {
+			if guest.ID == keepID || guest.ID == mergeID {
+				found++
+			}
+			if guest.ID != mergeID {
+				guests = append(guests, guest)
+			} else {
+				email = guest.Email
+			}
+		}
+		if found != 2 {
+			return sql.ErrNoRows
+		}
+
+		for merged, id := range g.db.guestEmails {
+			if id == mergeID {
+				g.db.guestEmails[merged] = keepID
+			}
+		}
+		g.db.guestEmails[email] = keepID
+
+		for i := range g.db.reservations {
+			if res := &g.db.reservations[i]; res.GuestID == mergeID {
+				res.GuestID = keepID
+				g.db.audit(ctx, AuditUpdate, res.Table(), res.ID, res.ID,
+					map[string]any{"guest_id": mergeID}, map[string]any{"guest_id": keepID})
+			}
+		}
+		g.db.guests = guests
+		g.db.audit(ctx, AuditMerge, "guests", mergeID, 0, nil, map[string]any{"merged_into": keepID})
+		return nil
+	})
+}
+
+///-----------------Restrictions-----------------///
+
+type memoryRestrictions struct {
+	db *memoryDB
+}
+
+func (r *memoryRestrictions) Create(ctx context.Context, restrict Restriction) (int, error) {
+	var id int
+	err := r.db.write(ctx, func() error {
+		var err error
+		id, err = r.create(ctx, restrict)
+		return err
+	})
+	return id, err
+}
+
+func (r *memoryRestrictions) CreateTx(ctx context.Context, tx *Tx, restrict Restriction) (int, error) {
+	var id int
+	err := r.db.locked(ctx, func() error {
+		var err error
+		id, err = r.create(ctx, restrict)
+		return err
+	})
+	return id, err
+}
+
+func (r *memoryRestrictions) create(ctx context.Context, restrict Restriction) (int, error) {
+	if restrict.Type == "" {
+		restrict.Type = RestrictionOwner
+		if restrict.ReservationID > 0 {
+			restrict.Type = RestrictionReservation
+		}
+	}
+	if restrict.ICalImportID > 0 && restrict.ExternalUID != "" {
+		for _, existing := range r.db.restrictions {
+			if existing.ICalImportID == restrict.ICalImportID && existing.ExternalUID == restrict.ExternalUID {
+				return 0, fmt.Errorf("data: duplicate restriction %s of calendar import %d", restrict.ExternalUID, restrict.ICalImportID)
+			}
+		}
+	}
+
+	restrict.ID = r.db.nextID("restrictions")
+	restrict.Room = Room{}
+	restrict.Reservation = Reservation{}
+	restrict.CreatedAt = time.Now()
+	restrict.UpdatedAt = time.Now()
+	r.db.restrictions = append(r.db.restrictions, restrict)
+	r.db.audit(ctx, AuditCreate, restrict.Table(), restrict.ID, restrict.ReservationID, nil, restrictionFields(restrict))
+	return restrict.ID, nil
+}
+
+func (r *memoryRestrictions) list(ctx context.Context, match func(Restriction) bool) ([]Restriction, error) {
+	var restrictions []Restriction
+	err := r.db.locked(ctx, func() error {
+		for _, rest := range r.db.restrictions {
+			if match(rest) {
+				restrictions = append(restrictions, rest)
+			}
+		}
+		return nil
+	})
+	return restrictions, err
+}
+
+// GetForRoom returns the restrictions of the room from start up to and including end, like the query does
+func (r *memoryRestrictions) GetForRoom(ctx context.Context, start, end time.Time, roomID int) ([]Restriction, error) {
+	return r.list(ctx, func(rest Restriction) bool {
+		return rest.RoomID == roomID && start.Before(rest.EndDate) && !end.Before(rest.StartDate)
+	})
+}
+
+func (r *memoryRestrictions) GetAllForRoom(ctx context.Context, roomID int) ([]Restriction, error) {
+	restrictions, err := r.list(ctx, func(rest Restriction) bool { return rest.RoomID == roomID })
+	sort.SliceStable(restrictions, func(i, j int) bool {
+		return restrictions[i].StartDate.Before(restrictions[j].StartDate)
+	})
+	return restrictions, err
+}
+
+func (r *memoryRestrictions) GetForImport(ctx context.Context, importID int) ([]Restriction, error) {
+	return r.list(ctx, func(rest Restriction) bool { return rest.ICalImportID == importID })
+}
+
+func (r *memoryRestrictions) UpdateDates(ctx context.Context, id int, start, end time.Time) error {
+	return r.db.write(ctx, func() error {
+		r.updateDates(ctx, id, start, end)
+		return nil
+	})
+}
+
+func (r *memoryRestrictions) UpdateDatesTx(ctx context.Context, tx *Tx, id int, start, end time.Time) error {
+	return r.db.locked(ctx, func() error {
+		r.updateDates(ctx, id, start, end)
+		return nil
+	})
+}
+
+func (r *memoryRestrictions) updateDates(ctx context.Context, id int, start, end time.Time) {
+	for i := range r.db.restrictions {
+		if rest := &r.db.restrictions[i]; rest.ID == id {
+			before := *rest
+			rest.StartDate = start
+			rest.EndDate = end
+			rest.UpdatedAt = time.Now()
+			r.db.audit(ctx, AuditUpdate, rest.Table(), id, rest.ReservationID, restrictionFields(before),
+				restrictionFields(*rest))
+		}
+	}
+}
+
+func (r *memoryRestrictions) Delete(ctx context.Context, id int) error {
+	return r.db.write(ctx, func() error {
+		r.delete(ctx, id)
+		return nil
+	})
+}
+
+func (r *memoryRestrictions) DeleteTx(ctx context.Context, tx *Tx, id int) error {
+	return r.db.locked(ctx, func() error {
+		r.delete(ctx, id)
+		return nil
+	})
+}
+
+func (r *memoryRestrictions) delete(ctx context.Context, id int) {
+	restrictions := r.db.restrictions[:0:0]
+	for _, rest := range r.db.restrictions {
+		if rest.ID != id {
+			restrictions = append(restrictions, rest)
+		} else {
+			r.db.audit(ctx, AuditDelete, rest.Table(), id, rest.ReservationID, restrictionFields(rest), nil)
+		}
+	}
+	r.db.restrictions = restrictions
+}
+
+///-----------------Users-----------------///
+
+type memoryUsers struct {
+	db *memoryDB
+}
+
+func (u *memoryUsers) Insert(ctx context.Context, user User) (int, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+	if err != nil {
+		return 0, err
+	}
+	err = u.db.write(ctx, func() error {
+		user.ID = u.db.nextID("users")
+		user.Email = strings.ToLower(user.Email)
+		user.Password = string(hash)
+		user.CreatedAt = time.Now()
+		user.UpdatedAt = time.Now()
+		u.db.users = append(u.db.users, user)
+		u.db.audit(ctx, AuditCreate, user.Table(), user.ID, 0, nil, userFields(user))
+		return nil
+	})
+	return user.ID, err
+}
+
+func (u *memoryUsers) InsertAndReturnId(ctx context.Context, user User) (int, error) {
+	return u.Insert(ctx, user)
+}
+
+func (u *memoryUsers) SelectAll(ctx context.Context) ([]User, error) {
+	var users []User
+	err := u.db.locked(ctx, func() error {
+		users = append(users, u.db.users...)
+		return nil
+	})
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].LastName != users[j].LastName {
+			return users[i].LastName < users[j].LastName
+		}
+		return users[i].FirstName < users[j].FirstName
+	})
+	return users, err
+}
+
+func (u *memoryUsers) Count(ctx context.Context) (int, error) {
+	var count int
+	err := u.db.locked(ctx, func() error {
+		count = len(u.db.users)
+		return nil
+	})
+	return count, err
+}
+
+func (u *memoryUsers) get(ctx context.Context, match func(User) bool) (User, error) {
+	var user User
+	err := u.db.locked(ctx, func() error {
+		for _, candidate := range u.db.users {
+			if match(candidate) {
+				user = candidate
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	return user, err
+}
+
+func (u *memoryUsers) GetByID(ctx context.Context, id int) (User, error) {
+	return u.get(ctx, func(user User) bool { return user.ID == id })
+}
+
+func (u *memoryUsers) GetByEmail(ctx context.Context, email string) (User, error) {
+	email = strings.ToLower(email)
+	return u.get(ctx, func(user User) bool { return user.Email == email })
+}
+
+func (u *memoryUsers) Update(ctx context.Context, user User) error {
+	return u.db.write(ctx, func() error {
+		for i := range u.db.users {
+			if u.db.users[i].ID == user.ID {
+				stored := &u.db.users[i]
+				before := *stored
+				stored.FirstName = user.FirstName
+				stored.LastName = user.LastName
+				stored.Email = user.Email
+				stored.AccessLevel = user.AccessLevel
+				stored.UpdatedAt = time.Now()
+				u.db.audit(ctx, AuditUpdate, user.Table(), user.ID, 0, userFields(before), userFields(*stored))
+			}
+		}
+		return nil
+	})
+}
+
+func (u *memoryUsers) Authenticate(ctx context.Context, email, password string) (int, string, error) {
+	user, err := u.GetByEmail(ctx, email)
+	if err != nil {
+		return 0, "", err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password")
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return user.ID, user.Password, nil
+}
+
+func (u *memoryUsers) UpdatePassword(ctx context.Context, user User, newHash []byte) error {
+	return u.db.write(ctx, func() error {
+		for i := range u.db.users {
+			if u.db.users[i].ID == user.ID {
+				u.db.users[i].Password = string(newHash)
+				u.db.audit(ctx, AuditUpdate, user.Table(), user.ID, 0, nil, map[string]any{"password": passwordChanged})
+			}
+		}
+		return nil
+	})
+}
+
+func (u *memoryUsers) Delete(ctx context.Context, id int) error {
+	return u.db.write(ctx, func() error {
+		users := u.db.users[:0:0]
+		for _, user := range u.db.users {
+			if user.ID != id {
+				users = append(users, user)
+			} else {
+				u.db.audit(ctx, AuditDelete, user.Table(), id, 0, userFields(user), nil)
+			}
+		}
+		u.db.users = users
+
+		keys := u.db.apiKeys[:0:0]
+		for _, key := range u.db.apiKeys {
+			if key.UserID != id {
+				keys = append(keys, key)
+			}
+		}
+		u.db.apiKeys = keys
+		return nil
+	})
+}
+
+///-----------------Audit Log-----------------///
+
+type memoryAudit struct {
+	db *memoryDB
+}
+
+// audit adds a change to the audit log, see newAuditEntry. It runs with the tables locked. The changes go
+// through json like they do in the sql column, so both read back the same
+func (m *memoryDB) audit(ctx context.Context, action, entity string, id, reservationID int, before, after map[string]any) {
+	entry, ok := newAuditEntry(ctx, action, entity, id, reservationID, before, after)
+	if !ok {
+		return
+	}
+	encoded, _ := json.Marshal(entry.Changes)
+	entry.Changes, _ = decodeChanges(string(encoded))
+	entry.ID = m.nextID("audit_log")
+	m.auditLog = append(m.auditLog, entry)
+}
+
+func (a *memoryAudit) GetForReservation(ctx context.Context, reservationID int) ([]AuditEntry, error) {
+	return a.list(ctx, func(entry AuditEntry) bool { return entry.ReservationID == reservationID })
+}
+
+func (a *memoryAudit) GetForEntity(ctx context.Context, entity string, id int) ([]AuditEntry, error) {
+	return a.list(ctx, func(entry AuditEntry) bool { return entry.Entity == entity && entry.EntityID == id })
+}
+
+// list returns the matching entries the latest first, with the name of the actor like the join of the query
+func (a *memoryAudit) list(ctx context.Context, match func(AuditEntry) bool) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := a.db.locked(ctx, func() error {
+		for i := len(a.db.auditLog) - 1; i >= 0; i-- {
+			entry := a.db.auditLog[i]
+			if !match(entry) {
+				continue
+			}
+			switch entry.Actor.Type {
+			case ActorUser:
+				for _, user := range a.db.users {
+					if user.ID == entry.Actor.ID {
+						entry.ActorName = user.FirstName + " " + user.LastName
+					}
+				}
+			case ActorGuest:
+				for _, guest := range a.db.guests {
+					if guest.ID == entry.Actor.ID {
+						entry.ActorName = guest.Email
+					}
+				}
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+///-----------------Mail Outbox-----------------///
+
+type memoryOutbox struct {
+	db *memoryDB
+}
+
+func (o *memoryOutbox) Insert(ctx context.Context, msg OutboxMessage) (int, error) {
+	var id int
+	err := o.db.write(ctx, func() error {
+		id = o.insert(msg)
+		return nil
+	})
+	return id, err
+}
+
+func (o *memoryOutbox) InsertTx(ctx context.Context, tx *Tx, msg OutboxMessage) (int, error) {
+	var id int
+	err := o.db.locked(ctx, func() error {
+		id = o.insert(msg)
+		return nil
+	})
+	return id, err
+}
+
+func (o *memoryOutbox) insert(msg OutboxMessage) int {
+	if msg.Data == "" {
+		msg.Data = "{}"
+	}
+	if msg.Attachments == nil {
+		msg.Attachments = []Attachment{}
+	}
+	msg.ID = o.db.nextID("mail_outbox")
+	msg.Status = OutboxPending
+	msg.Attempts = 0
+	msg.LastError = ""
+	msg.SentAt = sql.NullTime{}
+	msg.NextAttemptAt = time.Now()
+	msg.CreatedAt = time.Now()
+	msg.UpdatedAt = time.Now()
+	o.db.outbox = append(o.db.outbox, msg)
+	return msg.ID
+}
+
+func (o *memoryOutbox) GetDue(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := o.db.locked(ctx, func() error {
+		now := time.Now()
+		for _, msg := range o.db.outbox {
+			if msg.Status == OutboxPending && !msg.NextAttemptAt.After(now) {
+				messages = append(messages, msg)
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].NextAttemptAt.Before(messages[j].NextAttemptAt) })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, err
+}
+
+func (o *memoryOutbox) GetRecent(ctx context.Context, status string, limit int) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := o.db.locked(ctx, func() error {
+		for i := len(o.db.outbox) - 1; i >= 0 && len(messages) < limit; i-- {
+			if status == "" || o.db.outbox[i].Status == status {
+				messages = append(messages, o.db.outbox[i])
+			}
+		}
+		return nil
+	})
+	return messages, err
+}
+
+func (o *memoryOutbox) CountByStatus(ctx context.Context) (map[string]int, error) {
+	counts := map[string]int{OutboxPending: 0, OutboxSent: 0, OutboxDead: 0}
+	err := o.db.locked(ctx, func() error {
+		for _, msg := range o.db.outbox {
+			counts[msg.Status]++
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// update changes the message id with fn
+func (o *memoryOutbox) update(ctx context.Context, id int, fn func(msg *OutboxMessage)) error {
+	return o.db.write(ctx, func() error {
+		for i := range o.db.outbox {
+			if o.db.outbox[i].ID == id {
+				fn(&o.db.outbox[i])
+				o.db.outbox[i].UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+}
+
+func (o *memoryOutbox) MarkSent(ctx context.Context, id, attempts int) error {
+	return o.update(ctx, id, func(msg *OutboxMessage) {
+		msg.Status = OutboxSent
+		msg.Attempts = attempts
+		msg.LastError = ""
+		msg.SentAt = sql.NullTime{Time: time.Now(), Valid: true}
+	})
+}
+
+func (o *memoryOutbox) MarkAttemptFailed(ctx context.Context, id, attempts int, lastError string, next time.Time) error {
+	return o.update(ctx, id, func(msg *OutboxMessage) {
+		msg.Status = OutboxPending
+		if next.IsZero() {
+			msg.Status = OutboxDead
+			next = time.Now()
+		}
+		msg.Attempts = attempts
+		msg.LastError = lastError
+		msg.NextAttemptAt = next
+	})
+}
+
+func (o *memoryOutbox) Requeue(ctx context.Context, id int) error {
+	return o.update(ctx, id, func(msg *OutboxMessage) {
+		if msg.Status == OutboxDead {
+			msg.Status = OutboxPending
+			msg.Attempts = 0
+			msg.NextAttemptAt = time.Now()
+		}
+	})
+}
+
+///-----------------Scheduled Mail-----------------///
+
+type memoryReservationMails struct {
+	db *memoryDB
+}
+
+func (m *memoryReservationMails) RecordTx(ctx context.Context, tx *Tx, reservationID int, kind string) (bool, error) {
+	var recorded bool
+	err := m.db.locked(ctx, func() error {
+		if m.sent(reservationID, kind) {
+			return nil
+		}
+		m.db.mails = append(m.db.mails, ReservationMail{
+			ID:            m.db.nextID("reservation_mails"),
+			ReservationID: reservationID,
+			Kind:          kind,
+			CreatedAt:     time.Now(),
+		})
+		recorded = true
+		return nil
+	})
+	return recorded, err
+}
+
+// sent reports whether the mail of kind was queued for the reservation. It runs with the tables locked
+func (m *memoryReservationMails) sent(reservationID int, kind string) bool {
+	for _, mail := range m.db.mails {
+		if mail.ReservationID == reservationID && mail.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryReservationMails) GetArriving(ctx context.Context, today time.Time, days int, kind string) ([]Reservation, error) {
+	last := today.AddDate(0, 0, days)
+	reservations := &memoryReservations{m.db}
+	return reservations.list(ctx, func(res Reservation) bool {
+		return !res.StartDate.Before(today) && !res.StartDate.After(last) &&
+			res.CreatedAt.Before(res.StartDate.AddDate(0, 0, -days)) && !m.sent(res.ID, kind)
+	})
+}
+
+func (m *memoryReservationMails) GetDeparted(ctx context.Context, today time.Time, window int, kind string) ([]Reservation, error) {
+	first := today.AddDate(0, 0, -window)
+	reservations := &memoryReservations{m.db}
+	departed, err := reservations.list(ctx, func(res Reservation) bool {
+		return !res.EndDate.After(today) && res.EndDate.After(first) && !m.sent(res.ID, kind)
+	})
+	sort.SliceStable(departed, func(i, j int) bool {
+		a, b := departed[i], departed[j]
+		return a.EndDate.Before(b.EndDate) || (a.EndDate.Equal(b.EndDate) && a.ID < b.ID)
+	})
+	return departed, err
+}
+
+///-----------------API Keys-----------------///
+
+type memoryAPIKeys struct {
+	db *memoryDB
+}
+
+func (k *memoryAPIKeys) Issue(ctx context.Context, key APIKey) (int, string, error) {
+	prefix, err := randomHex(4)
+	if err != nil {
+		return 0, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return 0, "", err
+	}
+	token := apiKeyTokenPrefix + prefix + "_" + secret
+
+	err = k.db.write(ctx, func() error {
+		key.ID = k.db.nextID("api_keys")
+		key.Prefix = prefix
+		key.Hash = hashAPIKeyToken(token)
+		key.Scopes = append([]string(nil), key.Scopes...)
+		key.LastUsedAt = sql.NullTime{}
+		key.RevokedAt = sql.NullTime{}
+		key.CreatedAt = time.Now()
+		key.UpdatedAt = time.Now()
+		key.User = User{}
+		k.db.apiKeys = append(k.db.apiKeys, key)
+		return nil
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return key.ID, token, nil
+}
+
+// withUser returns key with its owner, like the join of the queries. It runs with the tables locked
+func (k *memoryAPIKeys) withUser(key APIKey) APIKey {
+	for _, user := range k.db.users {
+		if user.ID == key.UserID {
+			key.User = User{ID: user.ID, FirstName: user.FirstName, LastName: user.LastName, Email: user.Email,
+				AccessLevel: user.AccessLevel}
+		}
+	}
+	return key
+}
+
+func (k *memoryAPIKeys) Authenticate(ctx context.Context, token string) (APIKey, error) {
+	if !strings.HasPrefix(token, apiKeyTokenPrefix) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	parts := strings.SplitN(strings.TrimPrefix(token, apiKeyTokenPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+
+	var key APIKey
+	err := k.db.locked(ctx, func() error {
+		for _, stored := range k.db.apiKeys {
+			if stored.Prefix == parts[0] {
+				key = k.withUser(stored)
+				return nil
+			}
+		}
+		return ErrInvalidAPIKey
+	})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKeyToken(token))) != 1 || key.Revoked() {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+func (k *memoryAPIKeys) GetAll(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	err := k.db.locked(ctx, func() error {
+		for i := len(k.db.apiKeys) - 1; i >= 0; i-- {
+			key := k.withUser(k.db.apiKeys[i])
+			key.Hash = ""
+			key.User.AccessLevel = 0
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// update changes the key id with fn
+func (k *memoryAPIKeys) update(ctx context.Context, id int, fn func(key *APIKey)) error {
+	return k.db.write(ctx, func() error {
+		for i := range k.db.apiKeys {
+			if k.db.apiKeys[i].ID == id {
+				fn(&k.db.apiKeys[i])
+			}
+		}
+		return nil
+	})
+}
+
+func (k *memoryAPIKeys) TouchLastUsed(ctx context.Context, id int) error {
+	return k.update(ctx, id, func(key *APIKey) {
+		key.LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	})
+}
+
+func (k *memoryAPIKeys) Revoke(ctx context.Context, id int) error {
+	return k.update(ctx, id, func(key *APIKey) {
+		if !key.Revoked() {
+			key.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			key.UpdatedAt = key.RevokedAt.Time
+		}
+	})
+}
+
+///-----------------Calendar Imports-----------------///
+
+type memoryICalImports struct {
+	db *memoryDB
+}
+
+func (i *memoryICalImports) Insert(ctx context.Context, imp ICalImport) (int, error) {
+	err := i.db.write(ctx, func() error {
+		imp.ID = i.db.nextID("ical_imports")
+		imp.LastSyncedAt = sql.NullTime{}
+		imp.LastStatus = ""
+		imp.CreatedAt = time.Now()
+		imp.UpdatedAt = time.Now()
+		imp.Room = Room{}
+		i.db.icalImports = append(i.db.icalImports, imp)
+		return nil
+	})
+	return imp.ID, err
+}
+
+// withRoom returns imp with the id and name of its room, like the join of the queries. It runs with the
+// tables locked
+func (i *memoryICalImports) withRoom(imp ICalImport) ICalImport {
+	for _, room := range i.db.rooms {
+		if room.ID == imp.RoomID {
+			imp.Room = Room{ID: room.ID, Name: room.Name}
+		}
+	}
+	return imp
+}
+
+func (i *memoryICalImports) GetAll(ctx context.Context) ([]ICalImport, error) {
+	var imports []ICalImport
+	err := i.db.locked(ctx, func() error {
+		for _, imp := range i.db.icalImports {
+			imports = append(imports, i.withRoom(imp))
+		}
+		return nil
+	})
+	sort.SliceStable(imports, func(a, b int) bool {
+		if imports[a].Room.Name != imports[b].Room.Name {
+			return imports[a].Room.Name < imports[b].Room.Name
+		}
+		return imports[a].Name < imports[b].Name
+	})
+	return imports, err
+}
+
+func (i *memoryICalImports) GetByID(ctx context.Context, id int) (ICalImport, error) {
+	var imp ICalImport
+	err := i.db.locked(ctx, func() error {
+		for _, stored := range i.db.icalImports {
+			if stored.ID == id {
+				imp = i.withRoom(stored)
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	return imp, err
+}
+
+// Delete removes the import and, like the foreign keys, its restrictions and sync log
+func (i *memoryICalImports) Delete(ctx context.Context, id int) error {
+	return i.db.write(ctx, func() error {
+		imports := i.db.icalImports[:0:0]
+		for _, imp := range i.db.icalImports {
+			if imp.ID != id {
+				imports = append(imports, imp)
+			}
+		}
+		i.db.icalImports = imports
+
+		restrictions := i.db.restrictions[:0:0]
+		for _, rest := range i.db.restrictions {
+			if rest.ICalImportID != id {
+				restrictions = append(restrictions, rest)
+			}
+		}
+		i.db.restrictions = restrictions
+
+		logs := i.db.syncLogs[:0:0]
+		for _, entry := range i.db.syncLogs {
+			if entry.ICalImportID != id {
+				logs = append(logs, entry)
+			}
+		}
+		i.db.syncLogs = logs
+		return nil
+	})
+}
+
+func (i *memoryICalImports) MarkSynced(ctx context.Context, id int, status string, at time.Time) error {
+	return i.db.write(ctx, func() error {
+		for n := range i.db.icalImports {
+			if imp := &i.db.icalImports[n]; imp.ID == id {
+				imp.LastSyncedAt = sql.NullTime{Time: at, Valid: true}
+				imp.LastStatus = status
+				imp.UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+}
+
+type memoryICalSyncLogs struct {
+	db *memoryDB
+}
+
+func (l *memoryICalSyncLogs) Insert(ctx context.Context, entry ICalSyncLog) error {
+	return l.db.write(ctx, func() error {
+		entry.ID = l.db.nextID("ical_sync_logs")
+		entry.Import = ICalImport{}
+		l.db.syncLogs = append(l.db.syncLogs, entry)
+		return nil
+	})
+}
+
+// GetRecent returns the latest limit syncs with the name of the import and its room, like the join of the query
+func (l *memoryICalSyncLogs) GetRecent(ctx context.Context, limit int) ([]ICalSyncLog, error) {
+	var logs []ICalSyncLog
+	err := l.db.locked(ctx, func() error {
+		imports := &memoryICalImports{l.db}
+		for _, entry := range l.db.syncLogs {
+			entry.Import = ICalImport{ID: entry.ICalImportID}
+			for _, imp := range l.db.icalImports {
+				if imp.ID == entry.ICalImportID {
+					imp = imports.withRoom(imp)
+					entry.Import.Name = imp.Name
+					entry.Import.Room.Name = imp.Room.Name
+				}
+			}
+			logs = append(logs, entry)
+		}
+		return nil
+	})
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].StartedAt.After(logs[j].StartedAt) })
+	if len(logs) > limit {
+		logs = logs[:limit]
+	}
+	return logs, err
+}
+
+///-----------------Webhooks-----------------///
+
+type memoryWebhooks struct {
+	db *memoryDB
+}
+
+func (wh *memoryWebhooks) Insert(ctx context.Context, hook Webhook) (int, error) {
+	secret, err := randomHex(24)
+	if err != nil {
+		return 0, err
+	}
+	err = wh.db.write(ctx, func() error {
+		hook.ID = wh.db.nextID("webhooks")
+		hook.Secret = webhookSecretPrefix + secret
+		hook.Events = append([]string(nil), hook.Events...)
+		hook.CreatedAt = time.Now()
+		hook.UpdatedAt = time.Now()
+		wh.db.webhooks = append(wh.db.webhooks, hook)
+		return nil
+	})
+	return hook.ID, err
+}
+
+func (wh *memoryWebhooks) GetAll(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	err := wh.db.locked(ctx, func() error {
+		hooks = append(hooks, wh.db.webhooks...)
+		return nil
+	})
+	return hooks, err
+}
+
+func (wh *memoryWebhooks) GetForEvent(ctx context.Context, event string) ([]Webhook, error) {
+	var hooks []Webhook
+	err := wh.db.locked(ctx, func() error {
+		for _, hook := range wh.db.webhooks {
+			if hook.Wants(event) {
+				hooks = append(hooks, hook)
+			}
+		}
+		return nil
+	})
+	return hooks, err
+}
+
+func (wh *memoryWebhooks) GetByID(ctx context.Context, id int) (Webhook, error) {
+	var hook Webhook
+	err := wh.db.locked(ctx, func() error {
+		for _, stored := range wh.db.webhooks {
+			if stored.ID == id {
+				hook = stored
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	return hook, err
+}
+
+// Delete removes the webhook and, like the foreign key, its delivery log
+func (wh *memoryWebhooks) Delete(ctx context.Context, id int) error {
+	return wh.db.write(ctx, func() error {
+		hooks := wh.db.webhooks[:0:0]
+		for _, hook := range wh.db.webhooks {
+			if hook.ID != id {
+				hooks = append(hooks, hook)
+			}
+		}
+		wh.db.webhooks = hooks
+
+		deliveries := wh.db.deliveries[:0:0]
+		for _, delivery := range wh.db.deliveries {
+			if delivery.WebhookID != id {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		wh.db.deliveries = deliveries
+		return nil
+	})
+}
+
+type memoryDeliveries struct {
+	db *memoryDB
+}
+
+func (d *memoryDeliveries) Insert(ctx context.Context, delivery WebhookDelivery) (int, error) {
+	err := d.db.write(ctx, func() error {
+		delivery.ID = d.db.nextID("webhook_deliveries")
+		delivery.Status = DeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = time.Now()
+		delivery.ResponseCode = 0
+		delivery.LastError = ""
+		delivery.DeliveredAt = sql.NullTime{}
+		delivery.CreatedAt = time.Now()
+		delivery.UpdatedAt = time.Now()
+		delivery.Webhook = Webhook{}
+		d.db.deliveries = append(d.db.deliveries, delivery)
+		return nil
+	})
+	return delivery.ID, err
+}
+
+// list returns the matching deliveries with the url and secret of their webhook, like the join of the queries
+func (d *memoryDeliveries) list(ctx context.Context, match func(WebhookDelivery) bool) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := d.db.locked(ctx, func() error {
+		for _, delivery := range d.db.deliveries {
+			if !match(delivery) {
+				continue
+			}
+			delivery.Webhook = Webhook{ID: delivery.WebhookID}
+			for _, hook := range d.db.webhooks {
+				if hook.ID == delivery.WebhookID {
+					delivery.Webhook.URL = hook.URL
+					delivery.Webhook.Secret = hook.Secret
+				}
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (d *memoryDeliveries) GetByID(ctx context.Context, id int) (WebhookDelivery, error) {
+	deliveries, err := d.list(ctx, func(delivery WebhookDelivery) bool { return delivery.ID == id })
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return WebhookDelivery{}, sql.ErrNoRows
+	}
+	return deliveries[0], nil
+}
+
+func (d *memoryDeliveries) GetDue(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	now := time.Now()
+	deliveries, err := d.list(ctx, func(delivery WebhookDelivery) bool {
+		return delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now)
+	})
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, err
+}
+
+func (d *memoryDeliveries) GetRecent(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	deliveries, err := d.list(ctx, func(WebhookDelivery) bool { return true })
+	// latest first
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, err
+}
+
+// update changes the delivery id with fn
+func (d *memoryDeliveries) update(ctx context.Context, id int, fn func(delivery *WebhookDelivery)) error {
+	return d.db.write(ctx, func() error {
+		for i := range d.db.deliveries {
+			if d.db.deliveries[i].ID == id {
+				fn(&d.db.deliveries[i])
+				d.db.deliveries[i].UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+}
+
+func (d *memoryDeliveries) MarkDelivered(ctx context.Context, id, attempts, responseCode int) error {
+	return d.update(ctx, id, func(delivery *WebhookDelivery) {
+		delivery.Status = DeliveryDelivered
+		delivery.Attempts = attempts
+		delivery.ResponseCode = responseCode
+		delivery.LastError = ""
+		delivery.DeliveredAt = sql.NullTime{Time: time.Now(), Valid: true}
+	})
+}
+
+func (d *memoryDeliveries) MarkAttemptFailed(ctx context.Context, id, attempts, responseCode int, lastError string, next time.Time) error {
+	return d.update(ctx, id, func(delivery *WebhookDelivery) {
+		delivery.Status = DeliveryPending
+		if next.IsZero() {
+			delivery.Status = DeliveryFailed
+			next = time.Now()
+		}
+		delivery.Attempts = attempts
+		delivery.ResponseCode = responseCode
+		delivery.LastError = lastError
+		delivery.NextAttemptAt = next
+	})
+}
+
+///-----------------Invoices-----------------///
+
+type memoryInvoices struct {
+	db *memoryDB
+}
+
+// Issue numbers the invoices from their own counter, which only moves when an invoice is stored, so like the
+// invoice_sequence of postgres the numbers have no gaps
+func (i *memoryInvoices) Issue(ctx context.Context, inv Invoice) (Invoice, error) {
+	err := i.db.write(ctx, func() error {
+		for _, existing := range i.db.invoices {
+			if inv.ReservationID != 0 && existing.ReservationID == inv.ReservationID {
+				inv = existing
+				return nil
+			}
+		}
+		inv.ID = i.db.nextID("invoices")
+		inv.Number = i.db.nextID("invoice_sequence")
+		inv.IssuedAt = time.Now()
+		i.db.invoices = append(i.db.invoices, inv)
+		return nil
+	})
+	return inv, err
+}
+
+func (i *memoryInvoices) GetByReservation(ctx context.Context, reservationID int) (Invoice, error) {
+	var inv Invoice
+	err := i.db.locked(ctx, func() error {
+		for _, stored := range i.db.invoices {
+			if reservationID != 0 && stored.ReservationID == reservationID {
+				inv = stored
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	return inv, err
+}
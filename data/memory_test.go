@@ -0,0 +1,318 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func day(d int) time.Time {
+	return time.Date(2030, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMemory_Availability(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	generals, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+	majors, _ := m.Rooms.Create(ctx, Room{Name: "Majors Suite"})
+	_, err := m.Restrictions.Create(ctx, Restriction{RoomID: generals, StartDate: day(10), EndDate: day(13)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		available  bool
+	}{
+		{"before", day(5), day(10), true},
+		{"after", day(13), day(15), true},
+		{"inside", day(11), day(12), false},
+		{"overlapping the start", day(8), day(11), false},
+		{"overlapping the end", day(12), day(14), false},
+		{"around", day(9), day(14), false},
+	}
+	for _, tt := range tests {
+		available, err := m.Rooms.IsAvailable(ctx, generals, tt.start, tt.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if available != tt.available {
+			t.Errorf("%s: expected available %v, got %v", tt.name, tt.available, available)
+		}
+
+		rooms, _ := m.Rooms.GetAnyAvailable(ctx, tt.start, tt.end)
+		want := 1
+		if tt.available {
+			want = 2
+		}
+		if len(rooms) != want || rooms[len(rooms)-1].ID != majors {
+			t.Errorf("%s: expected %d free rooms, got %+v", tt.name, want, rooms)
+		}
+	}
+
+	// the restrictions shown on the calendar include the one starting on the last day
+	restrictions, _ := m.Restrictions.GetForRoom(ctx, day(1), day(10), generals)
+	if len(restrictions) != 1 || restrictions[0].Type != RestrictionOwner {
+		t.Errorf("expected the owner block, got %+v", restrictions)
+	}
+}
+
+func TestMemory_Reservations(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+	id, err := m.Reservations.Create(ctx, Reservation{
+		FirstName: "Jane", LastName: "Doe", Email: "Jane@Example.com", Phone: "555-0100",
+		StartDate: day(10), EndDate: day(12), RoomID: room,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Restrictions.Create(ctx, Restriction{RoomID: room, ReservationID: id, StartDate: day(10), EndDate: day(12)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := m.Reservations.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Email != "jane@example.com" || res.Code == "" || res.Room.Name != "generals quarters" {
+		t.Errorf("unexpected reservation %+v", res)
+	}
+	if byCode, err := m.Reservations.GetByCode(ctx, res.Code); err != nil || byCode.ID != id {
+		t.Errorf("expected to find the reservation by code, got %+v, %v", byCode, err)
+	}
+
+	// a returning guest books again, under the same profile
+	again, err := m.Reservations.Create(ctx, Reservation{Email: "Jane@Example.com", Phone: "555-0199", RoomID: room})
+	if err != nil {
+		t.Fatalf("expected a second booking with the same email, got %v", err)
+	}
+	if second, _ := m.Reservations.GetByID(ctx, again); second.GuestID == 0 || second.GuestID != res.GuestID {
+		t.Errorf("expected both bookings to have guest %d, got %d", res.GuestID, second.GuestID)
+	}
+
+	err = m.Reservations.Delete(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Reservations.GetByID(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+	if available, _ := m.Rooms.IsAvailable(ctx, room, day(10), day(12)); !available {
+		t.Error("deleting the reservation should free the room")
+	}
+}
+
+func TestMemory_TransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+
+	failed := errors.New("mail server on fire")
+	err := m.Transaction(ctx, func(tx *Tx) error {
+		id, err := m.Reservations.CreateTx(ctx, tx, Reservation{Email: "a@example.com", RoomID: room})
+		if err != nil {
+			return err
+		}
+		_, err = m.Restrictions.CreateTx(ctx, tx, Restriction{RoomID: room, ReservationID: id, StartDate: day(1), EndDate: day(3)})
+		if err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the error of the transaction, got %v", err)
+	}
+
+	reservations, _ := m.Reservations.GetAll(ctx)
+	if len(reservations) != 0 {
+		t.Errorf("expected the reservation to be rolled back, got %+v", reservations)
+	}
+	if available, _ := m.Rooms.IsAvailable(ctx, room, day(1), day(3)); !available {
+		t.Error("expected the restriction to be rolled back")
+	}
+
+	err = m.Transaction(ctx, func(tx *Tx) error {
+		_, err := m.Reservations.CreateTx(ctx, tx, Reservation{Email: "b@example.com", RoomID: room})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reservations, _ = m.Reservations.GetAll(ctx)
+	if len(reservations) != 1 || reservations[0].ID != 1 {
+		t.Errorf("expected the committed reservation to reuse the id given back, got %+v", reservations)
+	}
+}
+
+func TestMemory_SeparateStores(t *testing.T) {
+	ctx := context.Background()
+	first, second := NewMemory(), NewMemory()
+
+	room, _ := first.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+	err := second.Transaction(ctx, func(tx *Tx) error {
+		_, err := second.Reservations.CreateTx(ctx, tx, Reservation{Email: "a@example.com", RoomID: room})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rooms, _ := second.Rooms.GetAll(ctx); len(rooms) != 0 {
+		t.Errorf("expected the second models to have no rooms, got %+v", rooms)
+	}
+	if reservations, _ := first.Reservations.GetAll(ctx); len(reservations) != 0 {
+		t.Errorf("expected the first models to have no reservations, got %+v", reservations)
+	}
+}
+
+func TestMemory_Outbox(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	first, _ := m.Outbox.Insert(ctx, OutboxMessage{To: "a@example.com"})
+	second, _ := m.Outbox.Insert(ctx, OutboxMessage{To: "b@example.com"})
+
+	err := m.Outbox.MarkAttemptFailed(ctx, first, 1, "timeout", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, _ := m.Outbox.GetDue(ctx, 10)
+	if len(due) != 1 || due[0].ID != second {
+		t.Errorf("expected only the second message to be due, got %+v", due)
+	}
+
+	_ = m.Outbox.MarkSent(ctx, second, 1)
+	_ = m.Outbox.MarkAttemptFailed(ctx, first, 8, "timeout", time.Time{})
+	counts, _ := m.Outbox.CountByStatus(ctx)
+	if counts[OutboxSent] != 1 || counts[OutboxDead] != 1 || counts[OutboxPending] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+
+	_ = m.Outbox.Requeue(ctx, first)
+	recent, _ := m.Outbox.GetRecent(ctx, OutboxPending, 10)
+	if len(recent) != 1 || recent[0].ID != first || recent[0].Attempts != 0 {
+		t.Errorf("expected the dead letter to be pending again, got %+v", recent)
+	}
+}
+
+func TestMemory_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	user, _ := m.Users.Insert(ctx, User{FirstName: "Ada", LastName: "Admin", Email: "admin@example.com", Password: "secret", AccessLevel: 3})
+
+	id, token, err := m.APIKeys.Issue(ctx, APIKey{UserID: user, Name: "channel manager", Scopes: []string{ScopeReadAvailability}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := m.APIKeys.Authenticate(ctx, token)
+	if err != nil || key.ID != id || key.User.AccessLevel != 3 || !key.HasScope(ScopeReadAvailability) {
+		t.Errorf("expected the key of the admin, got %+v, %v", key, err)
+	}
+	if _, err := m.APIKeys.Authenticate(ctx, token+"0"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for a wrong secret, got %v", err)
+	}
+
+	_ = m.APIKeys.Revoke(ctx, id)
+	if _, err := m.APIKeys.Authenticate(ctx, token); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for a revoked key, got %v", err)
+	}
+	if keys, _ := m.APIKeys.GetAll(ctx); len(keys) != 1 || !keys[0].Revoked() || keys[0].User.Email != "admin@example.com" {
+		t.Errorf("expected the revoked key to be kept, got %+v", keys)
+	}
+}
+
+func TestMemory_Invoices(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+	first, _ := m.Reservations.Create(ctx, Reservation{Email: "a@example.com", RoomID: room})
+	second, _ := m.Reservations.Create(ctx, Reservation{Email: "b@example.com", RoomID: room})
+
+	inv, err := m.Invoices.Issue(ctx, Invoice{ReservationID: first, Total: 8900})
+	if err != nil || inv.Number != 1 {
+		t.Fatalf("expected invoice 1, got %+v, %v", inv, err)
+	}
+	if again, _ := m.Invoices.Issue(ctx, Invoice{ReservationID: first, Total: 1}); again.ID != inv.ID || again.Total != 8900 {
+		t.Errorf("expected the invoice already issued, got %+v", again)
+	}
+
+	if inv, _ := m.Invoices.Issue(ctx, Invoice{ReservationID: second}); inv.Number != 2 {
+		t.Errorf("expected invoice 2, got %d", inv.Number)
+	}
+
+	_ = m.Reservations.Delete(ctx, first)
+	if _, err := m.Invoices.GetByReservation(ctx, first); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the invoice to be kept without its reservation, got %v", err)
+	}
+}
+
+func TestMemory_ICalImports(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+
+	id, _ := m.ICalImports.Insert(ctx, ICalImport{RoomID: room, Name: "Airbnb", URL: "https://example.com/a.ics"})
+	_, _ = m.Restrictions.Create(ctx, Restriction{RoomID: room, Type: RestrictionExternal, ICalImportID: id,
+		ExternalUID: "a", StartDate: day(1), EndDate: day(3)})
+	_ = m.ICalSyncLogs.Insert(ctx, ICalSyncLog{ICalImportID: id, Status: SyncStatusOK, Created: 1})
+
+	if logs, _ := m.ICalSyncLogs.GetRecent(ctx, 10); len(logs) != 1 || logs[0].Import.Room.Name != "generals quarters" {
+		t.Errorf("expected the sync with its room, got %+v", logs)
+	}
+
+	_ = m.ICalImports.Delete(ctx, id)
+	if available, _ := m.Rooms.IsAvailable(ctx, room, day(1), day(3)); !available {
+		t.Error("expected the blocks of the import to go with it")
+	}
+	if logs, _ := m.ICalSyncLogs.GetRecent(ctx, 10); len(logs) != 0 {
+		t.Errorf("expected the sync log to go with the import, got %+v", logs)
+	}
+}
+
+func TestMemory_WebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	hook, _ := m.Webhooks.Insert(ctx, Webhook{URL: "https://example.com/hook", Events: []string{EventReservationCreated}})
+	first, _ := m.Deliveries.Insert(ctx, WebhookDelivery{WebhookID: hook, Event: EventReservationCreated, Payload: "{}"})
+	second, _ := m.Deliveries.Insert(ctx, WebhookDelivery{WebhookID: hook, Event: EventReservationCreated, Payload: "{}"})
+
+	_ = m.Deliveries.MarkAttemptFailed(ctx, first, 1, 500, "server error", time.Now().Add(time.Hour))
+	due, _ := m.Deliveries.GetDue(ctx, 10)
+	if len(due) != 1 || due[0].ID != second || due[0].Webhook.Secret == "" {
+		t.Errorf("expected only the second delivery to be due, with its secret, got %+v", due)
+	}
+
+	_ = m.Webhooks.Delete(ctx, hook)
+	if recent, _ := m.Deliveries.GetRecent(ctx, 10); len(recent) != 0 {
+		t.Errorf("expected the delivery log to go with the webhook, got %+v", recent)
+	}
+}
+
+func TestMemory_Users(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	id, err := m.Users.Insert(ctx, User{FirstName: "Ada", LastName: "Admin", Email: "Admin@Example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, token, err := m.Users.Authenticate(ctx, "admin@example.com", "secret")
+	if err != nil || got != id || token == "" {
+		t.Errorf("expected to log in, got %d, %v", got, err)
+	}
+	if _, _, err := m.Users.Authenticate(ctx, "admin@example.com", "wrong"); err == nil {
+		t.Error("expected a wrong password to fail")
+	}
+	if _, _, err := m.Users.Authenticate(ctx, "nobody@example.com", "secret"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown user, got %v", err)
+	}
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"os"
+	"time"
 )
 
 var DB *sql.DB
@@ -11,26 +13,64 @@ var psql postgres
 type Models struct {
 	//any models inserted here (and in the New func)
 	//are easily accessible throughout the entire application
-	Rooms        Room
-	Users        User
-	Reservations Reservation
-	Restrictions Restriction
+	Rooms        RoomRepository
+	Users        UserRepository
+	Reservations ReservationRepository
+	Guests       GuestRepository
+	Restrictions RestrictionRepository
+	Audit        AuditRepository
+	APIKeys      APIKeyRepository
+	ICalImports  ICalImportRepository
+	ICalSyncLogs ICalSyncLogRepository
+	Webhooks     WebhookRepository
+	Deliveries   WebhookDeliveryRepository
+	Outbox       OutboxRepository
+	// ReservationMails tracks the scheduled mail sent about each reservation
+	ReservationMails ReservationMailRepository
+	Invoices         InvoiceRepository
+
+	memory *memoryDB // the tables of the in-memory models, nil with a database
 }
 
+// New returns the models of DATABASE_TYPE: postgres, mysql, mariadb or sqlite, or memory, which keeps everything
+// in the process and needs no databasePool, see NewMemory. On MySQL, MariaDB and SQLite only the rooms, users,
+// reservations, guests, restrictions, the audit log and the mail outbox work; the other models need postgres
 func New(databasePool *sql.DB) Models {
-	DB = databasePool
-
 	switch os.Getenv("DATABASE_TYPE") {
+	case "memory":
+		return NewMemory()
 	case "postgres", "postgresql":
 		psql.New(databasePool)
 	default:
 		//do nothing
 	}
 
+	DB = databasePool
+	dialect = DialectOf(os.Getenv("DATABASE_TYPE"))
+
 	return Models{
-		Rooms:        Room{},
-		Users:        User{},
-		Reservations: Reservation{},
-		Restrictions: Restriction{},
+		Rooms:            &Room{},
+		Users:            &User{},
+		Reservations:     &Reservation{},
+		Guests:           &Guest{},
+		Restrictions:     &Restriction{},
+		Audit:            &AuditEntry{},
+		APIKeys:          &APIKey{},
+		ICalImports:      &ICalImport{},
+		ICalSyncLogs:     &ICalSyncLog{},
+		Webhooks:         &Webhook{},
+		Deliveries:       &WebhookDelivery{},
+		Outbox:           &OutboxMessage{},
+		ReservationMails: &ReservationMail{},
+		Invoices:         &Invoice{},
 	}
 }
+
+// QueryTimeout is the longest a query may take. A query also ends with the context it was given,
+// e.g. when the client of the request goes away
+var QueryTimeout = 3 * time.Second
+
+// withTimeout bounds a query by QueryTimeout on top of ctx
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, QueryTimeout)
+}
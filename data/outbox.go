@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// outbox statuses
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxMessage is an email waiting to be sent, or the record of one that was.
+// Messages are written in the same transaction as the change they are about, so neither is lost without the other
+type OutboxMessage struct {
+	ID            int
+	To            string
+	From          string
+	FromName      string
+	Subject       string
+	Template      string
+	Data          string
+	Attachments   []Attachment
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        sql.NullTime
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Name    string
+	Content []byte
+}
+
+func (o *OutboxMessage) Table() string {
+	return "mail_outbox"
+}
+
+// Insert queues a message to be sent right away and returns its id
+func (o *OutboxMessage) Insert(ctx context.Context, msg OutboxMessage) (int, error) {
+	return o.insert(ctx, DB, msg)
+}
+
+// InsertTx queues a message as part of tx; it is only sent once tx commits
+func (o *OutboxMessage) InsertTx(ctx context.Context, tx *Tx, msg OutboxMessage) (int, error) {
+	return o.insert(ctx, tx.sql, msg)
+}
+
+func (o *OutboxMessage) insert(ctx context.Context, q dbtx, msg OutboxMessage) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if msg.Data == "" {
+		msg.Data = "{}"
+	}
+	if msg.Attachments == nil {
+		msg.Attachments = []Attachment{}
+	}
+	attachments, err := json.Marshal(msg.Attachments)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `insert into mail_outbox (to_address, from_address, from_name, subject, template, data, attachments,
+			status, next_attempt_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	return insertID(ctx, q, query,
+		msg.To,
+		msg.From,
+		msg.FromName,
+		msg.Subject,
+		msg.Template,
+		msg.Data,
+		string(attachments),
+		OutboxPending,
+		time.Now(),
+		time.Now(),
+		time.Now(),
+	)
+}
+
+const outboxColumns = `id, to_address, from_address, from_name, subject, template, data, attachments, status, attempts,
+		next_attempt_at, last_error, sent_at, created_at, updated_at`
+
+func queryOutbox(ctx context.Context, query string, args ...any) ([]OutboxMessage, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var messages []OutboxMessage
+
+	rows, err := inDialect(DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return messages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg OutboxMessage
+		var attachments string
+		var updatedAt sql.NullTime
+		err := rows.Scan(
+			&msg.ID,
+			&msg.To,
+			&msg.From,
+			&msg.FromName,
+			&msg.Subject,
+			&msg.Template,
+			&msg.Data,
+			&attachments,
+			&msg.Status,
+			&msg.Attempts,
+			&msg.NextAttemptAt,
+			&msg.LastError,
+			&msg.SentAt,
+			&msg.CreatedAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return messages, err
+		}
+		msg.UpdatedAt = updatedAt.Time
+		err = json.Unmarshal([]byte(attachments), &msg.Attachments)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
+
+// GetDue returns at most limit pending messages whose next attempt is due, oldest first
+func (o *OutboxMessage) GetDue(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	query := `select ` + outboxColumns + ` from mail_outbox
+		where status = $1 and next_attempt_at <= $2
+		order by next_attempt_at, id
+		limit $3`
+	return queryOutbox(ctx, query, OutboxPending, time.Now(), limit)
+}
+
+// GetRecent returns the latest limit messages, newest first; status narrows them down when it is not empty
+func (o *OutboxMessage) GetRecent(ctx context.Context, status string, limit int) ([]OutboxMessage, error) {
+	query := `select ` + outboxColumns + ` from mail_outbox
+		where $1 = '' or status = $1
+		order by created_at desc, id desc
+		limit $2`
+	return queryOutbox(ctx, query, status, limit)
+}
+
+// CountByStatus returns how many messages there are in each status
+func (o *OutboxMessage) CountByStatus(ctx context.Context) (map[string]int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	counts := map[string]int{OutboxPending: 0, OutboxSent: 0, OutboxDead: 0}
+
+	rows, err := inDialect(DB).QueryContext(ctx, "select status, count(*) from mail_outbox group by status")
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var n int
+		err := rows.Scan(&status, &n)
+		if err != nil {
+			return counts, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// MarkSent records a successful attempt
+func (o *OutboxMessage) MarkSent(ctx context.Context, id, attempts int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `update mail_outbox set status = $1, attempts = $2, last_error = '', sent_at = $3, updated_at = $3
+			where id = $4`
+	_, err := inDialect(DB).ExecContext(ctx, query, OutboxSent, attempts, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkAttemptFailed records a failed attempt. The message is retried at next,
+// or moved to the dead letters when next is zero
+func (o *OutboxMessage) MarkAttemptFailed(ctx context.Context, id, attempts int, lastError string, next time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	status := OutboxPending
+	if next.IsZero() {
+		status = OutboxDead
+		next = time.Now()
+	}
+
+	query := `update mail_outbox set status = $1, attempts = $2, last_error = $3, next_attempt_at = $4, updated_at = $5
+			where id = $6`
+	_, err := inDialect(DB).ExecContext(ctx, query, status, attempts, lastError, next, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Requeue sends a dead message again on the next run, with a fresh set of attempts
+func (o *OutboxMessage) Requeue(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `update mail_outbox set status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+			where id = $3 and status = $4`
+	_, err := inDialect(DB).ExecContext(ctx, query, OutboxPending, time.Now(), id, OutboxDead)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// RoomRepository stores the rooms; *Room is the postgres implementation
+type RoomRepository interface {
+	Create(ctx context.Context, room Room) (int, error)
+	GetAll(ctx context.Context) ([]Room, error)
+	GetById(ctx context.Context, id int) (Room, error)
+	GetByName(ctx context.Context, name string) (Room, error)
+	GetByICalToken(ctx context.Context, token string) (Room, error)
+	RegenerateICalToken(ctx context.Context, id int) (string, error)
+	UpdateNightlyRate(ctx context.Context, id, rate int) error
+	IsAvailable(ctx context.Context, roomID int, start, end time.Time) (bool, error)
+	IsAvailableTx(ctx context.Context, tx *Tx, roomID int, start, end time.Time) (bool, error)
+	GetAnyAvailable(ctx context.Context, start, end time.Time) ([]Room, error)
+}
+
+// ReservationRepository stores the reservations; *Reservation is the postgres implementation
+type ReservationRepository interface {
+	Create(ctx context.Context, res Reservation) (int, error)
+	CreateTx(ctx context.Context, tx *Tx, res Reservation) (int, error)
+	GetAll(ctx context.Context) ([]Reservation, error)
+	GetByID(ctx context.Context, id int) (Reservation, error)
+	GetByCode(ctx context.Context, code string) (Reservation, error)
+	GetForGuest(ctx context.Context, guestID int) ([]Reservation, error)
+	List(ctx context.Context, q ReservationQuery) (ReservationPage, error)
+	Search(ctx context.Context, text string, limit int) ([]GuestMatch, error)
+	Update(ctx context.Context, res Reservation) error
+	UpdateTx(ctx context.Context, tx *Tx, res Reservation) error
+	UpdateProcessedStatus(ctx context.Context, processed, id int) error
+	Delete(ctx context.Context, id int) error
+	DeleteTx(ctx context.Context, tx *Tx, id int) error
+}
+
+// GuestRepository stores the guests, which the reservations add as they are booked; *Guest is the postgres
+// implementation
+type GuestRepository interface {
+	GetByID(ctx context.Context, id int) (Guest, error)
+	GetByEmail(ctx context.Context, email string) (Guest, error)
+	Duplicates(ctx context.Context, guest Guest) ([]Guest, error)
+	Merge(ctx context.Context, keepID, mergeID int) error
+}
+
+// RestrictionRepository stores the restrictions that block rooms; *Restriction is the postgres implementation
+type RestrictionRepository interface {
+	Create(ctx context.Context, restrict Restriction) (int, error)
+	CreateTx(ctx context.Context, tx *Tx, restrict Restriction) (int, error)
+	GetForRoom(ctx context.Context, start, end time.Time, roomID int) ([]Restriction, error)
+	GetAllForRoom(ctx context.Context, roomID int) ([]Restriction, error)
+	GetForImport(ctx context.Context, importID int) ([]Restriction, error)
+	UpdateDates(ctx context.Context, id int, start, end time.Time) error
+	UpdateDatesTx(ctx context.Context, tx *Tx, id int, start, end time.Time) error
+	Delete(ctx context.Context, id int) error
+	DeleteTx(ctx context.Context, tx *Tx, id int) error
+}
+
+// UserRepository stores the staff users; *User is the postgres implementation
+type UserRepository interface {
+	Insert(ctx context.Context, user User) (int, error)
+	InsertAndReturnId(ctx context.Context, user User) (int, error)
+	SelectAll(ctx context.Context) ([]User, error)
+	Count(ctx context.Context) (int, error)
+	GetByID(ctx context.Context, id int) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
+	Update(ctx context.Context, user User) error
+	Authenticate(ctx context.Context, email, password string) (int, string, error)
+	UpdatePassword(ctx context.Context, user User, newHash []byte) error
+	Delete(ctx context.Context, id int) error
+}
+
+// AuditRepository reads the audit log, which the other repositories write as they change the data; *AuditEntry is
+// the postgres implementation
+type AuditRepository interface {
+	GetForReservation(ctx context.Context, reservationID int) ([]AuditEntry, error)
+	GetForEntity(ctx context.Context, entity string, id int) ([]AuditEntry, error)
+}
+
+// OutboxRepository stores the outgoing mail; *OutboxMessage is the postgres implementation.
+// It is written in the same transaction as a booking, so it has to live wherever the reservations do
+type OutboxRepository interface {
+	Insert(ctx context.Context, msg OutboxMessage) (int, error)
+	InsertTx(ctx context.Context, tx *Tx, msg OutboxMessage) (int, error)
+	GetDue(ctx context.Context, limit int) ([]OutboxMessage, error)
+	GetRecent(ctx context.Context, status string, limit int) ([]OutboxMessage, error)
+	CountByStatus(ctx context.Context) (map[string]int, error)
+	MarkSent(ctx context.Context, id, attempts int) error
+	MarkAttemptFailed(ctx context.Context, id, attempts int, lastError string, next time.Time) error
+	Requeue(ctx context.Context, id int) error
+}
+
+// ReservationMailRepository records the scheduled mail queued for each reservation; *ReservationMail is the
+// postgres implementation
+type ReservationMailRepository interface {
+	RecordTx(ctx context.Context, tx *Tx, reservationID int, kind string) (bool, error)
+	GetArriving(ctx context.Context, today time.Time, days int, kind string) ([]Reservation, error)
+	GetDeparted(ctx context.Context, today time.Time, window int, kind string) ([]Reservation, error)
+}
+
+// APIKeyRepository stores the keys partners call the json api with; *APIKey is the postgres implementation
+type APIKeyRepository interface {
+	Issue(ctx context.Context, key APIKey) (int, string, error)
+	Authenticate(ctx context.Context, token string) (APIKey, error)
+	GetAll(ctx context.Context) ([]APIKey, error)
+	TouchLastUsed(ctx context.Context, id int) error
+	Revoke(ctx context.Context, id int) error
+}
+
+// ICalImportRepository stores the calendar feeds imported from other platforms; *ICalImport is the postgres
+// implementation
+type ICalImportRepository interface {
+	Insert(ctx context.Context, imp ICalImport) (int, error)
+	GetAll(ctx context.Context) ([]ICalImport, error)
+	GetByID(ctx context.Context, id int) (ICalImport, error)
+	Delete(ctx context.Context, id int) error
+	MarkSynced(ctx context.Context, id int, status string, at time.Time) error
+}
+
+// ICalSyncLogRepository stores the outcome of every sync of the imports; *ICalSyncLog is the postgres
+// implementation
+type ICalSyncLogRepository interface {
+	Insert(ctx context.Context, entry ICalSyncLog) error
+	GetRecent(ctx context.Context, limit int) ([]ICalSyncLog, error)
+}
+
+// WebhookRepository stores the endpoints that hear about events; *Webhook is the postgres implementation
+type WebhookRepository interface {
+	Insert(ctx context.Context, hook Webhook) (int, error)
+	GetAll(ctx context.Context) ([]Webhook, error)
+	GetForEvent(ctx context.Context, event string) ([]Webhook, error)
+	GetByID(ctx context.Context, id int) (Webhook, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// WebhookDeliveryRepository stores the events sent to the webhooks; *WebhookDelivery is the postgres
+// implementation
+type WebhookDeliveryRepository interface {
+	Insert(ctx context.Context, delivery WebhookDelivery) (int, error)
+	GetByID(ctx context.Context, id int) (WebhookDelivery, error)
+	GetDue(ctx context.Context, limit int) ([]WebhookDelivery, error)
+	GetRecent(ctx context.Context, limit int) ([]WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id, attempts, responseCode int) error
+	MarkAttemptFailed(ctx context.Context, id, attempts, responseCode int, lastError string, next time.Time) error
+}
+
+// InvoiceRepository stores the invoices issued for the reservations; *Invoice is the postgres implementation
+type InvoiceRepository interface {
+	Issue(ctx context.Context, inv Invoice) (Invoice, error)
+	GetByReservation(ctx context.Context, reservationID int) (Invoice, error)
+}
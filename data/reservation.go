@@ -2,6 +2,9 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
 	"github.com/ahmedkhaeld/jazz/forms"
 	"strings"
 	"time"
@@ -9,6 +12,7 @@ import (
 
 type Reservation struct {
 	ID        int
+	Code      string
 	FirstName string
 	LastName  string
 	Email     string
@@ -16,16 +20,30 @@ type Reservation struct {
 	StartDate time.Time
 	EndDate   time.Time
 	RoomID    int
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Room      Room
-	Processed int
+	// NightlyRate is the price of a night when the room was booked, in cents
+	NightlyRate int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Room        Room
+	Processed   int
+	// GuestID is the guest who booked, matched by the email
+	GuestID int
 }
 
 func (r *Reservation) Table() string {
 	return "reservations"
 }
 
+// Nights is the length of the stay
+func (r *Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+// Total is the price of the stay in cents
+func (r *Reservation) Total() int {
+	return r.Nights() * r.NightlyRate
+}
+
 func (r *Reservation) Validate(v *forms.Form) {
 	v.Required("first_name", "last_name", "email", "phone")
 	v.MinLength("first_name", 3)
@@ -34,19 +52,48 @@ func (r *Reservation) Validate(v *forms.Form) {
 
 }
 
-func (r *Reservation) Create(res Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Reservation) Create(ctx context.Context, res Reservation) (int, error) {
+	var id int
+	err := transaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		id, err = r.create(ctx, tx, res)
+		return err
+	})
+	return id, err
+}
+
+// CreateTx inserts a reservation as part of tx
+func (r *Reservation) CreateTx(ctx context.Context, tx *Tx, res Reservation) (int, error) {
+	return r.create(ctx, tx.sql, res)
+}
+
+func (r *Reservation) create(ctx context.Context, q dbtx, res Reservation) (int, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	res.FirstName = strings.ToLower(res.FirstName)
 	res.LastName = strings.ToLower(res.LastName)
 	res.Email = strings.ToLower(res.Email)
 
-	var newID int
-	query := `insert into reservations (first_name, last_name, email, 
-			phone, start_date, end_date, room_id, created_at, updated_at)
-			values($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
-	err := DB.QueryRowContext(ctx, query,
+	if res.Code == "" {
+		code, err := NewConfirmationCode()
+		if err != nil {
+			return 0, err
+		}
+		res.Code = code
+	}
+
+	guestID, err := matchGuest(ctx, q, res)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `insert into reservations (code, guest_id, first_name, last_name, email, 
+			phone, start_date, end_date, room_id, nightly_rate, created_at, updated_at)
+			values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	res.ID, err = insertID(ctx, q, query,
+		res.Code,
+		guestID,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -54,29 +101,42 @@ func (r *Reservation) Create(res Reservation) (int, error) {
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		res.NightlyRate,
 		time.Now(),
-		time.Now()).Scan(&newID)
+		time.Now())
 	if err != nil {
 		return 0, err
 	}
-	return newID, nil
+
+	// a guest booking on the site is known by the profile they were matched to
+	if actor := ActorFrom(ctx); actor.Type == ActorGuest && actor.ID == 0 {
+		ctx = WithActor(ctx, Actor{Type: ActorGuest, ID: guestID})
+	}
+	res.GuestID = guestID
+	res.Processed = 0
+	err = audit(ctx, q, AuditCreate, r.Table(), res.ID, res.ID, nil, reservationFields(res))
+	if err != nil {
+		return 0, err
+	}
+	return res.ID, nil
 }
 
-func (r *Reservation) GetAll() ([]Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetAll returns every reservation by arrival; listings page through them with List
+func (r *Reservation) GetAll(ctx context.Context) ([]Reservation, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var reservations []Reservation
 
 	query := `
-	select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-	r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.name
+	select r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+	r.end_date, r.room_id, r.nightly_rate, r.created_at, r.updated_at, r.processed, r.guest_id, rm.id, rm.name
 	from reservations r
 	left join rooms rm on (r.room_id = rm.id)
 	order by r.start_date asc
 `
 
-	rows, err := DB.QueryContext(ctx, query)
+	rows, err := inDialect(DB).QueryContext(ctx, query)
 	if err != nil {
 		return reservations, err
 	}
@@ -86,6 +146,7 @@ func (r *Reservation) GetAll() ([]Reservation, error) {
 		var i Reservation
 		err := rows.Scan(
 			&i.ID,
+			&i.Code,
 			&i.FirstName,
 			&i.LastName,
 			&i.Email,
@@ -93,10 +154,12 @@ func (r *Reservation) GetAll() ([]Reservation, error) {
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
+			&i.NightlyRate,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Processed,
-			&i.RoomID,
+			&i.GuestID,
+			&i.Room.ID,
 			&i.Room.Name,
 		)
 
@@ -112,22 +175,32 @@ func (r *Reservation) GetAll() ([]Reservation, error) {
 	return reservations, nil
 }
 
-func (r *Reservation) GetByID(id int) (Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Reservation) GetByID(ctx context.Context, id int) (Reservation, error) {
+	return r.get(ctx, DB, "r.id = $1", id)
+}
+
+// GetByCode returns the reservation with the given confirmation code
+func (r *Reservation) GetByCode(ctx context.Context, code string) (Reservation, error) {
+	return r.get(ctx, DB, "r.code = $1", strings.ToUpper(code))
+}
+
+// get returns the reservation matching where on q, which the changes read before they are made
+func (r *Reservation) get(ctx context.Context, q dbtx, where string, args ...any) (Reservation, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var res Reservation
 	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+		select r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.nightly_rate, r.created_at, r.updated_at, r.processed, r.guest_id, rm.id, rm.name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		where r.id = $1 
-	`
+		where ` + where
 
-	row := DB.QueryRowContext(ctx, query, id)
+	row := inDialect(q).QueryRowContext(ctx, query, args...)
 	err := row.Scan(
 		&res.ID,
+		&res.Code,
 		&res.FirstName,
 		&res.LastName,
 		&res.Email,
@@ -135,9 +208,11 @@ func (r *Reservation) GetByID(id int) (Reservation, error) {
 		&res.StartDate,
 		&res.EndDate,
 		&res.RoomID,
+		&res.NightlyRate,
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.GuestID,
 		&res.Room.ID,
 		&res.Room.Name,
 	)
@@ -149,22 +224,139 @@ func (r *Reservation) GetByID(id int) (Reservation, error) {
 	return res, nil
 }
 
-func (r *Reservation) GetOnlyNew() ([]Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Reservation) Update(ctx context.Context, res Reservation) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		return r.update(ctx, tx, res)
+	})
+}
+
+// UpdateTx saves the guest details of a reservation as part of tx
+func (r *Reservation) UpdateTx(ctx context.Context, tx *Tx, res Reservation) error {
+	return r.update(ctx, tx.sql, res)
+}
+
+func (r *Reservation) update(ctx context.Context, q dbtx, res Reservation) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	before, err := r.get(ctx, q, "r.id = $1", res.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// a changed email moves the reservation to the guest of that email
+	guestID, err := matchGuest(ctx, q, res)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		update reservations set guest_id=$1, first_name=$2, last_name=$3, email=$4, phone=$5, updated_at=$6
+		where id =$7
+`
+
+	_, err = inDialect(q).ExecContext(ctx, query,
+		guestID,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		time.Now(),
+		res.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.GuestID = guestID
+	after.FirstName = res.FirstName
+	after.LastName = res.LastName
+	after.Email = res.Email
+	after.Phone = res.Phone
+	return audit(ctx, q, AuditUpdate, r.Table(), res.ID, res.ID, reservationFields(before), reservationFields(after))
+}
+
+func (r *Reservation) UpdateProcessedStatus(ctx context.Context, processed, id int) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
+
+		before, err := r.get(ctx, tx, "r.id = $1", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		query := "update reservations set processed = $1 where id =$2"
+
+		_, err = inDialect(tx).ExecContext(ctx, query, processed, id)
+		if err != nil {
+			return err
+		}
+
+		after := before
+		after.Processed = processed
+		return audit(ctx, tx, AuditUpdate, r.Table(), id, id, reservationFields(before), reservationFields(after))
+	})
+}
+
+func (r *Reservation) Delete(ctx context.Context, id int) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		return r.delete(ctx, tx, id)
+	})
+}
+
+// DeleteTx deletes a reservation as part of tx
+func (r *Reservation) DeleteTx(ctx context.Context, tx *Tx, id int) error {
+	return r.delete(ctx, tx.sql, id)
+}
+
+func (r *Reservation) delete(ctx context.Context, q dbtx, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	before, err := r.get(ctx, q, "r.id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	query := "delete from reservations where id =$1"
+
+	_, err = inDialect(q).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	// the restriction goes with it by the foreign key, and is part of this entry
+	return audit(ctx, q, AuditDelete, r.Table(), id, id, reservationFields(before), nil)
+}
+
+// GetForGuest returns the stays of a guest, the latest arrival first
+func (r *Reservation) GetForGuest(ctx context.Context, guestID int) ([]Reservation, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var reservations []Reservation
 
 	query := `
-	select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-	r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.name
+	select r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+	r.end_date, r.room_id, r.nightly_rate, r.created_at, r.updated_at, r.processed, r.guest_id, rm.id, rm.name
 	from reservations r
 	left join rooms rm on (r.room_id = rm.id)
-	where processed = 0 
-	order by r.start_date asc
+	where r.guest_id = $1
+	order by r.start_date desc, r.id desc
 `
 
-	rows, err := DB.QueryContext(ctx, query)
+	rows, err := inDialect(DB).QueryContext(ctx, query, guestID)
 	if err != nil {
 		return reservations, err
 	}
@@ -174,6 +366,7 @@ func (r *Reservation) GetOnlyNew() ([]Reservation, error) {
 		var i Reservation
 		err := rows.Scan(
 			&i.ID,
+			&i.Code,
 			&i.FirstName,
 			&i.LastName,
 			&i.Email,
@@ -181,13 +374,14 @@ func (r *Reservation) GetOnlyNew() ([]Reservation, error) {
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
+			&i.NightlyRate,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Processed,
-			&i.RoomID,
+			&i.GuestID,
+			&i.Room.ID,
 			&i.Room.Name,
 		)
-
 		if err != nil {
 			return reservations, err
 		}
@@ -200,55 +394,25 @@ func (r *Reservation) GetOnlyNew() ([]Reservation, error) {
 	return reservations, nil
 }
 
-func (r *Reservation) Update(res Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		update reservations set first_name=$1, last_name=$2, email=$3, phone=$4, updated_at=$5
-		where id =$6
-`
-
-	_, err := DB.ExecContext(ctx, query,
-		res.FirstName,
-		res.LastName,
-		res.Email,
-		res.Phone,
-		time.Now(),
-		res.ID,
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (r *Reservation) UpdateProcessedStatus(processed, id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := "update reservations set processed = $1 where id =$2"
-
-	_, err := DB.ExecContext(ctx, query, processed, id)
-	if err != nil {
-		return err
-	}
-
-	return nil
-
-}
-
-func (r *Reservation) Delete(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := "delete from reservations where id =$1"
-
-	_, err := DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
+// codeAlphabet leaves out characters that are easy to confuse when read out loud (0/O, 1/I/L)
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// NewConfirmationCode returns a random code the guest can use to look up their reservation
+func NewConfirmationCode() (string, error) {
+	code := make([]byte, 0, 10)
+	buf := make([]byte, 16)
+	// only accept bytes below the largest multiple of the alphabet size, so every character is equally likely
+	limit := 256 - 256%len(codeAlphabet)
+	for len(code) < cap(code) {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(code) < cap(code) {
+				code = append(code, codeAlphabet[int(b)%len(codeAlphabet)])
+			}
+		}
 	}
-
-	return nil
+	return string(code), nil
 }
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ReservationMail records a scheduled mail queued for a reservation, so restarts and overlapping runs
+// never send it twice
+type ReservationMail struct {
+	ID            int
+	ReservationID int
+	Kind          string
+	CreatedAt     time.Time
+}
+
+func (m *ReservationMail) Table() string {
+	return "reservation_mails"
+}
+
+// RecordTx records that the mail of kind is queued for a reservation as part of tx.
+// It returns false, and records nothing, when the mail was already queued
+func (m *ReservationMail) RecordTx(ctx context.Context, tx *Tx, reservationID int, kind string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	query := `insert into reservation_mails (reservation_id, kind, created_at) values ($1, $2, $3)
+			on conflict (reservation_id, kind) do nothing
+			returning id`
+	err := tx.sql.QueryRowContext(ctx, query, reservationID, kind, time.Now()).Scan(&newID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetArriving returns the reservations arriving from today up to days from now that the mail of kind
+// was not queued for yet. Reservations booked less than days before arrival are left out,
+// their confirmation is recent enough
+func (m *ReservationMail) GetArriving(ctx context.Context, today time.Time, days int, kind string) ([]Reservation, error) {
+	query := `
+		select r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.nightly_rate, r.created_at, r.updated_at, r.processed, r.guest_id, rm.id, rm.name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.start_date >= $1 and r.start_date <= $2
+		and r.created_at < r.start_date - $3::int * interval '1 day'
+		and not exists (select 1 from reservation_mails m where m.reservation_id = r.id and m.kind = $4)
+		order by r.start_date, r.id`
+	return m.query(ctx, query, today, today.AddDate(0, 0, days), days, kind)
+}
+
+// GetDeparted returns the reservations that checked out today or in the days before, at most window days ago,
+// that the mail of kind was not queued for yet. The window keeps a first run from mailing every past guest
+func (m *ReservationMail) GetDeparted(ctx context.Context, today time.Time, window int, kind string) ([]Reservation, error) {
+	query := `
+		select r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.nightly_rate, r.created_at, r.updated_at, r.processed, r.guest_id, rm.id, rm.name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.end_date <= $1 and r.end_date > $2
+		and not exists (select 1 from reservation_mails m where m.reservation_id = r.id and m.kind = $3)
+		order by r.end_date, r.id`
+	return m.query(ctx, query, today, today.AddDate(0, 0, -window), kind)
+}
+
+func (m *ReservationMail) query(ctx context.Context, query string, args ...any) ([]Reservation, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var reservations []Reservation
+
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.NightlyRate,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.GuestID,
+			&i.Room.ID,
+			&i.Room.Name,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
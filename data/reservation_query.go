@@ -0,0 +1,379 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sort orders of a ReservationQuery; ties are broken by id so every reservation has its place
+const (
+	SortArrival     = "arrival"  // earliest arrival first, the default
+	SortArrivalDesc = "-arrival" // latest arrival first
+	SortBooked      = "booked"   // oldest booking first
+	SortBookedDesc  = "-booked"  // latest booking first
+	SortGuest       = "guest"    // by the last name of the guest
+)
+
+// reservation statuses a ReservationQuery can keep
+const (
+	StatusNew       = "new"
+	StatusProcessed = "processed"
+)
+
+// page sizes of a ReservationQuery
+const (
+	DefaultPageSize = 25
+	MaxPageSize     = 100
+)
+
+// ErrInvalidQuery is returned for a ReservationQuery with an unknown sort or status, or a cursor it did not give
+var ErrInvalidQuery = errors.New("data: invalid reservation query")
+
+// ReservationQuery selects a page of reservations for a listing. The zero value is the first page of
+// every reservation by arrival
+type ReservationQuery struct {
+	// From and To keep the stays that overlap them, leaving after From and arriving before To;
+	// either may be zero
+	From time.Time
+	To   time.Time
+	// RoomID keeps the reservations of one room
+	RoomID int
+	// Status keeps the new or the processed reservations
+	Status string
+	// Text keeps the reservations whose code, guest name, email or phone contain every word of it, ignoring case
+	Text string
+	Sort string
+	// Limit is the size of the page, DefaultPageSize when 0 and at most MaxPageSize
+	Limit int
+	// After asks for the page following a ReservationPage.Next, Before for the one before a ReservationPage.Prev
+	After  string
+	Before string
+}
+
+// ReservationPage is a page of a listing
+type ReservationPage struct {
+	Reservations []Reservation
+	// Total counts the reservations of every page
+	Total int
+	// Next and Prev are the cursors of the pages around this one, empty when there is none
+	Next string
+	Prev string
+}
+
+// reservationSort is how a sort order sorts: the column, and the value of it a cursor keeps
+type reservationSort struct {
+	column string
+	desc   bool
+	key    func(res Reservation) any
+}
+
+var reservationSorts = map[string]reservationSort{
+	SortArrival:     {"r.start_date", false, func(res Reservation) any { return res.StartDate }},
+	SortArrivalDesc: {"r.start_date", true, func(res Reservation) any { return res.StartDate }},
+	SortBooked:      {"r.created_at", false, func(res Reservation) any { return res.CreatedAt }},
+	SortBookedDesc:  {"r.created_at", true, func(res Reservation) any { return res.CreatedAt }},
+	SortGuest:       {"r.last_name", false, func(res Reservation) any { return res.LastName }},
+}
+
+// reservationCursor is the place of a reservation in a sort order; it is handed out encoded
+type reservationCursor struct {
+	Sort string     `json:"s"`
+	Time *time.Time `json:"t,omitempty"`
+	Text string     `json:"x,omitempty"`
+	ID   int        `json:"id"`
+}
+
+func (c reservationCursor) key() any {
+	if c.Time != nil {
+		return *c.Time
+	}
+	return c.Text
+}
+
+func encodeCursor(sortName string, s reservationSort, res Reservation) string {
+	c := reservationCursor{Sort: sortName, ID: res.ID}
+	switch key := s.key(res).(type) {
+	case time.Time:
+		c.Time = &key
+	case string:
+		c.Text = key
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(cursor, sortName string) (reservationCursor, error) {
+	var c reservationCursor
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil || c.Sort != sortName {
+		return c, fmt.Errorf("%w: cursor %q", ErrInvalidQuery, cursor)
+	}
+	return c, nil
+}
+
+// listing is a ReservationQuery checked and made ready to run
+type listing struct {
+	ReservationQuery
+	sort reservationSort
+	// backwards is set when the page is read towards the start of the sort order, from Before
+	backwards bool
+	cursor    *reservationCursor
+	words     []string
+}
+
+func (q ReservationQuery) listing() (listing, error) {
+	l := listing{ReservationQuery: q}
+	if l.Sort == "" {
+		l.Sort = SortArrival
+	}
+	s, ok := reservationSorts[l.Sort]
+	if !ok {
+		return l, fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, l.Sort)
+	}
+	l.sort = s
+
+	if l.Status != "" && l.Status != StatusNew && l.Status != StatusProcessed {
+		return l, fmt.Errorf("%w: unknown status %q", ErrInvalidQuery, l.Status)
+	}
+	if l.Limit <= 0 {
+		l.Limit = DefaultPageSize
+	}
+	if l.Limit > MaxPageSize {
+		l.Limit = MaxPageSize
+	}
+
+	cursor := l.After
+	if l.Before != "" {
+		cursor, l.backwards = l.Before, true
+	}
+	if cursor != "" {
+		c, err := decodeCursor(cursor, l.Sort)
+		if err != nil {
+			return l, err
+		}
+		l.cursor = &c
+	}
+
+	l.words = strings.Fields(strings.ToLower(l.Text))
+	return l, nil
+}
+
+// ascending reports whether the rows are read in ascending order of the sort column
+func (l listing) ascending() bool {
+	return l.sort.desc == l.backwards
+}
+
+// page turns the rows read, one more than the limit when there are more to read, into the page
+func (l listing) page(rows []Reservation, total int) ReservationPage {
+	more := len(rows) > l.Limit
+	if more {
+		rows = rows[:l.Limit]
+	}
+	if l.backwards {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	p := ReservationPage{Reservations: rows, Total: total}
+	if len(rows) == 0 {
+		return p
+	}
+	first, last := rows[0], rows[len(rows)-1]
+	// coming from a cursor, there is a page on the side it came from
+	if (l.backwards && more) || (!l.backwards && l.cursor != nil) {
+		p.Prev = encodeCursor(l.Sort, l.sort, first)
+	}
+	if (!l.backwards && more) || l.backwards {
+		p.Next = encodeCursor(l.Sort, l.sort, last)
+	}
+	return p
+}
+
+// matches reports whether res passes the filters of l, the way the where clause of List does
+func (l listing) matches(res Reservation) bool {
+	if !l.From.IsZero() && !res.EndDate.After(l.From) {
+		return false
+	}
+	if !l.To.IsZero() && !res.StartDate.Before(l.To) {
+		return false
+	}
+	if l.RoomID != 0 && res.RoomID != l.RoomID {
+		return false
+	}
+	if (l.Status == StatusNew && res.Processed != 0) || (l.Status == StatusProcessed && res.Processed == 0) {
+		return false
+	}
+	fields := strings.ToLower(strings.Join([]string{res.Code, res.FirstName, res.LastName, res.Email, res.Phone}, "\x00"))
+	for _, word := range l.words {
+		if !strings.Contains(fields, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// order compares res with the reservation at key and id in the direction the rows of l are read:
+// negative when res comes first
+func (l listing) order(res Reservation, key any, id int) int {
+	c := compareKeys(l.sort.key(res), key)
+	if c == 0 {
+		c = res.ID - id
+	}
+	if !l.ascending() {
+		c = -c
+	}
+	return c
+}
+
+// afterCursor reports whether res comes after the cursor of l in the direction the rows are read
+func (l listing) afterCursor(res Reservation) bool {
+	return l.cursor == nil || l.order(res, l.cursor.key(), l.cursor.ID) > 0
+}
+
+// compareKeys compares two values of a sort column, both times or both strings
+func compareKeys(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		b, _ := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(a, b)
+	}
+	return 0
+}
+
+// likePattern is the like pattern matching text anywhere, with ! escaping the wildcards
+func likePattern(text string) string {
+	return "%" + escapeLike(text) + "%"
+}
+
+// escapeLike escapes the like wildcards in text with !
+func escapeLike(text string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(text)
+}
+
+// List returns the page of reservations q asks for
+func (r *Reservation) List(ctx context.Context, q ReservationQuery) (ReservationPage, error) {
+	l, err := q.listing()
+	if err != nil {
+		return ReservationPage{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	var where []string
+	if !l.From.IsZero() {
+		where = append(where, "r.end_date > "+arg(l.From))
+	}
+	if !l.To.IsZero() {
+		where = append(where, "r.start_date < "+arg(l.To))
+	}
+	if l.RoomID != 0 {
+		where = append(where, "r.room_id = "+arg(l.RoomID))
+	}
+	switch l.Status {
+	case StatusNew:
+		where = append(where, "r.processed = 0")
+	case StatusProcessed:
+		where = append(where, "r.processed <> 0")
+	}
+	for _, word := range l.words {
+		p := arg(likePattern(word))
+		where = append(where, fmt.Sprintf(`(lower(r.code) like %[1]s escape '!' or lower(r.first_name) like %[1]s escape '!'
+			or lower(r.last_name) like %[1]s escape '!' or lower(r.email) like %[1]s escape '!'
+			or lower(r.phone) like %[1]s escape '!')`, p))
+	}
+
+	filter := ""
+	if len(where) > 0 {
+		filter = "where " + strings.Join(where, " and ")
+	}
+
+	var total int
+	err = inDialect(DB).QueryRowContext(ctx, "select count(*) from reservations r "+filter, args...).Scan(&total)
+	if err != nil {
+		return ReservationPage{}, err
+	}
+
+	order, compare := "asc", ">"
+	if !l.ascending() {
+		order, compare = "desc", "<"
+	}
+	if l.cursor != nil {
+		key, id := arg(l.cursor.key()), arg(l.cursor.ID)
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s %[3]s or (%[1]s = %[3]s and r.id %[2]s %[4]s))",
+			l.sort.column, compare, key, id))
+		filter = "where " + strings.Join(where, " and ")
+	}
+
+	query := `
+	select r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+	r.end_date, r.room_id, r.nightly_rate, r.created_at, r.updated_at, r.processed, r.guest_id, rm.id, rm.name
+	from reservations r
+	left join rooms rm on (r.room_id = rm.id)
+	` + filter + `
+	order by ` + l.sort.column + ` ` + order + `, r.id ` + order + `
+	limit ` + arg(l.Limit+1)
+
+	rows, err := inDialect(DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return ReservationPage{}, err
+	}
+	defer rows.Close()
+
+	var reservations []Reservation
+	for rows.Next() {
+		var i Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.NightlyRate,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.GuestID,
+			&i.Room.ID,
+			&i.Room.Name,
+		)
+		if err != nil {
+			return ReservationPage{}, err
+		}
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return ReservationPage{}, err
+	}
+
+	return l.page(reservations, total), nil
+}
@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// listingBackends are the models List is tested on
+var listingBackends = []struct {
+	name   string
+	models func(t *testing.T) Models
+}{
+	{"memory", func(*testing.T) Models { return NewMemory() }},
+	{"sqlite", newSQLite},
+}
+
+// seedListing books the reservations the listing and search tests look for and returns their ids by guest;
+// the codes are fixed so that no text of the tests turns up in one by chance
+func seedListing(t *testing.T, m Models) (map[string]int, int) {
+	t.Helper()
+	ctx := context.Background()
+	generals, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+	majors, _ := m.Rooms.Create(ctx, Room{Name: "Majors Suite"})
+
+	ids := make(map[string]int)
+	for _, res := range []Reservation{
+		{Code: "QWT2K7HPMS", FirstName: "Ann", LastName: "Archer", Email: "ann@example.com", Phone: "555-0101", StartDate: day(3), EndDate: day(5), RoomID: generals},
+		{Code: "XR94VFJC3Y", FirstName: "Bob", LastName: "Baker", Email: "bob@example.com", Phone: "555-0102", StartDate: day(5), EndDate: day(8), RoomID: majors},
+		{Code: "TPK8WX5RHG", FirstName: "Cleo", LastName: "Cooper", Email: "cleo@example.com", Phone: "555-0103", StartDate: day(5), EndDate: day(6), RoomID: generals},
+		{Code: "MVZ3QJ7T2C", FirstName: "Dan", LastName: "Dyer", Email: "dan_d@example.com", Phone: "555-0104", StartDate: day(9), EndDate: day(12), RoomID: majors},
+		{Code: "HJ6YCRW8QP", FirstName: "Eve", LastName: "Archer", Email: "eve@example.com", Phone: "555-0105", StartDate: day(14), EndDate: day(16), RoomID: generals},
+	} {
+		id, err := m.Reservations.Create(ctx, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[res.FirstName] = id
+	}
+	err := m.Reservations.UpdateProcessedStatus(ctx, 1, ids["Bob"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids, generals
+}
+
+func guests(page ReservationPage) []string {
+	var names []string
+	for _, res := range page.Reservations {
+		names = append(names, res.FirstName)
+	}
+	return names
+}
+
+func TestReservations_ListFilters(t *testing.T) {
+	for _, backend := range listingBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			m := backend.models(t)
+			_, generals := seedListing(t, m)
+
+			tests := []struct {
+				name  string
+				query ReservationQuery
+				want  []string
+			}{
+				{"everything by arrival", ReservationQuery{}, []string{"ann", "bob", "cleo", "dan", "eve"}},
+				{"latest arrival first", ReservationQuery{Sort: SortArrivalDesc}, []string{"eve", "dan", "cleo", "bob", "ann"}},
+				{"latest booking first", ReservationQuery{Sort: SortBookedDesc}, []string{"eve", "dan", "cleo", "bob", "ann"}},
+				{"by guest", ReservationQuery{Sort: SortGuest}, []string{"ann", "eve", "bob", "cleo", "dan"}},
+				{"staying in a period", ReservationQuery{From: day(5), To: day(9)}, []string{"bob", "cleo"}},
+				{"leaving on the first day", ReservationQuery{From: day(4)}, []string{"ann", "bob", "cleo", "dan", "eve"}},
+				{"arriving on the last day", ReservationQuery{To: day(9)}, []string{"ann", "bob", "cleo"}},
+				{"room", ReservationQuery{RoomID: generals}, []string{"ann", "cleo", "eve"}},
+				{"new", ReservationQuery{Status: StatusNew}, []string{"ann", "cleo", "dan", "eve"}},
+				{"processed", ReservationQuery{Status: StatusProcessed}, []string{"bob"}},
+				{"text in any field", ReservationQuery{Text: "ARCHER"}, []string{"ann", "eve"}},
+				{"every word", ReservationQuery{Text: "eve archer"}, []string{"eve"}},
+				{"phone", ReservationQuery{Text: "0103"}, []string{"cleo"}},
+				{"wildcards are text", ReservationQuery{Text: "_"}, []string{"dan"}},
+				{"nothing", ReservationQuery{Text: "zed"}, nil},
+			}
+			for _, tt := range tests {
+				page, err := m.Reservations.List(context.Background(), tt.query)
+				if err != nil {
+					t.Fatalf("%s: %s", tt.name, err)
+				}
+				if got := guests(page); !reflect.DeepEqual(got, tt.want) || page.Total != len(tt.want) {
+					t.Errorf("%s: expected %v, got %v of %d", tt.name, tt.want, got, page.Total)
+				}
+			}
+		})
+	}
+}
+
+func TestReservations_ListPages(t *testing.T) {
+	for _, backend := range listingBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := backend.models(t)
+			seedListing(t, m)
+
+			// ann and bob arrive on different days, bob and cleo on the same day; the id orders them
+			query := ReservationQuery{Limit: 2}
+			var pages [][]string
+			var last ReservationPage
+			for {
+				page, err := m.Reservations.List(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page.Total != 5 {
+					t.Errorf("expected a total of 5, got %d", page.Total)
+				}
+				pages = append(pages, guests(page))
+				last = page
+				if page.Next == "" {
+					break
+				}
+				query.After = page.Next
+			}
+			want := [][]string{{"ann", "bob"}, {"cleo", "dan"}, {"eve"}}
+			if !reflect.DeepEqual(pages, want) {
+				t.Fatalf("expected pages %v, got %v", want, pages)
+			}
+
+			// and back from the last page
+			query = ReservationQuery{Limit: 2, Before: last.Prev}
+			page, err := m.Reservations.List(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := guests(page); !reflect.DeepEqual(got, []string{"cleo", "dan"}) || page.Prev == "" || page.Next == "" {
+				t.Errorf("expected the middle page with both cursors, got %v %+v", got, page)
+			}
+			page, _ = m.Reservations.List(ctx, ReservationQuery{Limit: 2, Before: page.Prev})
+			if got := guests(page); !reflect.DeepEqual(got, []string{"ann", "bob"}) || page.Prev != "" {
+				t.Errorf("expected the first page without a previous one, got %v %+v", got, page)
+			}
+
+			// descending pages
+			page, _ = m.Reservations.List(ctx, ReservationQuery{Limit: 2, Sort: SortArrivalDesc})
+			page, _ = m.Reservations.List(ctx, ReservationQuery{Limit: 2, Sort: SortArrivalDesc, After: page.Next})
+			if got := guests(page); !reflect.DeepEqual(got, []string{"cleo", "bob"}) {
+				t.Errorf("expected the second page latest first, got %v", got)
+			}
+
+			// a cursor belongs to its sort
+			_, err = m.Reservations.List(ctx, ReservationQuery{Limit: 2, Sort: SortGuest, After: page.Next})
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("expected ErrInvalidQuery for a cursor of another sort, got %v", err)
+			}
+			_, err = m.Reservations.List(ctx, ReservationQuery{After: "not a cursor"})
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("expected ErrInvalidQuery for a made up cursor, got %v", err)
+			}
+		})
+	}
+}
@@ -2,17 +2,29 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log"
 	"time"
 )
 
+// restriction types
+const (
+	RestrictionReservation = "reservation" // a guest booked the room with us
+	RestrictionOwner       = "owner"       // the owner blocked the room, e.g. for cleaning or maintenance
+	RestrictionExternal    = "external"    // the room was booked on another platform, see ICalImport
+)
+
 // Restriction represents a booking for a room for a given date range
 type Restriction struct {
 	ID            int
+	Type          string
 	StartDate     time.Time
 	EndDate       time.Time
 	RoomID        int
 	ReservationID int
+	ICalImportID  int
+	ExternalUID   string
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room
@@ -26,40 +38,135 @@ func (r *Restriction) Table() string {
 // Create inserts a restriction into the database
 // restrictions are used to block out dates when a room is not available
 // for example, when a room is booked or being cleaned or maintained
-func (r *Restriction) Create(restrict Restriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+//
+// when Type is empty it is derived from ReservationID. It returns the id of the new restriction
+func (r *Restriction) Create(ctx context.Context, restrict Restriction) (int, error) {
+	var id int
+	err := transaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		id, err = r.create(ctx, tx, restrict)
+		return err
+	})
+	return id, err
+}
+
+// CreateTx inserts a restriction as part of tx
+func (r *Restriction) CreateTx(ctx context.Context, tx *Tx, restrict Restriction) (int, error) {
+	return r.create(ctx, tx.sql, restrict)
+}
+
+func (r *Restriction) create(ctx context.Context, q dbtx, restrict Restriction) (int, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	query := `insert into restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at)
-             values ($1, $2, $3, $4, $5, $6)`
+	if restrict.Type == "" {
+		restrict.Type = RestrictionOwner
+		if restrict.ReservationID > 0 {
+			restrict.Type = RestrictionReservation
+		}
+	}
 
-	_, err := DB.ExecContext(ctx, query,
+	query := `insert into restrictions (restriction_type, start_date, end_date, room_id, reservation_id,
+             ical_import_id, external_uid, created_at, updated_at)
+             values ($1, $2, $3, $4, nullif($5, 0), nullif($6, 0), nullif($7, ''), $8, $9)`
+	id, err := insertID(ctx, q, query,
+		restrict.Type,
 		restrict.StartDate,
 		restrict.EndDate,
 		restrict.RoomID,
 		restrict.ReservationID,
+		restrict.ICalImportID,
+		restrict.ExternalUID,
 		time.Now(),
 		time.Now(),
 	)
 	if err != nil {
-		return nil
+		return 0, err
 	}
-	return nil
+
+	err = audit(ctx, q, AuditCreate, r.Table(), id, restrict.ReservationID, nil, restrictionFields(restrict))
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// get returns the restriction with the given id on q, which the changes read before they are made
+func (r *Restriction) get(ctx context.Context, q dbtx, id int) (Restriction, error) {
+	query := `
+		select id, restriction_type, start_date, end_date, room_id, coalesce(reservation_id, 0),
+		coalesce(ical_import_id, 0), coalesce(external_uid, '')
+		from restrictions
+		where id = $1
+`
+	var rest Restriction
+	err := inDialect(q).QueryRowContext(ctx, query, id).Scan(
+		&rest.ID,
+		&rest.Type,
+		&rest.StartDate,
+		&rest.EndDate,
+		&rest.RoomID,
+		&rest.ReservationID,
+		&rest.ICalImportID,
+		&rest.ExternalUID,
+	)
+	return rest, err
 }
 
 // GetForRoom returns all restrictions for a given room
-func (r *Restriction) GetForRoom(start, end time.Time, roomID int) ([]Restriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Restriction) GetForRoom(ctx context.Context, start, end time.Time, roomID int) ([]Restriction, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var restrictions []Restriction
 
 	query := ` 
-		select id, reservation_id, room_id, start_date, end_date
+		select id, restriction_type, coalesce(reservation_id, 0), room_id, start_date, end_date
 		from restrictions 
 		where $1 < end_date and $2 >= start_date and room_id = $3 
 `
-	rows, err := DB.QueryContext(ctx, query, start, end, roomID)
+	rows, err := inDialect(DB).QueryContext(ctx, query, start, end, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rest Restriction
+		err := rows.Scan(
+			&rest.ID,
+			&rest.Type,
+			&rest.ReservationID,
+			&rest.RoomID,
+			&rest.StartDate,
+			&rest.EndDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, rest)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// GetAllForRoom returns every restriction of a room, oldest first
+func (r *Restriction) GetAllForRoom(ctx context.Context, roomID int) ([]Restriction, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var restrictions []Restriction
+
+	query := `
+		select id, restriction_type, coalesce(reservation_id, 0), room_id, start_date, end_date, created_at, updated_at
+		from restrictions
+		where room_id = $1
+		order by start_date asc
+`
+	rows, err := inDialect(DB).QueryContext(ctx, query, roomID)
 	if err != nil {
 		return nil, err
 	}
@@ -67,16 +174,21 @@ func (r *Restriction) GetForRoom(start, end time.Time, roomID int) ([]Restrictio
 
 	for rows.Next() {
 		var rest Restriction
+		var updatedAt sql.NullTime
 		err := rows.Scan(
 			&rest.ID,
+			&rest.Type,
 			&rest.ReservationID,
 			&rest.RoomID,
 			&rest.StartDate,
 			&rest.EndDate,
+			&rest.CreatedAt,
+			&updatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		rest.UpdatedAt = updatedAt.Time
 		restrictions = append(restrictions, rest)
 	}
 	if err = rows.Err(); err != nil {
@@ -86,16 +198,118 @@ func (r *Restriction) GetForRoom(start, end time.Time, roomID int) ([]Restrictio
 	return restrictions, nil
 }
 
-func (r *Restriction) Delete(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetForImport returns the restrictions created by a calendar import
+func (r *Restriction) GetForImport(ctx context.Context, importID int) ([]Restriction, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
+	var restrictions []Restriction
+
+	query := `
+		select id, restriction_type, room_id, start_date, end_date, ical_import_id, external_uid, created_at, updated_at
+		from restrictions
+		where ical_import_id = $1
+`
+	rows, err := inDialect(DB).QueryContext(ctx, query, importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rest Restriction
+		var updatedAt sql.NullTime
+		err := rows.Scan(
+			&rest.ID,
+			&rest.Type,
+			&rest.RoomID,
+			&rest.StartDate,
+			&rest.EndDate,
+			&rest.ICalImportID,
+			&rest.ExternalUID,
+			&rest.CreatedAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rest.UpdatedAt = updatedAt.Time
+		restrictions = append(restrictions, rest)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// UpdateDates moves a restriction to a new date range
+func (r *Restriction) UpdateDates(ctx context.Context, id int, start, end time.Time) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		return r.updateDates(ctx, tx, id, start, end)
+	})
+}
+
+// UpdateDatesTx moves a restriction to a new date range as part of tx
+func (r *Restriction) UpdateDatesTx(ctx context.Context, tx *Tx, id int, start, end time.Time) error {
+	return r.updateDates(ctx, tx.sql, id, start, end)
+}
+
+func (r *Restriction) updateDates(ctx context.Context, q dbtx, id int, start, end time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	before, err := r.get(ctx, q, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `update restrictions set start_date = $1, end_date = $2, updated_at = $3 where id = $4`
+
+	_, err = inDialect(q).ExecContext(ctx, query, start, end, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.StartDate = start
+	after.EndDate = end
+	return audit(ctx, q, AuditUpdate, r.Table(), id, before.ReservationID,
+		restrictionFields(before), restrictionFields(after))
+}
+
+func (r *Restriction) Delete(ctx context.Context, id int) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		return r.delete(ctx, tx, id)
+	})
+}
+
+// DeleteTx deletes a restriction as part of tx
+func (r *Restriction) DeleteTx(ctx context.Context, tx *Tx, id int) error {
+	return r.delete(ctx, tx.sql, id)
+}
+
+func (r *Restriction) delete(ctx context.Context, q dbtx, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	before, err := r.get(ctx, q, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
 	query := `delete from restrictions where id = $1`
 
-	_, err := DB.ExecContext(ctx, query, id)
+	_, err = inDialect(q).ExecContext(ctx, query, id)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	return nil
+	return audit(ctx, q, AuditDelete, r.Table(), id, before.ReservationID, restrictionFields(before), nil)
 }
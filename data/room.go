@@ -2,16 +2,22 @@ package data
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"time"
 )
 
+// ErrRoomNotAvailable is returned when a room is booked for some of the nights of a new booking
+var ErrRoomNotAvailable = errors.New("data: room is not available for these dates")
+
 // Room represent rooms table in the database
 type Room struct {
-	ID        int
-	Name      string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          int
+	Name        string
+	NightlyRate int // in cents
+	ICalToken   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 func (r *Room) Table() string {
@@ -19,32 +25,34 @@ func (r *Room) Table() string {
 }
 
 // Create inserts a room into the database
-func (r *Room) Create(room Room) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Room) Create(ctx context.Context, room Room) (int, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	room.Name = strings.ToLower(room.Name)
 
-	var newID int
-	query := `insert into rooms (name, created_at, updated_at) values($1, $2, $3) returning id`
-	err := DB.QueryRowContext(ctx, query,
-		room.Name,
-		time.Now(),
-		time.Now()).Scan(&newID)
+	token, err := randomHex(16)
 	if err != nil {
 		return 0, err
 	}
-	return newID, nil
+
+	query := `insert into rooms (name, nightly_rate, ical_token, created_at, updated_at) values($1, $2, $3, $4, $5)`
+	return insertID(ctx, DB, query,
+		room.Name,
+		room.NightlyRate,
+		token,
+		time.Now(),
+		time.Now())
 }
 
 // GetAll returns all rooms from the database
-func (r *Room) GetAll() ([]Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Room) GetAll(ctx context.Context) ([]Room, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var rooms []Room
 
-	rows, err := DB.QueryContext(ctx, "SELECT * FROM rooms ORDER BY name")
+	rows, err := inDialect(DB).QueryContext(ctx, "select id, name, nightly_rate, ical_token, created_at, updated_at from rooms order by name")
 	if err != nil {
 		return rooms, err
 	}
@@ -55,6 +63,8 @@ func (r *Room) GetAll() ([]Room, error) {
 		err := rows.Scan(
 			&room.ID,
 			&room.Name,
+			&room.NightlyRate,
+			&room.ICalToken,
 			&room.CreatedAt,
 			&room.UpdatedAt,
 		)
@@ -71,18 +81,20 @@ func (r *Room) GetAll() ([]Room, error) {
 }
 
 // GetById returns a room by id
-func (r *Room) GetById(id int) (Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Room) GetById(ctx context.Context, id int) (Room, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var room Room
 
-	query := ` select id, name, created_at, updated_at from rooms where id=$1`
+	query := ` select id, name, nightly_rate, ical_token, created_at, updated_at from rooms where id=$1`
 
-	row := DB.QueryRowContext(ctx, query, id)
+	row := inDialect(DB).QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&room.ID,
 		&room.Name,
+		&room.NightlyRate,
+		&room.ICalToken,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
@@ -95,20 +107,48 @@ func (r *Room) GetById(id int) (Room, error) {
 }
 
 // GetByName returns a room by name
-func (r *Room) GetByName(name string) (Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Room) GetByName(ctx context.Context, name string) (Room, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	name = strings.ToLower(name)
 
 	var room Room
 
-	query := ` select id, room_name, created_at, updated_at from rooms where name=$1`
+	query := ` select id, name, nightly_rate, ical_token, created_at, updated_at from rooms where name=$1`
+
+	row := inDialect(DB).QueryRowContext(ctx, query, name)
+	err := row.Scan(
+		&room.ID,
+		&room.Name,
+		&room.NightlyRate,
+		&room.ICalToken,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	)
+
+	if err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// GetByICalToken returns the room whose calendar feed uses token
+func (r *Room) GetByICalToken(ctx context.Context, token string) (Room, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var room Room
+
+	query := ` select id, name, nightly_rate, ical_token, created_at, updated_at from rooms where ical_token=$1`
 
-	row := DB.QueryRowContext(ctx, query, name)
+	row := inDialect(DB).QueryRowContext(ctx, query, token)
 	err := row.Scan(
 		&room.ID,
 		&room.Name,
+		&room.NightlyRate,
+		&room.ICalToken,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
@@ -120,11 +160,61 @@ func (r *Room) GetByName(name string) (Room, error) {
 	return room, nil
 }
 
+// RegenerateICalToken gives the room a new calendar feed token, so the old feed url stops working
+func (r *Room) RegenerateICalToken(ctx context.Context, id int) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = inDialect(DB).ExecContext(ctx, "update rooms set ical_token=$1, updated_at=$2 where id=$3", token, time.Now(), id)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// UpdateNightlyRate sets the price of one night in the room, in cents; existing reservations keep their rate
+func (r *Room) UpdateNightlyRate(ctx context.Context, id, rate int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := inDialect(DB).ExecContext(ctx, "update rooms set nightly_rate=$1, updated_at=$2 where id=$3", rate, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // IsAvailable checks if a room is available for a given time period
 //
 // if the desired range does not overlap with any restriction, the room is available
-func (r *Room) IsAvailable(roomID int, start, end time.Time) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *Room) IsAvailable(ctx context.Context, roomID int, start, end time.Time) (bool, error) {
+	return r.isAvailable(ctx, DB, roomID, start, end)
+}
+
+// IsAvailableTx is IsAvailable as part of tx. It locks the room until tx ends, so two bookings of the same room
+// wait for each other instead of both finding it free
+func (r *Room) IsAvailableTx(ctx context.Context, tx *Tx, roomID int, start, end time.Time) (bool, error) {
+	// SQLite has no row locks; its transactions take the write lock as they begin, see SQLiteDSN
+	if dialect != SQLite {
+		lockCtx, cancel := withTimeout(ctx)
+		defer cancel()
+
+		var id int
+		err := inDialect(tx.sql).QueryRowContext(lockCtx, "select id from rooms where id = $1 for update", roomID).Scan(&id)
+		if err != nil {
+			return false, err
+		}
+	}
+	return r.isAvailable(ctx, tx.sql, roomID, start, end)
+}
+
+func (r *Room) isAvailable(ctx context.Context, q dbtx, roomID int, start, end time.Time) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var count int
@@ -138,7 +228,7 @@ func (r *Room) IsAvailable(roomID int, start, end time.Time) (bool, error) {
 			      room_id = $1
 				and ($2 < end_date and $3 > start_date)`
 
-	row := DB.QueryRowContext(ctx, query, roomID, start, end)
+	row := inDialect(q).QueryRowContext(ctx, query, roomID, start, end)
 	err := row.Scan(&count)
 	if err != nil {
 		return false, err
@@ -151,16 +241,16 @@ func (r *Room) IsAvailable(roomID int, start, end time.Time) (bool, error) {
 }
 
 // GetAnyAvailable returns zero or more rooms that are available for a given time period
-func (r *Room) GetAnyAvailable(start, end time.Time) ([]Room, error) {
+func (r *Room) GetAnyAvailable(ctx context.Context, start, end time.Time) ([]Room, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var rooms []Room
 
 	query := `
 		select 
-			r.id, r.name
+			r.id, r.name, r.nightly_rate
 		from
 			rooms r
 		where r.id not in 
@@ -171,7 +261,7 @@ func (r *Room) GetAnyAvailable(start, end time.Time) ([]Room, error) {
 			where 
 			$1 < rest.end_date and $2 > rest.start_date)`
 
-	rows, err := DB.QueryContext(ctx, query, start, end)
+	rows, err := inDialect(DB).QueryContext(ctx, query, start, end)
 	if err != nil {
 		return rooms, err
 	}
@@ -183,6 +273,7 @@ func (r *Room) GetAnyAvailable(start, end time.Time) ([]Room, error) {
 		err := rows.Scan(
 			&room.ID,
 			&room.Name,
+			&room.NightlyRate,
 		)
 		if err != nil {
 			return rooms, err
@@ -0,0 +1,17 @@
+package data
+
+import "net/url"
+
+// SQLiteDSN returns the connection string of the SQLite database in file, for the modernc.org/sqlite driver.
+// Foreign keys are checked, a writer waits up to five seconds for the one before it, and a transaction takes
+// the write lock when it begins rather than failing when it first writes. Times are written as text that
+// sorts like them and is read back as time.Time
+func SQLiteDSN(file string) string {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_txlock", "immediate")
+	params.Add("_time_format", "sqlite")
+	return "file:" + file + "?" + params.Encode()
+}
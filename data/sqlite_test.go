@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newSQLite returns the models on a new SQLite database with the schema of migrations/sqlite
+func newSQLite(t *testing.T) Models {
+	t.Helper()
+	pool, err := sql.Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "booking.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pool.Close() })
+
+	files, err := filepath.Glob("../migrations/sqlite/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no sqlite migrations: %v", err)
+	}
+	for _, file := range files {
+		schema, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(string(schema)); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+	}
+
+	t.Setenv("DATABASE_TYPE", "sqlite")
+	m := New(pool)
+	t.Cleanup(func() { DB, dialect = nil, Postgres })
+	return m
+}
+
+func TestSQLite_Availability(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLite(t)
+
+	generals, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+	majors, _ := m.Rooms.Create(ctx, Room{Name: "Majors Suite"})
+	// times in another zone are stored in UTC, next to the dates of the searches
+	local := time.FixedZone("UTC+3", 3*60*60)
+	_, err := m.Restrictions.Create(ctx, Restriction{RoomID: generals, StartDate: day(10).In(local), EndDate: day(13).In(local)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		available  bool
+	}{
+		{"before", day(5), day(10), true},
+		{"after", day(13), day(15), true},
+		{"inside", day(11), day(12), false},
+		{"same dates", day(10), day(13), false},
+		{"overlapping the start", day(8), day(11), false},
+		{"overlapping the end", day(12), day(14), false},
+		{"around", day(9), day(14), false},
+	}
+	for _, tt := range tests {
+		available, err := m.Rooms.IsAvailable(ctx, generals, tt.start, tt.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if available != tt.available {
+			t.Errorf("%s: expected available %v, got %v", tt.name, tt.available, available)
+		}
+
+		rooms, err := m.Rooms.GetAnyAvailable(ctx, tt.start, tt.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 1
+		if tt.available {
+			want = 2
+		}
+		if len(rooms) != want || rooms[len(rooms)-1].ID != majors {
+			t.Errorf("%s: expected %d free rooms, got %+v", tt.name, want, rooms)
+		}
+	}
+
+	restrictions, err := m.Restrictions.GetForRoom(ctx, day(1), day(10), generals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 1 || !restrictions[0].StartDate.Equal(day(10)) || !restrictions[0].EndDate.Equal(day(13)) {
+		t.Errorf("expected the owner block, got %+v", restrictions)
+	}
+}
+
+func TestSQLite_Reservations(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLite(t)
+
+	room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+	id, err := m.Reservations.Create(ctx, Reservation{
+		FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Phone: "555-0100",
+		StartDate: day(10), EndDate: day(12), RoomID: room,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Restrictions.Create(ctx, Restriction{RoomID: room, ReservationID: id, StartDate: day(10), EndDate: day(12)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := m.Reservations.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code == "" || res.Room.ID != room || !res.StartDate.Equal(day(10)) || res.Nights() != 2 {
+		t.Errorf("unexpected reservation %+v", res)
+	}
+	if byCode, err := m.Reservations.GetByCode(ctx, res.Code); err != nil || byCode.ID != id {
+		t.Errorf("expected to find the reservation by code, got %+v, %v", byCode, err)
+	}
+
+	// a returning guest books again, under the same profile
+	again, err := m.Reservations.Create(ctx, Reservation{Email: "Jane@Example.com", Phone: "555-0199", RoomID: room})
+	if err != nil {
+		t.Fatalf("expected a second booking with the same email, got %v", err)
+	}
+	if second, _ := m.Reservations.GetByID(ctx, again); second.GuestID == 0 || second.GuestID != res.GuestID {
+		t.Errorf("expected both bookings to have guest %d, got %d", res.GuestID, second.GuestID)
+	}
+
+	// the restriction goes with the reservation, by its foreign key
+	err = m.Reservations.Delete(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Reservations.GetByID(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+	if available, _ := m.Rooms.IsAvailable(ctx, room, day(10), day(12)); !available {
+		t.Error("deleting the reservation should free the room")
+	}
+}
+
+func TestSQLite_TransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLite(t)
+	room, _ := m.Rooms.Create(ctx, Room{Name: "Generals Quarters"})
+
+	failed := errors.New("mail server on fire")
+	err := m.Transaction(ctx, func(tx *Tx) error {
+		id, err := m.Reservations.CreateTx(ctx, tx, Reservation{Email: "a@example.com", Phone: "1", RoomID: room})
+		if err != nil {
+			return err
+		}
+		_, err = m.Restrictions.CreateTx(ctx, tx, Restriction{RoomID: room, ReservationID: id, StartDate: day(1), EndDate: day(3)})
+		if err != nil {
+			return err
+		}
+		_, err = m.Outbox.InsertTx(ctx, tx, OutboxMessage{To: "a@example.com"})
+		if err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the error of the transaction, got %v", err)
+	}
+
+	reservations, _ := m.Reservations.GetAll(ctx)
+	if len(reservations) != 0 {
+		t.Errorf("expected the reservation to be rolled back, got %+v", reservations)
+	}
+	if available, _ := m.Rooms.IsAvailable(ctx, room, day(1), day(3)); !available {
+		t.Error("expected the restriction to be rolled back")
+	}
+	if recent, _ := m.Outbox.GetRecent(ctx, "", 10); len(recent) != 0 {
+		t.Errorf("expected the mail to be rolled back, got %+v", recent)
+	}
+}
+
+func TestSQLite_Outbox(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLite(t)
+
+	first, _ := m.Outbox.Insert(ctx, OutboxMessage{To: "a@example.com", Attachments: []Attachment{{Name: "a.ics", Content: []byte("BEGIN")}}})
+	second, _ := m.Outbox.Insert(ctx, OutboxMessage{To: "b@example.com"})
+
+	err := m.Outbox.MarkAttemptFailed(ctx, first, 1, "timeout", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := m.Outbox.GetDue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].ID != second {
+		t.Errorf("expected only the second message to be due, got %+v", due)
+	}
+
+	_ = m.Outbox.MarkSent(ctx, second, 1)
+	_ = m.Outbox.MarkAttemptFailed(ctx, first, 8, "timeout", time.Time{})
+	counts, _ := m.Outbox.CountByStatus(ctx)
+	if counts[OutboxSent] != 1 || counts[OutboxDead] != 1 || counts[OutboxPending] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+
+	_ = m.Outbox.Requeue(ctx, first)
+	recent, _ := m.Outbox.GetRecent(ctx, OutboxPending, 10)
+	if len(recent) != 1 || recent[0].ID != first || recent[0].Attempts != 0 || len(recent[0].Attachments) != 1 {
+		t.Errorf("expected the dead letter to be pending again, got %+v", recent)
+	}
+}
+
+func TestSQLite_Users(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLite(t)
+
+	id, err := m.Users.Insert(ctx, User{FirstName: "Ada", LastName: "Admin", Email: "admin@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, token, err := m.Users.Authenticate(ctx, "admin@example.com", "secret")
+	if err != nil || got != id || token == "" {
+		t.Errorf("expected to log in, got %d, %v", got, err)
+	}
+	if _, _, err := m.Users.Authenticate(ctx, "admin@example.com", "wrong"); err == nil {
+		t.Error("expected a wrong password to fail")
+	}
+}
@@ -0,0 +1,44 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+)
+
+// dbtx is what *sql.DB and *sql.Tx have in common, so the same query runs inside a transaction or not
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Tx is a transaction of the models, see Models.Transaction. The Tx methods of the repositories write as part of it
+type Tx struct {
+	sql *sql.Tx // nil for the in-memory models, whose transaction holds their tables
+}
+
+// Transaction runs fn in a transaction of the models. It commits when fn returns nil and rolls back otherwise,
+// or when ctx ends first
+func (m Models) Transaction(ctx context.Context, fn func(tx *Tx) error) error {
+	if m.memory != nil {
+		return m.memory.transaction(ctx, fn)
+	}
+	return transaction(ctx, func(tx *sql.Tx) error {
+		return fn(&Tx{sql: tx})
+	})
+}
+
+// transaction runs fn in a database transaction, for the sql models that write more than one row at once
+func transaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"github.com/ahmedkhaeld/jazz"
 	"golang.org/x/crypto/bcrypt"
@@ -9,6 +10,12 @@ import (
 	"time"
 )
 
+// access levels of the staff users
+const (
+	AccessStaff = 1 // every staff user, the default
+	AccessAdmin = 3 // may also hand out api keys with the admin scope
+)
+
 // User is the user model
 type User struct {
 	ID          int
@@ -34,44 +41,15 @@ func (u *User) Validate(v *jazz.Validation) {
 
 }
 
-func (u *User) Insert(user User) (int, error) {
-
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
-	if err != nil {
-		return 0, err
-	}
-	hashStr := string(hash)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	//forcefully store emails by lowercase
-	user.Email = strings.ToLower(u.Email)
-
-	query := `insert into users (first_name, last_name, email, 
-			password, created_at, updated_at, access_level)
-            values ($1, $2, $3, $4, $5, $6, $7)`
-
-	result, err := DB.ExecContext(ctx, query,
-		user.FirstName,
-		user.LastName,
-		user.Email,
-		hashStr,
-		time.Now(),
-		time.Now(),
-		user.AccessLevel,
-	)
-	if err != nil {
-		return 0, err
-	}
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-	return int(id), nil
+func (u *User) Insert(ctx context.Context, user User) (int, error) {
+	return u.insert(ctx, user)
+}
 
+func (u *User) InsertAndReturnId(ctx context.Context, user User) (int, error) {
+	return u.insert(ctx, user)
 }
-func (u *User) InsertAndReturnId(user User) (int, error) {
+
+func (u *User) insert(ctx context.Context, user User) (int, error) {
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
 	if err != nil {
@@ -79,38 +57,42 @@ func (u *User) InsertAndReturnId(user User) (int, error) {
 	}
 	hashStr := string(hash)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	//forcefully store emails by lowercase
+	user.Email = strings.ToLower(user.Email)
 
-	var newID int
 	query := `insert into users (first_name, last_name, email, 
 			password, created_at, updated_at, access_level)
             values ($1, $2, $3, $4, $5, $6, $7)`
 
-	//forcefully store emails by lowercase
-	user.Email = strings.ToLower(u.Email)
-
-	err = DB.QueryRowContext(ctx, query,
-		user.FirstName,
-		user.LastName,
-		user.Email,
-		hashStr,
-		time.Now(),
-		time.Now(),
-		user.AccessLevel).Scan(&newID)
+	err = transaction(ctx, func(tx *sql.Tx) error {
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
+
+		user.ID, err = insertID(ctx, tx, query,
+			user.FirstName,
+			user.LastName,
+			user.Email,
+			hashStr,
+			time.Now(),
+			time.Now(),
+			user.AccessLevel)
+		if err != nil {
+			return err
+		}
+		return audit(ctx, tx, AuditCreate, u.Table(), user.ID, 0, nil, userFields(user))
+	})
 	if err != nil {
 		return 0, err
 	}
-	return newID, nil
-
+	return user.ID, nil
 }
 
-func (u *User) SelectAll() ([]User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (u *User) SelectAll(ctx context.Context) ([]User, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	var users []User
 
-	rows, err := DB.QueryContext(ctx, "SELECT * FROM users ORDER BY last_name, first_name")
+	rows, err := inDialect(DB).QueryContext(ctx, "SELECT * FROM users ORDER BY last_name, first_name")
 	if err != nil {
 		return users, err
 	}
@@ -133,50 +115,35 @@ func (u *User) SelectAll() ([]User, error) {
 	}
 	return users, nil
 }
-func (u *User) Count() (int, error) {
+func (u *User) Count(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	err := inDialect(DB).QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
 	if err != nil {
 		return count, err
 	}
 	return count, nil
 }
 
-func (u *User) GetByID(id int) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at 
-			from users where id=$1`
-
-	row := DB.QueryRowContext(ctx, query, id)
-	var user User
-	err := row.Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.AccessLevel,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err != nil {
-		return user, err
-	}
-	return user, nil
+func (u *User) GetByID(ctx context.Context, id int) (User, error) {
+	return u.get(ctx, DB, "id=$1", id)
+}
 
+func (u *User) GetByEmail(ctx context.Context, email string) (User, error) {
+	return u.get(ctx, DB, "email=$1", strings.ToLower(email))
 }
-func (u *User) GetByEmail(email string) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	email = strings.ToLower(email)
+// get returns the user matching where on q, which the changes read before they are made
+func (u *User) get(ctx context.Context, q dbtx, where string, args ...any) (User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
 
 	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at 
-			from users where email=$1`
+			from users where ` + where
 
-	row := DB.QueryRowContext(ctx, query, email)
+	row := inDialect(q).QueryRowContext(ctx, query, args...)
 	var user User
 	err := row.Scan(
 		&user.ID,
@@ -195,29 +162,41 @@ func (u *User) GetByEmail(email string) (User, error) {
 
 }
 
-func (u *User) Update(user User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (u *User) Update(ctx context.Context, user User) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
 
-	query := `
-		update users set first_name=$1, last_name=$2, email=$3, access_level=$4, updated_at=$5`
+		before, err := u.get(ctx, tx, "id=$1", user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 
-	_, err := DB.ExecContext(ctx, query,
-		user.FirstName,
-		user.LastName,
-		user.Email,
-		user.AccessLevel,
-		time.Now(),
-	)
-	if err != nil {
-		return err
-	}
+		query := `
+		update users set first_name=$1, last_name=$2, email=$3, access_level=$4, updated_at=$5
+		where id=$6`
+
+		_, err = inDialect(tx).ExecContext(ctx, query,
+			user.FirstName,
+			user.LastName,
+			user.Email,
+			user.AccessLevel,
+			time.Now(),
+			user.ID,
+		)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return audit(ctx, tx, AuditUpdate, u.Table(), user.ID, 0, userFields(before), userFields(user))
+	})
 }
 
-func (u *User) Authenticate(email, password string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (u *User) Authenticate(ctx context.Context, email, password string) (int, string, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var id int
@@ -225,7 +204,7 @@ func (u *User) Authenticate(email, password string) (int, string, error) {
 
 	email = strings.ToLower(email)
 
-	row := DB.QueryRowContext(ctx, "SELECT id, password FROM users WHERE email=$1", email)
+	row := inDialect(DB).QueryRowContext(ctx, "SELECT id, password FROM users WHERE email=$1", email)
 	err := row.Scan(&id, &hash)
 	if err != nil {
 		return id, "", err
@@ -242,29 +221,41 @@ func (u *User) Authenticate(email, password string) (int, string, error) {
 
 }
 
-func (u *User) UpdatePassword(user User, newHash []byte) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (u *User) UpdatePassword(ctx context.Context, user User, newHash []byte) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
 
-	hash := string(newHash)
+		hash := string(newHash)
 
-	query := `update users set password=$1 where id=$2`
-	_, err := DB.ExecContext(ctx, query, hash, user.ID)
-	if err != nil {
-		return err
-	}
-	return nil
+		query := `update users set password=$1 where id=$2`
+		_, err := inDialect(tx).ExecContext(ctx, query, hash, user.ID)
+		if err != nil {
+			return err
+		}
+		return audit(ctx, tx, AuditUpdate, u.Table(), user.ID, 0, nil, map[string]any{"password": passwordChanged})
+	})
 
 }
 
-func (u *User) Delete(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (u *User) Delete(ctx context.Context, id int) error {
+	return transaction(ctx, func(tx *sql.Tx) error {
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
 
-	_, err := DB.ExecContext(ctx, "DELETE FROM users WHRE id=$1", id)
-	if err != nil {
-		return err
-	}
+		before, err := u.get(ctx, tx, "id=$1", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = inDialect(tx).ExecContext(ctx, "DELETE FROM users WHERE id=$1", id)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return audit(ctx, tx, AuditDelete, u.Table(), id, 0, userFields(before), nil)
+	})
 }
@@ -0,0 +1,346 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// events a webhook can subscribe to
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationModified  = "reservation.modified"
+	EventReservationCancelled = "reservation.cancelled"
+	EventRestrictionCreated   = "restriction.created"
+)
+
+// AllWebhookEvents lists every event in the order they are shown to staff
+var AllWebhookEvents = []string{
+	EventReservationCreated,
+	EventReservationModified,
+	EventReservationCancelled,
+	EventRestrictionCreated,
+}
+
+// delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// webhookSecretPrefix marks a string as a webhook signing secret
+const webhookSecretPrefix = "whsec_"
+
+// Webhook is an endpoint of another system that wants to hear about events in the app
+type Webhook struct {
+	ID        int
+	URL       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (wh *Webhook) Table() string {
+	return "webhooks"
+}
+
+// Wants reports whether the webhook subscribed to event
+func (wh *Webhook) Wants(event string) bool {
+	for _, e := range wh.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Insert adds a webhook with a new signing secret and returns its id
+func (wh *Webhook) Insert(ctx context.Context, hook Webhook) (int, error) {
+	secret, err := randomHex(24)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	query := `insert into webhooks (url, secret, events, created_at, updated_at)
+			values ($1, $2, $3, $4, $5) returning id`
+	err = DB.QueryRowContext(ctx, query,
+		hook.URL,
+		webhookSecretPrefix+secret,
+		strings.Join(hook.Events, ","),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// GetAll returns every webhook, oldest first
+func (wh *Webhook) GetAll(ctx context.Context) ([]Webhook, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var hooks []Webhook
+
+	query := `select id, url, secret, events, created_at, updated_at from webhooks order by id`
+
+	rows, err := DB.QueryContext(ctx, query)
+	if err != nil {
+		return hooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hook Webhook
+		var events string
+		var updatedAt sql.NullTime
+		err := rows.Scan(
+			&hook.ID,
+			&hook.URL,
+			&hook.Secret,
+			&events,
+			&hook.CreatedAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return hooks, err
+		}
+		hook.Events = splitList(events)
+		hook.UpdatedAt = updatedAt.Time
+		hooks = append(hooks, hook)
+	}
+	if err = rows.Err(); err != nil {
+		return hooks, err
+	}
+
+	return hooks, nil
+}
+
+// GetForEvent returns the webhooks subscribed to event
+func (wh *Webhook) GetForEvent(ctx context.Context, event string) ([]Webhook, error) {
+	hooks, err := wh.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscribed []Webhook
+	for _, hook := range hooks {
+		if hook.Wants(event) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	return subscribed, nil
+}
+
+// GetByID returns a webhook
+func (wh *Webhook) GetByID(ctx context.Context, id int) (Webhook, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var hook Webhook
+	var events string
+	var updatedAt sql.NullTime
+	query := `select id, url, secret, events, created_at, updated_at from webhooks where id = $1`
+	err := DB.QueryRowContext(ctx, query, id).Scan(
+		&hook.ID,
+		&hook.URL,
+		&hook.Secret,
+		&events,
+		&hook.CreatedAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return hook, err
+	}
+	hook.Events = splitList(events)
+	hook.UpdatedAt = updatedAt.Time
+	return hook, nil
+}
+
+// Delete removes a webhook and its delivery log
+func (wh *Webhook) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "delete from webhooks where id = $1", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to one webhook
+type WebhookDelivery struct {
+	ID            int
+	WebhookID     int
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	ResponseCode  int
+	LastError     string
+	DeliveredAt   sql.NullTime
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Webhook       Webhook
+}
+
+func (d *WebhookDelivery) Table() string {
+	return "webhook_deliveries"
+}
+
+// Insert queues a delivery to be sent right away and returns its id
+func (d *WebhookDelivery) Insert(ctx context.Context, delivery WebhookDelivery) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	query := `insert into webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	err := DB.QueryRowContext(ctx, query,
+		delivery.WebhookID,
+		delivery.Event,
+		delivery.Payload,
+		DeliveryPending,
+		time.Now(),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+		d.response_code, d.last_error, d.delivered_at, d.created_at, d.updated_at, w.url, w.secret`
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var updatedAt sql.NullTime
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.ResponseCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+		&updatedAt,
+		&delivery.Webhook.URL,
+		&delivery.Webhook.Secret,
+	)
+	delivery.UpdatedAt = updatedAt.Time
+	delivery.Webhook.ID = delivery.WebhookID
+	return delivery, err
+}
+
+func queryWebhookDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var deliveries []WebhookDelivery
+
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// GetByID returns a delivery with the url and secret of its webhook
+func (d *WebhookDelivery) GetByID(ctx context.Context, id int) (WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d
+		left join webhooks w on (d.webhook_id = w.id)
+		where d.id = $1`
+
+	return scanWebhookDelivery(DB.QueryRowContext(ctx, query, id))
+}
+
+// GetDue returns at most limit pending deliveries whose next attempt is due, oldest first
+func (d *WebhookDelivery) GetDue(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	query := `select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d
+		left join webhooks w on (d.webhook_id = w.id)
+		where d.status = $1 and d.next_attempt_at <= $2
+		order by d.next_attempt_at
+		limit $3`
+
+	return queryWebhookDeliveries(ctx, query, DeliveryPending, time.Now(), limit)
+}
+
+// GetRecent returns the latest limit deliveries, newest first
+func (d *WebhookDelivery) GetRecent(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	query := `select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d
+		left join webhooks w on (d.webhook_id = w.id)
+		order by d.created_at desc, d.id desc
+		limit $1`
+
+	return queryWebhookDeliveries(ctx, query, limit)
+}
+
+// MarkDelivered records a successful attempt
+func (d *WebhookDelivery) MarkDelivered(ctx context.Context, id, attempts, responseCode int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `update webhook_deliveries set status = $1, attempts = $2, response_code = $3, last_error = '',
+			delivered_at = $4, updated_at = $4 where id = $5`
+	_, err := DB.ExecContext(ctx, query, DeliveryDelivered, attempts, responseCode, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkAttemptFailed records a failed attempt. The delivery is retried at next,
+// or marked failed for good when next is zero
+func (d *WebhookDelivery) MarkAttemptFailed(ctx context.Context, id, attempts, responseCode int, lastError string, next time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	status := DeliveryPending
+	if next.IsZero() {
+		status = DeliveryFailed
+		next = time.Now()
+	}
+
+	query := `update webhook_deliveries set status = $1, attempts = $2, response_code = $3, last_error = $4,
+			next_attempt_at = $5, updated_at = $6 where id = $7`
+	_, err := DB.ExecContext(ctx, query, status, attempts, responseCode, lastError, next, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz"
+	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/go-sql-driver/mysql"
+	"github.com/joho/godotenv"
+	_ "modernc.org/sqlite"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// jazz connects to postgres by itself, but it has no connection string for mysql and mariadb and stops the app
+// when it cannot connect. For those hideMySQL keeps the database settings away from jazz.New, and connectMySQL
+// connects afterwards
+
+// hideMySQL blanks DATABASE_TYPE, and SESSION_TYPE when the sessions are kept in the database too, when they
+// name mysql or mariadb. It reads .env first, the way jazz does, and returns the function that restores them
+func hideMySQL(rootPath string) (restore func()) {
+	_ = godotenv.Load(rootPath + "/.env")
+
+	if data.DialectOf(os.Getenv("DATABASE_TYPE")) != data.MySQL {
+		return func() {}
+	}
+
+	hidden := make(map[string]string)
+	for _, key := range []string{"DATABASE_TYPE", "SESSION_TYPE"} {
+		if value := os.Getenv(key); data.DialectOf(value) == data.MySQL {
+			hidden[key] = value
+			// an empty value is not overwritten when jazz reads .env again
+			_ = os.Setenv(key, "")
+		}
+	}
+	return func() {
+		for key, value := range hidden {
+			_ = os.Setenv(key, value)
+		}
+	}
+}
+
+// mysqlConfig is the connection to the MySQL or MariaDB database of DATABASE_HOST, DATABASE_PORT, DATABASE_USER,
+// DATABASE_PASS and DATABASE_NAME
+func mysqlConfig() *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = os.Getenv("DATABASE_USER")
+	cfg.Passwd = os.Getenv("DATABASE_PASS")
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(os.Getenv("DATABASE_HOST"), os.Getenv("DATABASE_PORT"))
+	cfg.DBName = os.Getenv("DATABASE_NAME")
+	// dates are scanned into time.Time and kept in UTC, like on postgres
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.Params = map[string]string{"time_zone": "'+00:00'"}
+	return cfg
+}
+
+// connectMySQL opens the pool to the MySQL or MariaDB database for jazz, and keeps the sessions there when
+// SESSION_TYPE asks for it
+func (a *application) connectMySQL() {
+	pool, err := sql.Open("mysql", mysqlConfig().FormatDSN())
+	if err == nil {
+		err = pool.Ping()
+	}
+	if err != nil {
+		a.ErrorLog.Fatal("error connecting to ", os.Getenv("DATABASE_TYPE"), ": ", err)
+	}
+	pool.SetMaxOpenConns(10)
+	pool.SetMaxIdleConns(5)
+	pool.SetConnMaxLifetime(5 * time.Minute)
+
+	a.DB = jazz.Database{Type: strings.ToLower(os.Getenv("DATABASE_TYPE")), SqlPool: pool}
+	if data.DialectOf(os.Getenv("SESSION_TYPE")) == data.MySQL {
+		a.Session.Store = mysqlstore.New(pool)
+	}
+}
+
+// sqliteFile is the SQLite database file, DATABASE_FILE, default db-data/sqlite/booking.db under the root path
+func (a *application) sqliteFile() string {
+	file := os.Getenv("DATABASE_FILE")
+	if file == "" {
+		file = filepath.Join(a.RootPath, "db-data", "sqlite", "booking.db")
+	}
+	return file
+}
+
+// connectSQLite opens the SQLite database file, creating it and its directory when they are missing. jazz has
+// no SQLite support and leaves its database empty, so the app needs nothing but the file. The file belongs to
+// one instance of the app, since SQLite takes one writer at a time
+func (a *application) connectSQLite() {
+	file := a.sqliteFile()
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		a.ErrorLog.Fatal("error creating the directory of ", file, ": ", err)
+	}
+
+	pool, err := sql.Open("sqlite", data.SQLiteDSN(file))
+	if err == nil {
+		err = pool.Ping()
+	}
+	if err != nil {
+		a.ErrorLog.Fatal("error opening sqlite database ", file, ": ", err)
+	}
+
+	a.DB = jazz.Database{Type: "sqlite", SqlPool: pool}
+	a.InfoLog.Println("using sqlite database", file)
+}
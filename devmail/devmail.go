@@ -0,0 +1,305 @@
+// Package devmail catches the mail of a development setup instead of sending it. Messages are rendered
+// with the templates in mail/ the same way jazz's mailer renders them, and kept in memory or in a
+// directory for the /dev/mail page
+package devmail
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for a message that is not in the store
+var ErrNotFound = errors.New("devmail: no such message")
+
+// Message is a caught message, rendered
+type Message struct {
+	ID          int
+	From        string
+	FromName    string
+	To          string
+	Subject     string
+	Template    string
+	HTML        string
+	Plain       string
+	Attachments []data.Attachment
+	// Error is why the message could not be rendered; a real mailer would have failed to send it
+	Error    string
+	CaughtAt time.Time
+}
+
+// Store keeps caught messages
+type Store interface {
+	Add(msg Message) (Message, error)
+	// List returns the messages, newest first
+	List() ([]Message, error)
+	Get(id int) (Message, error)
+	Clear() error
+}
+
+// Catcher is a mail sender that renders messages and keeps them in a store instead of sending them
+type Catcher struct {
+	Templates string
+	Store     Store
+}
+
+func New(templates string, store Store) *Catcher {
+	return &Catcher{Templates: templates, Store: store}
+}
+
+// Send renders msg and stores it. A message whose template fails is stored with the error and
+// the error returned, so it shows on the page and goes to the dead letters like a real failure
+func (c *Catcher) Send(msg mailer.Message) error {
+	caught := Message{
+		From:     msg.From,
+		FromName: msg.FromName,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Template: msg.Template,
+		CaughtAt: time.Now(),
+	}
+
+	var err error
+	caught.HTML, caught.Plain, err = c.Render(msg)
+	if err != nil {
+		caught.Error = err.Error()
+	}
+
+	for _, path := range msg.Attachments {
+		b, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return readErr
+		}
+		caught.Attachments = append(caught.Attachments, data.Attachment{Name: filepath.Base(path), Content: b})
+	}
+
+	_, storeErr := c.Store.Add(caught)
+	if storeErr != nil {
+		return storeErr
+	}
+	return err
+}
+
+// Render renders the html and plain text of msg. Like jazz's mailer both are html templates,
+// executing the "body" template of <template>.html.tmpl and <template>.plain.tmpl
+func (c *Catcher) Render(msg mailer.Message) (string, string, error) {
+	html, err := c.render(msg.Template+".html.tmpl", msg.Data)
+	if err != nil {
+		return "", "", err
+	}
+	plain, err := c.render(msg.Template+".plain.tmpl", msg.Data)
+	if err != nil {
+		return html, "", err
+	}
+	return html, plain, nil
+}
+
+func (c *Catcher) render(file string, d interface{}) (string, error) {
+	t, err := template.New(file).ParseFiles(filepath.Join(c.Templates, file))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.ExecuteTemplate(&buf, "body", d)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Preview renders msg as it would be sent from the outbox, with its data turned into json and back
+func (c *Catcher) Preview(msg mailer.Message) (Message, error) {
+	b, err := json.Marshal(msg.Data)
+	if err != nil {
+		return Message{}, err
+	}
+	var d map[string]interface{}
+	err = json.Unmarshal(b, &d)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.Data = d
+
+	preview := Message{
+		From:     msg.From,
+		FromName: msg.FromName,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Template: msg.Template,
+		CaughtAt: time.Now(),
+	}
+	preview.HTML, preview.Plain, err = c.Render(msg)
+	if err != nil {
+		preview.Error = err.Error()
+	}
+	return preview, nil
+}
+
+// maxMemoryMessages is how many messages the memory store keeps, the oldest go first
+const maxMemoryMessages = 200
+
+// MemoryStore keeps messages until the app stops
+type MemoryStore struct {
+	mu       sync.Mutex
+	messages []Message
+	lastID   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Add(msg Message) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	msg.ID = s.lastID
+	s.messages = append(s.messages, msg)
+	if len(s.messages) > maxMemoryMessages {
+		s.messages = s.messages[len(s.messages)-maxMemoryMessages:]
+	}
+	return msg, nil
+}
+
+func (s *MemoryStore) List() ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.messages))
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		messages = append(messages, s.messages[i])
+	}
+	return messages, nil
+}
+
+func (s *MemoryStore) Get(id int) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range s.messages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return Message{}, ErrNotFound
+}
+
+func (s *MemoryStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+	return nil
+}
+
+// FileStore keeps each message as a json file in a directory, so they survive restarts
+type FileStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) path(id int) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%08d.json", id))
+}
+
+// ids returns the ids of the stored messages, oldest first
+func (s *FileStore) ids() ([]int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		var id int
+		if _, err := fmt.Sscanf(e.Name(), "%08d.json", &id); err == nil && strings.HasSuffix(e.Name(), ".json") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *FileStore) Add(msg Message) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return msg, err
+	}
+	msg.ID = 1
+	if len(ids) > 0 {
+		msg.ID = ids[len(ids)-1] + 1
+	}
+
+	b, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return msg, err
+	}
+	return msg, os.WriteFile(s.path(msg.ID), b, 0644)
+}
+
+func (s *FileStore) List() ([]Message, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	var messages []Message
+	for i := len(ids) - 1; i >= 0; i-- {
+		msg, err := s.Get(ids[i])
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (s *FileStore) Get(id int) (Message, error) {
+	var msg Message
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return msg, ErrNotFound
+	}
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(b, &msg)
+	return msg, err
+}
+
+func (s *FileStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err := os.Remove(s.path(id))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
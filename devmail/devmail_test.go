@@ -0,0 +1,153 @@
+package devmail
+
+import (
+	"errors"
+	"github.com/ahmedkhaeld/booking/emails"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	fs, err := NewFileStore(filepath.Join(t.TempDir(), "mail"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemoryStore(), "file": fs}
+}
+
+func TestStores(t *testing.T) {
+	for name, store := range testStores(t) {
+		first, err := store.Add(Message{Subject: "first"})
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		second, err := store.Add(Message{Subject: "second"})
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if first.ID == 0 || second.ID <= first.ID {
+			t.Errorf("%s: expected increasing ids, got %d and %d", name, first.ID, second.ID)
+		}
+
+		messages, err := store.List()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if len(messages) != 2 || messages[0].Subject != "second" {
+			t.Errorf("%s: expected the newest message first, got %+v", name, messages)
+		}
+
+		got, err := store.Get(first.ID)
+		if err != nil || got.Subject != "first" {
+			t.Errorf("%s: expected the first message, got %+v, %v", name, got, err)
+		}
+		_, err = store.Get(99)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", name, err)
+		}
+
+		err = store.Clear()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		messages, _ = store.List()
+		if len(messages) != 0 {
+			t.Errorf("%s: expected no messages after clearing, got %d", name, len(messages))
+		}
+	}
+}
+
+func TestMemoryStore_Cap(t *testing.T) {
+	store := NewMemoryStore()
+	for i := 0; i < maxMemoryMessages+5; i++ {
+		_, _ = store.Add(Message{})
+	}
+	messages, _ := store.List()
+	if len(messages) != maxMemoryMessages {
+		t.Fatalf("expected %d messages, got %d", maxMemoryMessages, len(messages))
+	}
+	if messages[len(messages)-1].ID != 6 {
+		t.Errorf("expected the oldest messages to go, the oldest left is %d", messages[len(messages)-1].ID)
+	}
+}
+
+func TestCatcher_Send(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "hello.html.tmpl"), []byte(`{{define "body"}}<p>Hello {{.Name}}</p>{{end}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "hello.plain.tmpl"), []byte(`{{define "body"}}Hello {{.Name}}{{end}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachment := filepath.Join(dir, "stay.ics")
+	err = os.WriteFile(attachment, []byte("BEGIN:VCALENDAR"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(dir, NewMemoryStore())
+	err = c.Send(mailer.Message{
+		To:          "jane@example.com",
+		Subject:     "Hello",
+		Template:    "hello",
+		Attachments: []string{attachment},
+		Data:        map[string]string{"Name": "Jane"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := c.Store.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.HTML != "<p>Hello Jane</p>" || msg.Plain != "Hello Jane" {
+		t.Errorf("unexpected rendering: %q, %q", msg.HTML, msg.Plain)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Name != "stay.ics" || string(msg.Attachments[0].Content) != "BEGIN:VCALENDAR" {
+		t.Errorf("unexpected attachments %+v", msg.Attachments)
+	}
+
+	// a missing template fails like the real mailer, and is kept to show why
+	err = c.Send(mailer.Message{Subject: "Broken", Template: "missing"})
+	if err == nil {
+		t.Error("expected an error for a missing template")
+	}
+	broken, _ := c.Store.Get(2)
+	if broken.Subject != "Broken" || broken.Error == "" {
+		t.Errorf("expected the broken message with its error, got %+v", broken)
+	}
+}
+
+func TestCatcher_PreviewSamples(t *testing.T) {
+	c := New("../mail", NewMemoryStore())
+	config := emails.Config{From: "stay@booking.example", PropertyName: "Fort Smythe", Currency: "USD", TaxName: "Tax", TaxRate: 1000}
+
+	for _, name := range emails.Templates {
+		sample, ok := config.Sample(name)
+		if !ok {
+			t.Fatalf("no sample for %s", name)
+		}
+		msg, err := c.Preview(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Error != "" {
+			t.Errorf("%s: %s", name, msg.Error)
+		}
+		for _, out := range []string{msg.HTML, msg.Plain} {
+			if out == "" || strings.Contains(out, "<no value>") {
+				t.Errorf("%s: unexpected rendering %q", name, out)
+			}
+		}
+	}
+
+	if _, ok := config.Sample("nope"); ok {
+		t.Error("expected no sample for an unknown template")
+	}
+}
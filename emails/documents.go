@@ -0,0 +1,199 @@
+package emails
+
+import (
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/pdf"
+	"strings"
+	"time"
+)
+
+// InvoiceNumber writes an invoice number with the prefix, e.g. INV-000042
+func (c Config) InvoiceNumber(number int) string {
+	return fmt.Sprintf("%s%06d", c.InvoicePrefix, number)
+}
+
+// NewInvoice is the invoice of res as it would be issued now, without a number
+func (c Config) NewInvoice(res data.Reservation) data.Invoice {
+	charges := c.Charges(res)
+	return data.Invoice{
+		ReservationID: res.ID,
+		Code:          res.Code,
+		GuestName:     titleCase(res.FirstName + " " + res.LastName),
+		Email:         res.Email,
+		RoomName:      titleCase(res.Room.Name),
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		NightlyRate:   charges.NightlyRate,
+		Subtotal:      charges.Subtotal,
+		TaxName:       c.TaxName,
+		TaxRate:       c.TaxRate,
+		Tax:           charges.Tax,
+		Total:         charges.Total,
+		Currency:      strings.ToUpper(c.Currency),
+	}
+}
+
+// ConfirmationPDF is the printable confirmation of res
+func (c Config) ConfirmationPDF(res data.Reservation) (data.Attachment, error) {
+	inv := c.NewInvoice(res)
+	b, err := c.document(document{
+		Title:   "Booking confirmation",
+		Date:    time.Now(),
+		Invoice: inv,
+		Note:    "This confirmation is not an invoice.",
+	})
+	if err != nil {
+		return data.Attachment{}, err
+	}
+	return data.Attachment{Name: fmt.Sprintf("confirmation-%s.pdf", res.Code), Content: b}, nil
+}
+
+// InvoicePDF is the printable invoice inv
+func (c Config) InvoicePDF(inv data.Invoice) (data.Attachment, error) {
+	b, err := c.document(document{
+		Title:   "Invoice",
+		Number:  c.InvoiceNumber(inv.Number),
+		Date:    inv.IssuedAt,
+		Invoice: inv,
+		Note:    "Thank you for staying with us.",
+	})
+	if err != nil {
+		return data.Attachment{}, err
+	}
+	return data.Attachment{Name: fmt.Sprintf("invoice-%s.pdf", c.InvoiceNumber(inv.Number)), Content: b}, nil
+}
+
+// document is what a confirmation and an invoice have in common; a confirmation has no number
+type document struct {
+	Title   string
+	Number  string
+	Date    time.Time
+	Invoice data.Invoice
+	Note    string
+}
+
+// layout of the documents, in points
+const (
+	marginLeft   = 50.0
+	marginRight  = pdf.PageWidth - 50
+	pageBottom   = pdf.PageHeight - 70
+	lineHeight   = 16.0
+	rateColumn   = marginRight
+	detailColumn = marginLeft + 110
+)
+
+var (
+	accent = pdf.Color{R: 0.4, G: 0.2, B: 0.6}
+	muted  = pdf.Color{R: 0.33, G: 0.33, B: 0.33}
+	rule   = pdf.Color{R: 0.8, G: 0.8, B: 0.8}
+)
+
+func (c Config) document(doc document) ([]byte, error) {
+	inv := doc.Invoice
+	money := func(cents int) string { return FormatMoney(cents, inv.Currency) }
+
+	title := doc.Title
+	if doc.Number != "" {
+		title += " " + doc.Number
+	}
+	d := pdf.New(fmt.Sprintf("%s - %s", title, c.PropertyName))
+	d.AddPage()
+
+	// the property on the left, the document on the right
+	d.Rect(0, 0, pdf.PageWidth, 8, accent)
+	y := 60.0
+	d.Text(marginLeft, y, pdf.HelveticaBold, 18, accent, c.PropertyName)
+	d.TextRight(marginRight, y, pdf.HelveticaBold, 18, pdf.Black, doc.Title)
+	y += 20
+	for i, line := range c.propertyLines() {
+		d.Text(marginLeft, y+float64(i)*13, pdf.Helvetica, 10, muted, line)
+	}
+	if doc.Number != "" {
+		d.TextRight(marginRight, y, pdf.Helvetica, 10, pdf.Black, "Number "+doc.Number)
+		y += 13
+	}
+	d.TextRight(marginRight, y, pdf.Helvetica, 10, pdf.Black, "Date "+doc.Date.Format("January 2, 2006"))
+
+	// the guest and the stay
+	y = 160
+	details := [][2]string{
+		{"Guest", inv.GuestName},
+		{"Email", inv.Email},
+		{"Confirmation", inv.Code},
+		{"Room", inv.RoomName},
+		{"Arrival", c.stayTime(inv.StartDate, "from", c.CheckIn)},
+		{"Departure", c.stayTime(inv.EndDate, "by", c.CheckOut)},
+		{"Nights", fmt.Sprint(inv.Nights())},
+	}
+	for _, row := range details {
+		d.Text(marginLeft, y, pdf.Helvetica, 10, muted, row[0])
+		d.Text(detailColumn, y, pdf.Helvetica, 10, pdf.Black, row[1])
+		y += lineHeight
+	}
+
+	// a line for each night
+	y += 20
+	d.Text(marginLeft, y, pdf.HelveticaBold, 10, pdf.Black, "Night")
+	d.TextRight(rateColumn, y, pdf.HelveticaBold, 10, pdf.Black, "Rate")
+	y += 6
+	d.Line(marginLeft, y, marginRight, y, 0.5, rule)
+	y += lineHeight
+	for night := inv.StartDate; night.Before(inv.EndDate); night = night.AddDate(0, 0, 1) {
+		if y > pageBottom {
+			d.AddPage()
+			y = 60
+		}
+		d.Text(marginLeft, y, pdf.Helvetica, 10, pdf.Black, night.Format("Monday, January 2, 2006"))
+		d.TextRight(rateColumn, y, pdf.Helvetica, 10, pdf.Black, money(inv.NightlyRate))
+		y += lineHeight
+	}
+
+	// the totals
+	if y+4*lineHeight > pageBottom {
+		d.AddPage()
+		y = 60
+	}
+	y -= 10
+	d.Line(marginLeft, y, marginRight, y, 0.5, rule)
+	y += lineHeight + 4
+	totals := [][2]string{{"Subtotal", money(inv.Subtotal)}}
+	if inv.TaxRate > 0 {
+		totals = append(totals, [2]string{fmt.Sprintf("%s (%s)", inv.TaxName, FormatRate(inv.TaxRate)), money(inv.Tax)})
+	}
+	for _, row := range totals {
+		d.TextRight(rateColumn-120, y, pdf.Helvetica, 10, muted, row[0])
+		d.TextRight(rateColumn, y, pdf.Helvetica, 10, pdf.Black, row[1])
+		y += lineHeight
+	}
+	d.TextRight(rateColumn-120, y+2, pdf.HelveticaBold, 12, pdf.Black, "Total")
+	d.TextRight(rateColumn, y+2, pdf.HelveticaBold, 12, accent, money(inv.Total))
+
+	d.Text(marginLeft, pageBottom+30, pdf.Helvetica, 9, muted, doc.Note)
+
+	return d.Bytes()
+}
+
+// propertyLines are the address and website under the property name, the address may span lines
+// separated by commas or newlines
+func (c Config) propertyLines() []string {
+	var lines []string
+	for _, line := range strings.FieldsFunc(c.Address, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if c.SiteURL != "" {
+		lines = append(lines, strings.TrimRight(c.SiteURL, "/"))
+	}
+	return lines
+}
+
+// stayTime writes the arrival or departure day with the check-in or check-out time
+func (c Config) stayTime(day time.Time, word, clock string) string {
+	s := day.Format(dateLayout)
+	if clock != "" {
+		s += ", " + word + " " + clock
+	}
+	return s
+}
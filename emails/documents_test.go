@@ -0,0 +1,137 @@
+package emails
+
+import (
+	"bytes"
+	"compress/zlib"
+	"github.com/ahmedkhaeld/booking/data"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// pdfText is the content of the pages of a pdf made by the pdf package
+func pdfText(t *testing.T, doc data.Attachment) string {
+	if !bytes.HasPrefix(doc.Content, []byte("%PDF-")) {
+		t.Fatalf("%s is not a pdf", doc.Name)
+	}
+	var text bytes.Buffer
+	for _, m := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(doc.Content, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text.Write(b)
+	}
+	return text.String()
+}
+
+func taxedConfig() Config {
+	c := testConfig
+	c.TaxName = "VAT"
+	c.TaxRate = 1250
+	c.InvoicePrefix = "INV-"
+	c.Address = "1 Main Street, Fort Smythe"
+	c.CheckIn = "15:00"
+	c.CheckOut = "11:00"
+	return c
+}
+
+func TestConfig_Charges(t *testing.T) {
+	charges := taxedConfig().Charges(testReservation)
+	// 3 nights at $125.50, 12.5% tax rounded to the cent
+	if charges.Nights != 3 || charges.Subtotal != 37650 || charges.Tax != 4706 || charges.Total != 42356 {
+		t.Errorf("unexpected charges %+v", charges)
+	}
+
+	if charges := testConfig.Charges(testReservation); charges.Tax != 0 || charges.Total != 37650 {
+		t.Errorf("expected no tax without a rate, got %+v", charges)
+	}
+
+	v := taxedConfig().View(testReservation)
+	if !v.HasTax || v.TaxRate != "12.5%" || v.Tax != "$47.06" || v.Total != "$423.56" {
+		t.Errorf("unexpected view %+v", v)
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	for rate, want := range map[int]string{0: "0%", 2000: "20%", 1250: "12.5%", 705: "7.05%"} {
+		if got := FormatRate(rate); got != want {
+			t.Errorf("FormatRate(%d): expected %q, got %q", rate, want, got)
+		}
+	}
+}
+
+func TestConfig_ConfirmationPDF(t *testing.T) {
+	doc, err := taxedConfig().ConfirmationPDF(testReservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Name != "confirmation-ABCDE23456.pdf" {
+		t.Errorf("unexpected name %q", doc.Name)
+	}
+
+	text := pdfText(t, doc)
+	for _, want := range []string{
+		"(Booking confirmation)", "(John Smith)", "(ABCDE23456)", "(Generals Quarters)",
+		"(Saturday, January 5, 2030, from 15:00)", "(1 Main Street)",
+		"(Monday, January 7, 2030)", "($125.50)", "(VAT \\(12.5%\\))", "($47.06)", "($423.56)",
+		"(This confirmation is not an invoice.)",
+	} {
+		if !bytes.Contains([]byte(text), []byte(want)) {
+			t.Errorf("the confirmation does not have %s", want)
+		}
+	}
+	// a night for each night of the stay, not the departure day
+	if bytes.Contains([]byte(text), []byte("(Tuesday, January 8, 2030)")) {
+		t.Error("the departure day is not a night")
+	}
+}
+
+func TestConfig_InvoicePDF(t *testing.T) {
+	c := taxedConfig()
+	inv := c.NewInvoice(testReservation)
+	inv.Number = 42
+	inv.IssuedAt = time.Date(2030, 1, 8, 10, 0, 0, 0, time.UTC)
+
+	if inv.GuestName != "John Smith" || inv.Total != 42356 || inv.Currency != "USD" || inv.TaxRate != 1250 {
+		t.Errorf("unexpected invoice %+v", inv)
+	}
+
+	doc, err := c.InvoicePDF(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Name != "invoice-INV-000042.pdf" {
+		t.Errorf("unexpected name %q", doc.Name)
+	}
+	text := pdfText(t, doc)
+	for _, want := range []string{"(Invoice)", "(Number INV-000042)", "(Date January 8, 2030)", "($423.56)"} {
+		if !bytes.Contains([]byte(text), []byte(want)) {
+			t.Errorf("the invoice does not have %s", want)
+		}
+	}
+
+	// a long stay runs over to a second page
+	long := testReservation
+	long.EndDate = long.StartDate.AddDate(0, 0, 60)
+	doc, err = c.InvoicePDF(c.NewInvoice(long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(doc.Content, []byte("/Count 2")) {
+		t.Error("expected two pages for a 60 night stay")
+	}
+
+	msg, attachments, err := c.Invoice(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Template != InvoiceTemplate || msg.To != "john@example.com" || len(attachments) != 1 {
+		t.Errorf("unexpected invoice mail %+v with %d attachments", msg, len(attachments))
+	}
+}
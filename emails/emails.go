@@ -0,0 +1,289 @@
+// Package emails builds the mail the app sends: a view model of the reservation and a message for each
+// kind of mail, rendered with the templates of the same name in mail/, and the calendar invites and PDF
+// documents attached to it
+package emails
+
+import (
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// guest templates
+const (
+	Confirmation = "confirmation"
+	Modification = "modification"
+	Cancellation = "cancellation"
+	Reminder     = "reminder"
+	ThankYou     = "thankyou"
+)
+
+// Owner is the template of the notices to the owners
+const Owner = "owner"
+
+// InvoiceTemplate is the template of the mail an invoice is sent with
+const InvoiceTemplate = "invoice"
+
+// GuestTemplates lists every guest template
+var GuestTemplates = []string{Confirmation, Modification, Cancellation, Reminder, ThankYou}
+
+// Config is what the mail needs to know about the property
+type Config struct {
+	From         string
+	FromName     string
+	SiteURL      string
+	PropertyName string
+	Currency     string
+	// TaxName, like VAT, and TaxRate in hundredths of a percent are added to the price of every stay
+	TaxName string
+	TaxRate int
+	// InvoicePrefix is written before invoice numbers
+	InvoicePrefix string
+	// Address of the property, the location of the calendar invites
+	Address string
+	// CheckIn and CheckOut are times of day like 15:00, in Location
+	CheckIn  string
+	CheckOut string
+	Location *time.Location
+	// Owners get a notice of every new, modified and cancelled booking
+	Owners []string
+}
+
+// ReservationView is the data of the guest templates.
+// Mail data is kept as json in the outbox until it is sent, so every value is formatted here
+// rather than in the templates
+type ReservationView struct {
+	PropertyName  string
+	SiteURL       string
+	Code          string
+	FirstName     string
+	LastName      string
+	Email         string
+	Phone         string
+	Room          string
+	Arrival       string
+	Departure     string
+	ArrivalDate   string
+	DepartureDate string
+	Nights        int
+	HasPrice      bool
+	NightlyRate   string
+	Subtotal      string
+	HasTax        bool
+	TaxName       string
+	TaxRate       string
+	Tax           string
+	Total         string
+}
+
+// dateLayout is how dates are written in the mail
+const dateLayout = "Monday, January 2, 2006"
+
+// View returns the view model of res
+func (c Config) View(res data.Reservation) ReservationView {
+	charges := c.Charges(res)
+	return ReservationView{
+		PropertyName:  c.PropertyName,
+		SiteURL:       strings.TrimRight(c.SiteURL, "/"),
+		Code:          res.Code,
+		FirstName:     titleCase(res.FirstName),
+		LastName:      titleCase(res.LastName),
+		Email:         res.Email,
+		Phone:         res.Phone,
+		Room:          titleCase(res.Room.Name),
+		Arrival:       res.StartDate.Format(dateLayout),
+		Departure:     res.EndDate.Format(dateLayout),
+		ArrivalDate:   res.StartDate.Format("2006-01-02"),
+		DepartureDate: res.EndDate.Format("2006-01-02"),
+		Nights:        charges.Nights,
+		HasPrice:      res.NightlyRate > 0,
+		NightlyRate:   FormatMoney(charges.NightlyRate, c.Currency),
+		Subtotal:      FormatMoney(charges.Subtotal, c.Currency),
+		HasTax:        charges.Tax > 0,
+		TaxName:       c.TaxName,
+		TaxRate:       FormatRate(c.TaxRate),
+		Tax:           FormatMoney(charges.Tax, c.Currency),
+		Total:         FormatMoney(charges.Total, c.Currency),
+	}
+}
+
+// Charges is the price of a stay, in cents
+type Charges struct {
+	Nights      int
+	NightlyRate int
+	Subtotal    int
+	Tax         int
+	Total       int
+}
+
+// Charges returns the price of res with the tax added
+func (c Config) Charges(res data.Reservation) Charges {
+	subtotal := res.Total()
+	tax := (subtotal*c.TaxRate + 5000) / 10000
+	return Charges{
+		Nights:      res.Nights(),
+		NightlyRate: res.NightlyRate,
+		Subtotal:    subtotal,
+		Tax:         tax,
+		Total:       subtotal + tax,
+	}
+}
+
+// subjects of the guest mail, the property name and confirmation code are filled in
+var subjects = map[string]string{
+	Confirmation: "Your reservation at %s is confirmed (%s)",
+	Modification: "Your reservation at %s was updated (%s)",
+	Cancellation: "Your reservation at %s was cancelled (%s)",
+	Reminder:     "See you soon at %s (%s)",
+	ThankYou:     "Thank you for staying at %s (%s)",
+}
+
+// Guest returns the mail of kind, one of the guest templates, about res to the guest
+func (c Config) Guest(kind string, res data.Reservation) mailer.Message {
+	return mailer.Message{
+		From:     c.From,
+		FromName: c.FromName,
+		To:       res.Email,
+		Subject:  fmt.Sprintf(subjects[kind], c.PropertyName, res.Code),
+		Template: kind,
+		Data:     c.View(res),
+	}
+}
+
+// InvoiceView is the data of the invoice template
+type InvoiceView struct {
+	PropertyName string
+	SiteURL      string
+	GuestName    string
+	Code         string
+	Number       string
+	IssuedAt     string
+	Total        string
+}
+
+// Invoice returns the mail that sends inv to the guest, with the invoice attached
+func (c Config) Invoice(inv data.Invoice) (mailer.Message, []data.Attachment, error) {
+	attachment, err := c.InvoicePDF(inv)
+	if err != nil {
+		return mailer.Message{}, nil, err
+	}
+	msg := mailer.Message{
+		From:     c.From,
+		FromName: c.FromName,
+		To:       inv.Email,
+		Subject:  fmt.Sprintf("Invoice %s from %s (%s)", c.InvoiceNumber(inv.Number), c.PropertyName, inv.Code),
+		Template: InvoiceTemplate,
+		Data: InvoiceView{
+			PropertyName: c.PropertyName,
+			SiteURL:      strings.TrimRight(c.SiteURL, "/"),
+			GuestName:    inv.GuestName,
+			Code:         inv.Code,
+			Number:       c.InvoiceNumber(inv.Number),
+			IssuedAt:     inv.IssuedAt.Format(dateLayout),
+			Total:        FormatMoney(inv.Total, inv.Currency),
+		},
+	}
+	return msg, []data.Attachment{attachment}, nil
+}
+
+// kinds of owner notices
+const (
+	NoticeNew       = "new"
+	NoticeModified  = "modified"
+	NoticeCancelled = "cancelled"
+)
+
+var noticeHeadlines = map[string]string{
+	NoticeNew:       "New booking",
+	NoticeModified:  "Booking modified",
+	NoticeCancelled: "Booking cancelled",
+}
+
+// OwnerNotice is the data of the owner template
+type OwnerNotice struct {
+	ReservationView
+	Kind     string
+	Headline string
+	Link     string
+}
+
+// AdminReservationURL is the deep link to a reservation in the staff area
+func (c Config) AdminReservationURL(res data.Reservation) string {
+	return fmt.Sprintf("%s/admin/reservations/%d", strings.TrimRight(c.SiteURL, "/"), res.ID)
+}
+
+// OwnerNotices returns the notice of kind about res for every owner
+func (c Config) OwnerNotices(kind string, res data.Reservation) []mailer.Message {
+	notice := OwnerNotice{
+		ReservationView: c.View(res),
+		Kind:            kind,
+		Headline:        noticeHeadlines[kind],
+	}
+	// a cancelled reservation is gone, there is nothing to link to
+	if kind != NoticeCancelled {
+		notice.Link = c.AdminReservationURL(res)
+	}
+	subject := fmt.Sprintf("%s %s: %s, %s to %s",
+		notice.Headline, notice.Code, notice.Room, notice.ArrivalDate, notice.DepartureDate)
+
+	var messages []mailer.Message
+	for _, to := range c.Owners {
+		messages = append(messages, mailer.Message{
+			From:     c.From,
+			FromName: c.FromName,
+			To:       to,
+			Subject:  subject,
+			Template: Owner,
+			Data:     notice,
+		})
+	}
+	return messages
+}
+
+// currencySymbols are written in front of the amount, other currencies by their code
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+}
+
+// FormatMoney writes an amount in cents with its currency and thousands separators, e.g. $1,250.00
+func FormatMoney(cents int, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	units := fmt.Sprint(cents / 100)
+	for i := len(units) - 3; i > 0; i -= 3 {
+		units = units[:i] + "," + units[i:]
+	}
+	amount := fmt.Sprintf("%s.%02d", units, cents%100)
+
+	currency = strings.ToUpper(currency)
+	if symbol, ok := currencySymbols[currency]; ok {
+		return sign + symbol + amount
+	}
+	return strings.TrimSpace(sign + currency + " " + amount)
+}
+
+// FormatRate writes a rate in hundredths of a percent, e.g. 1250 is 12.5%
+func FormatRate(rate int) string {
+	s := strings.TrimRight(fmt.Sprintf("%d.%02d", rate/100, rate%100), "0")
+	return strings.TrimSuffix(s, ".") + "%"
+}
+
+// titleCase capitalises each word; names are stored in lower case
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		first, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(first)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
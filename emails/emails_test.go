@@ -0,0 +1,198 @@
+package emails
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ahmedkhaeld/booking/data"
+	htmltemplate "html/template"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+	"time"
+)
+
+var testConfig = Config{
+	From:         "stay@booking.example",
+	FromName:     "Fort Smythe",
+	SiteURL:      "https://booking.example/",
+	PropertyName: "Fort Smythe Bed and Breakfast",
+	Currency:     "USD",
+	Owners:       []string{"owner@booking.example", "desk@booking.example"},
+}
+
+var testReservation = data.Reservation{
+	ID:          7,
+	Code:        "ABCDE23456",
+	FirstName:   "john",
+	LastName:    "smith",
+	Email:       "john@example.com",
+	Phone:       "555-0100",
+	StartDate:   time.Date(2030, 1, 5, 0, 0, 0, 0, time.UTC),
+	EndDate:     time.Date(2030, 1, 8, 0, 0, 0, 0, time.UTC),
+	NightlyRate: 12550,
+	Room:        data.Room{ID: 1, Name: "generals quarters"},
+}
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		cents    int
+		currency string
+		want     string
+	}{
+		{0, "USD", "$0.00"},
+		{5, "usd", "$0.05"},
+		{12550, "USD", "$125.50"},
+		{123456789, "USD", "$1,234,567.89"},
+		{100000, "EUR", "€1,000.00"},
+		{-2500, "GBP", "-£25.00"},
+		{9900, "CHF", "CHF 99.00"},
+		{9900, "", "99.00"},
+	}
+	for _, tt := range tests {
+		if got := FormatMoney(tt.cents, tt.currency); got != tt.want {
+			t.Errorf("FormatMoney(%d, %q): expected %q, got %q", tt.cents, tt.currency, tt.want, got)
+		}
+	}
+}
+
+func TestConfig_View(t *testing.T) {
+	v := testConfig.View(testReservation)
+
+	if v.FirstName != "John" || v.Room != "Generals Quarters" {
+		t.Errorf("names should be capitalised: %+v", v)
+	}
+	if v.Arrival != "Saturday, January 5, 2030" || v.DepartureDate != "2030-01-08" {
+		t.Errorf("unexpected dates: %+v", v)
+	}
+	if v.Nights != 3 || !v.HasPrice || v.NightlyRate != "$125.50" || v.Total != "$376.50" {
+		t.Errorf("unexpected price: %+v", v)
+	}
+	if v.SiteURL != "https://booking.example" {
+		t.Errorf("unexpected site url %q", v.SiteURL)
+	}
+
+	free := testReservation
+	free.NightlyRate = 0
+	if testConfig.View(free).HasPrice {
+		t.Error("a reservation without a rate should not show a price")
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"john smith", "John Smith"},
+		{"  generals   quarters ", "Generals Quarters"},
+		{"élodie åberg", "Élodie Åberg"},
+		{"øystein o'brien", "Øystein O'brien"},
+		{"ümit 李", "Ümit 李"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := titleCase(tt.s); got != tt.want {
+			t.Errorf("titleCase(%q): expected %q, got %q", tt.s, tt.want, got)
+		}
+	}
+}
+
+func TestConfig_Guest(t *testing.T) {
+	for _, kind := range GuestTemplates {
+		msg := testConfig.Guest(kind, testReservation)
+		if msg.To != "john@example.com" || msg.From != testConfig.From || msg.Template != kind {
+			t.Errorf("%s: unexpected message %+v", kind, msg)
+		}
+		if !strings.Contains(msg.Subject, "ABCDE23456") || strings.Contains(msg.Subject, "%!") {
+			t.Errorf("%s: unexpected subject %q", kind, msg.Subject)
+		}
+	}
+}
+
+func TestConfig_OwnerNotices(t *testing.T) {
+	messages := testConfig.OwnerNotices(NoticeNew, testReservation)
+	if len(messages) != 2 || messages[0].To != "owner@booking.example" || messages[1].To != "desk@booking.example" {
+		t.Fatalf("expected a message for each owner, got %+v", messages)
+	}
+	if messages[0].Template != Owner {
+		t.Errorf("expected the owner template, got %q", messages[0].Template)
+	}
+	if messages[0].Subject != "New booking ABCDE23456: Generals Quarters, 2030-01-05 to 2030-01-08" {
+		t.Errorf("unexpected subject %q", messages[0].Subject)
+	}
+	notice := messages[0].Data.(OwnerNotice)
+	if notice.Link != "https://booking.example/admin/reservations/7" {
+		t.Errorf("unexpected link %q", notice.Link)
+	}
+
+	cancelled := testConfig.OwnerNotices(NoticeCancelled, testReservation)[0].Data.(OwnerNotice)
+	if cancelled.Link != "" || cancelled.Headline != "Booking cancelled" {
+		t.Errorf("a cancellation should not link to the deleted reservation: %+v", cancelled)
+	}
+
+	noOwners := testConfig
+	noOwners.Owners = nil
+	if len(noOwners.OwnerNotices(NoticeNew, testReservation)) != 0 {
+		t.Error("expected no messages without owners")
+	}
+}
+
+// outboxData is msg.Data as the mail queue hands it to the mailer, after a round trip through json
+func outboxData(t *testing.T, d interface{}) map[string]interface{} {
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestTemplates(t *testing.T) {
+	messages := []struct {
+		template string
+		data     interface{}
+	}{
+		{Owner, testConfig.OwnerNotices(NoticeModified, testReservation)[0].Data},
+		{InvoiceTemplate, InvoiceView{Code: "ABCDE23456", Number: "INV-000001"}},
+	}
+	for _, kind := range GuestTemplates {
+		messages = append(messages, struct {
+			template string
+			data     interface{}
+		}{kind, testConfig.Guest(kind, testReservation).Data})
+	}
+
+	for _, msg := range messages {
+		d := outboxData(t, msg.data)
+
+		var html, plain bytes.Buffer
+		ht, err := htmltemplate.ParseFiles("../mail/" + msg.template + ".html.tmpl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ht.ExecuteTemplate(&html, "body", d)
+		if err != nil {
+			t.Fatalf("%s.html: %s", msg.template, err)
+		}
+		pt, err := texttemplate.ParseFiles("../mail/" + msg.template + ".plain.tmpl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = pt.ExecuteTemplate(&plain, "body", d)
+		if err != nil {
+			t.Fatalf("%s.plain: %s", msg.template, err)
+		}
+
+		for name, out := range map[string]string{"html": html.String(), "plain": plain.String()} {
+			if strings.Contains(out, "<no value>") {
+				t.Errorf("%s.%s uses a value the data does not have:\n%s", msg.template, name, out)
+			}
+			if !strings.Contains(out, "ABCDE23456") {
+				t.Errorf("%s.%s does not show the confirmation code", msg.template, name)
+			}
+		}
+	}
+}
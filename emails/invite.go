@@ -0,0 +1,128 @@
+package emails
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/ical"
+	"net/url"
+	"time"
+)
+
+// inviteProdID identifies us as the producer of the invites
+const inviteProdID = "-//Bread and Breakfast//Booking//EN"
+
+// clockLayout is how check-in and check-out times are written
+const clockLayout = "15:04"
+
+// Invite returns the calendar invite of the stay, from check-in on the arrival day to check-out on the
+// departure day. Its UID never changes for a reservation, and each invite has a higher sequence than
+// the one before, so a later invite updates the event in the guest's calendar. A cancelled invite
+// removes it.
+func (c Config) Invite(res data.Reservation, cancelled bool) (data.Attachment, error) {
+	start, err := c.at(res.StartDate, c.CheckIn)
+	if err != nil {
+		return data.Attachment{}, fmt.Errorf("check-in time: %w", err)
+	}
+	end, err := c.at(res.EndDate, c.CheckOut)
+	if err != nil {
+		return data.Attachment{}, fmt.Errorf("check-out time: %w", err)
+	}
+
+	v := c.View(res)
+	description := fmt.Sprintf("Confirmation code: %s\nRoom: %s\nCheck-in from %s, check-out by %s",
+		v.Code, v.Room, c.CheckIn, c.CheckOut)
+	if v.SiteURL != "" {
+		description += "\n" + v.SiteURL
+	}
+
+	now := time.Now()
+	event := ical.Event{
+		UID:          fmt.Sprintf("reservation-%s@%s", res.Code, c.domain()),
+		Summary:      fmt.Sprintf("Stay at %s", c.PropertyName),
+		Description:  description,
+		Location:     c.Address,
+		Start:        start,
+		End:          end,
+		Stamp:        now,
+		LastModified: now,
+		Sequence:     inviteSequence(res, now),
+		Status:       "CONFIRMED",
+		Organizer:    c.From,
+	}
+	method := "PUBLISH"
+	if cancelled {
+		event.Status = "CANCELLED"
+		method = "CANCEL"
+	}
+
+	cal := ical.Calendar{
+		ProdID: inviteProdID,
+		Method: method,
+		Events: []ical.Event{event},
+	}
+	var buf bytes.Buffer
+	err = cal.Encode(&buf)
+	if err != nil {
+		return data.Attachment{}, err
+	}
+	return data.Attachment{
+		Name:    fmt.Sprintf("reservation-%s.ics", res.Code),
+		Content: buf.Bytes(),
+	}, nil
+}
+
+// Attachments returns the files sent with the guest mail of kind: the calendar invite and printable
+// confirmation for confirmations and modifications, and the cancellation of the invite for cancellations
+func (c Config) Attachments(kind string, res data.Reservation) ([]data.Attachment, error) {
+	switch kind {
+	case Confirmation, Modification:
+		invite, err := c.Invite(res, false)
+		if err != nil {
+			return nil, err
+		}
+		confirmation, err := c.ConfirmationPDF(res)
+		if err != nil {
+			return nil, err
+		}
+		return []data.Attachment{invite, confirmation}, nil
+	case Cancellation:
+		invite, err := c.Invite(res, true)
+		if err != nil {
+			return nil, err
+		}
+		return []data.Attachment{invite}, nil
+	}
+	return nil, nil
+}
+
+// at is the time of day clock, like 15:00, on the date of day in the property's time zone
+func (c Config) at(day time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse(clockLayout, clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	y, m, d := day.Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc), nil
+}
+
+// domain is the right hand side of the invite UIDs; it must never change for the same reservation
+func (c Config) domain() string {
+	if u, err := url.Parse(c.SiteURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "booking.local"
+}
+
+// inviteSequence is the number of seconds since the reservation was made,
+// so every invite sent about it has a higher sequence than the ones before
+func inviteSequence(res data.Reservation, now time.Time) int {
+	if res.CreatedAt.IsZero() || now.Before(res.CreatedAt) {
+		return 0
+	}
+	return int(now.Sub(res.CreatedAt) / time.Second)
+}
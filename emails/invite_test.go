@@ -0,0 +1,89 @@
+package emails
+
+import (
+	"bytes"
+	"github.com/ahmedkhaeld/booking/ical"
+	"testing"
+	"time"
+)
+
+func TestConfig_Invite(t *testing.T) {
+	c := testConfig
+	c.Address = "1 Main Street, Fort Smythe"
+	c.CheckIn = "15:00"
+	c.CheckOut = "11:00"
+	c.Location = time.FixedZone("UTC-5", -5*60*60)
+
+	res := testReservation
+	res.CreatedAt = time.Now().Add(-time.Hour)
+
+	invite, err := c.Invite(res, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invite.Name != "reservation-ABCDE23456.ics" {
+		t.Errorf("unexpected name %q", invite.Name)
+	}
+
+	cal, err := ical.Parse(bytes.NewReader(invite.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.Method != "PUBLISH" || len(cal.Events) != 1 {
+		t.Fatalf("expected one published event, got %+v", cal)
+	}
+	e := cal.Events[0]
+	if e.UID != "reservation-ABCDE23456@booking.example" {
+		t.Errorf("unexpected uid %q", e.UID)
+	}
+	if !e.Start.Equal(time.Date(2030, 1, 5, 20, 0, 0, 0, time.UTC)) || !e.End.Equal(time.Date(2030, 1, 8, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected check-in at 15:00 and check-out at 11:00 property time, got %s to %s", e.Start, e.End)
+	}
+	if e.Location != c.Address || e.Status != "CONFIRMED" || e.Sequence < 3600 {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if !bytes.Contains([]byte(e.Description), []byte("Confirmation code: ABCDE23456")) {
+		t.Errorf("the description does not have the confirmation code: %q", e.Description)
+	}
+
+	cancelled, err := c.Invite(res, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal, err = ical.Parse(bytes.NewReader(cancelled.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.Method != "CANCEL" || cal.Events[0].Status != "CANCELLED" || cal.Events[0].UID != e.UID {
+		t.Errorf("expected the cancellation of the same event, got %+v", cal)
+	}
+
+	c.CheckIn = "3pm"
+	if _, err := c.Invite(res, false); err == nil {
+		t.Error("expected an error for a bad check-in time")
+	}
+}
+
+func TestConfig_Attachments(t *testing.T) {
+	c := testConfig
+	c.CheckIn = "15:00"
+	c.CheckOut = "11:00"
+
+	for _, kind := range GuestTemplates {
+		attachments, err := c.Attachments(kind, testReservation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		switch kind {
+		case Confirmation, Modification:
+			// the invite and the printable confirmation
+			want = 2
+		case Cancellation:
+			want = 1
+		}
+		if len(attachments) != want {
+			t.Errorf("%s: expected %d attachments, got %d", kind, want, len(attachments))
+		}
+	}
+}
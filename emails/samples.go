@@ -0,0 +1,54 @@
+package emails
+
+import (
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"time"
+)
+
+// Templates are all the mail templates, in the order they are previewed
+var Templates = append(append([]string{}, GuestTemplates...), Owner, InvoiceTemplate)
+
+// SampleReservation is a made up booking, two weeks from now, to fill the templates with
+func SampleReservation() data.Reservation {
+	arrival := time.Now().AddDate(0, 0, 14)
+	arrival = time.Date(arrival.Year(), arrival.Month(), arrival.Day(), 0, 0, 0, 0, time.UTC)
+	return data.Reservation{
+		ID:          1,
+		Code:        "SAMPLE2345",
+		FirstName:   "jane",
+		LastName:    "doe",
+		Email:       "jane.doe@example.com",
+		Phone:       "555-0100",
+		StartDate:   arrival,
+		EndDate:     arrival.AddDate(0, 0, 3),
+		NightlyRate: 12500,
+		Room:        data.Room{ID: 1, Name: "generals quarters", NightlyRate: 12500},
+		CreatedAt:   time.Now(),
+	}
+}
+
+// Sample is the message of template as it would be sent for the sample reservation,
+// false for a template that is not one of Templates
+func (c Config) Sample(template string) (mailer.Message, bool) {
+	res := SampleReservation()
+	switch template {
+	case Owner:
+		if len(c.Owners) == 0 {
+			c.Owners = []string{"owner@example.com"}
+		}
+		return c.OwnerNotices(NoticeNew, res)[0], true
+	case InvoiceTemplate:
+		inv := c.NewInvoice(res)
+		inv.Number = 1
+		inv.IssuedAt = time.Now()
+		msg, _, err := c.Invoice(inv)
+		return msg, err == nil
+	}
+	for _, kind := range GuestTemplates {
+		if kind == template {
+			return c.Guest(kind, res), true
+		}
+	}
+	return mailer.Message{}, false
+}
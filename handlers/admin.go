@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/forms"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+///-----------------Admin-----------------///
+
+// AdminDashboard is the landing page of the staff area
+func (h *Handlers) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	defer h.LoadTime(time.Now())
+	err := h.Render.Page(w, r, "admin-dashboard.page.tmpl", nil, nil)
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminAPIKeys lists every api key and shows the form to issue a new one
+func (h *Handlers) AdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	h.renderAPIKeys(w, r, forms.New(nil))
+}
+
+func (h *Handlers) renderAPIKeys(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	keys, err := h.Models.APIKeys.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting api keys:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+	users, err := h.Models.Users.SelectAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting users:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["keys"] = keys
+	d["users"] = users
+	d["scopes"] = data.AllScopes
+
+	// the plain token is only ever shown on the page right after it was issued
+	stringData := make(map[string]string)
+	stringData["new_token"] = h.Session.PopString(r.Context(), "new_api_token")
+
+	err = h.Render.Page(w, r, "admin-api-keys.page.tmpl", nil, &render.TemplateData{
+		Form:       form,
+		Data:       d,
+		StringData: stringData,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminPostAPIKey issues a new api key for the selected user
+func (h *Handlers) AdminPostAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "user_id")
+	form.MinLength("name", 3)
+
+	scopes := make([]string, 0, len(data.AllScopes))
+	for _, s := range r.PostForm["scopes"] {
+		for _, known := range data.AllScopes {
+			if s == known {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		form.Errors.Add("scopes", "Select at least one scope")
+	}
+
+	userID, err := strconv.Atoi(form.Get("user_id"))
+	if err != nil && form.Has("user_id") {
+		form.Errors.Add("user_id", "Select a user")
+	}
+
+	// an admin key can do everything on the api, only an administrator may hand one out, and only to another
+	if hasScope(scopes, data.ScopeAdmin) && form.Valid() {
+		issuer, err := h.Models.Users.GetByID(r.Context(), h.Session.GetInt(r.Context(), "userID"))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			h.ErrorLog.Println("error getting user by id:", err)
+			h.ErrorStatus(w, http.StatusInternalServerError)
+			return
+		}
+		if issuer.AccessLevel < data.AccessAdmin {
+			form.Errors.Add("scopes", "Only administrators can issue keys with the admin scope")
+		}
+
+		owner, err := h.Models.Users.GetByID(r.Context(), userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			h.ErrorLog.Println("error getting user by id:", err)
+			h.ErrorStatus(w, http.StatusInternalServerError)
+			return
+		}
+		if owner.AccessLevel < data.AccessAdmin {
+			form.Errors.Add("user_id", "Keys with the admin scope can only belong to an administrator")
+		}
+	}
+
+	if !form.Valid() {
+		h.renderAPIKeys(w, r, form)
+		return
+	}
+
+	_, token, err := h.Models.APIKeys.Issue(r.Context(), data.APIKey{
+		UserID: userID,
+		Name:   strings.TrimSpace(form.Get("name")),
+		Scopes: scopes,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error issuing api key:", err)
+		h.Session.Put(r.Context(), "error", "Could not issue the api key")
+		http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "new_api_token", token)
+	h.Session.Put(r.Context(), "flash", "API key issued")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminRevokeAPIKey disables an api key immediately
+func (h *Handlers) AdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Models.APIKeys.Revoke(r.Context(), id)
+	if err != nil {
+		h.ErrorLog.Println("error revoking api key:", err)
+		h.Session.Put(r.Context(), "error", "Could not revoke the api key")
+		http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "API key revoked")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
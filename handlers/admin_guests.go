@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+///-----------------Admin Guests-----------------///
+
+// adminGuest loads the guest named in the url, writing the error response when it cannot
+func (h *Handlers) adminGuest(w http.ResponseWriter, r *http.Request) (data.Guest, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return data.Guest{}, false
+	}
+
+	guest, err := h.Models.Guests.GetByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return guest, false
+	}
+	if err != nil {
+		h.ErrorLog.Println("error getting guest:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return guest, false
+	}
+	return guest, true
+}
+
+// AdminShowGuest shows a guest with their stays, the latest first, and the guests that may be the same person
+func (h *Handlers) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	guest, ok := h.adminGuest(w, r)
+	if !ok {
+		return
+	}
+
+	stays, err := h.Models.Reservations.GetForGuest(r.Context(), guest.ID)
+	if err != nil {
+		h.ErrorLog.Println("error getting the stays of a guest:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+	duplicates, err := h.Models.Guests.Duplicates(r.Context(), guest)
+	if err != nil {
+		h.ErrorLog.Println("error getting duplicate guests:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["guest"] = guest
+	d["stays"] = stays
+	d["duplicates"] = duplicates
+	err = h.Render.Page(w, r, "admin-guest.page.tmpl", nil, &render.TemplateData{Data: d})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminMergeGuest merges the guest with the email of the form into the guest of the url: their stays move over
+// and the other profile is deleted
+func (h *Handlers) AdminMergeGuest(w http.ResponseWriter, r *http.Request) {
+	guest, ok := h.adminGuest(w, r)
+	if !ok {
+		return
+	}
+	back := fmt.Sprintf("/admin/guests/%d", guest.ID)
+
+	err := r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(r.Form.Get("email"))
+
+	other, err := h.Models.Guests.GetByEmail(r.Context(), email)
+	if err == nil {
+		err = h.Models.Guests.Merge(r.Context(), guest.ID, other.ID)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		h.Session.Put(r.Context(), "error", fmt.Sprintf("No guest has booked with %q", email))
+	case errors.Is(err, data.ErrSameGuest):
+		h.Session.Put(r.Context(), "error", "That is the email of this guest")
+	case err != nil:
+		h.ErrorLog.Println("error merging guests:", err)
+		h.Session.Put(r.Context(), "error", "Could not merge the guests")
+	default:
+		h.Session.Put(r.Context(), "flash", "The stays of "+other.Email+" were moved to this guest")
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/emails"
+	"github.com/ahmedkhaeld/jazz/forms"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+///-----------------Admin Reservations-----------------///
+
+// AdminReservations lists the reservations a page at a time, filtered and sorted by the query string,
+// see reservationQuery
+func (h *Handlers) AdminReservations(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q, problems := reservationQuery(values)
+
+	var page data.ReservationPage
+	var err error
+	if len(problems) == 0 {
+		page, err = h.Models.Reservations.List(r.Context(), q)
+		if errors.Is(err, data.ErrInvalidQuery) {
+			problems["page"] = "This page cannot be shown any more, start again from the first page"
+		} else if err != nil {
+			h.ErrorLog.Println("error listing reservations:", err)
+			h.ErrorStatus(w, http.StatusInternalServerError)
+			return
+		}
+	}
+	rooms, err := h.Models.Rooms.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting rooms:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["reservations"] = page.Reservations
+	d["rooms"] = rooms
+	d["problems"] = problems
+	stringData := map[string]string{
+		"from":    values.Get("from"),
+		"to":      values.Get("to"),
+		"room_id": values.Get("room_id"),
+		"status":  values.Get("status"),
+		"q":       values.Get("q"),
+		"sort":    values.Get("sort"),
+	}
+	if page.Next != "" {
+		stringData["next"] = adminReservationsURL(values, "after", page.Next)
+	}
+	if page.Prev != "" {
+		stringData["prev"] = adminReservationsURL(values, "before", page.Prev)
+	}
+	err = h.Render.Page(w, r, "admin-reservations.page.tmpl", nil, &render.TemplateData{
+		Data:       d,
+		StringData: stringData,
+		IntData:    map[string]int{"total": page.Total, "shown": len(page.Reservations)},
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// adminReservationsURL is the url of the listing of values at the page of cursor, given as after or before
+func adminReservationsURL(values url.Values, param, cursor string) string {
+	page := url.Values{}
+	for key, value := range values {
+		if key != "after" && key != "before" && len(value) > 0 && value[0] != "" {
+			page.Set(key, value[0])
+		}
+	}
+	page.Set(param, cursor)
+	return "/admin/reservations?" + page.Encode()
+}
+
+// AdminSearch finds the reservations of a guest by name, email, phone or confirmation code, the best match first,
+// see data.ReservationRepository.Search
+func (h *Handlers) AdminSearch(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var matches []data.GuestMatch
+	stringData := map[string]string{"q": text}
+	if len([]rune(text)) >= data.MinSearchLength {
+		var err error
+		matches, err = h.Models.Reservations.Search(r.Context(), text, data.DefaultSearchLimit)
+		if err != nil {
+			h.ErrorLog.Println("error searching reservations:", err)
+			h.ErrorStatus(w, http.StatusInternalServerError)
+			return
+		}
+	} else if text != "" {
+		stringData["problem"] = fmt.Sprintf("Type at least %d characters to search", data.MinSearchLength)
+	}
+
+	d := make(map[string]interface{})
+	d["matches"] = matches
+	err := h.Render.Page(w, r, "admin-search.page.tmpl", nil, &render.TemplateData{
+		Data:       d,
+		StringData: stringData,
+		IntData:    map[string]int{"found": len(matches), "limit": data.DefaultSearchLimit},
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// adminReservation loads the reservation named in the url, writing the error response when it cannot
+func (h *Handlers) adminReservation(w http.ResponseWriter, r *http.Request) (data.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return data.Reservation{}, false
+	}
+
+	res, err := h.Models.Reservations.GetByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return res, false
+	}
+	if err != nil {
+		h.ErrorLog.Println("error getting reservation:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return res, false
+	}
+	return res, true
+}
+
+// AdminReservationHistory shows every change to a reservation and its restriction, the latest first, from the
+// audit log. The history of a cancelled reservation stays there
+func (h *Handlers) AdminReservationHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.Models.Audit.GetForReservation(r.Context(), id)
+	if err != nil {
+		h.ErrorLog.Println("error getting the history of a reservation:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// the code is in the entries that have every field, in case the reservation is gone
+	stringData := make(map[string]string)
+	for _, e := range entries {
+		if code, ok := e.Changes["code"].After.(string); ok {
+			stringData["code"] = code
+		}
+		if code, ok := e.Changes["code"].Before.(string); ok {
+			stringData["code"] = code
+		}
+	}
+	res, err := h.Models.Reservations.GetByID(r.Context(), id)
+	switch {
+	case err == nil:
+		stringData["code"] = res.Code
+	case !errors.Is(err, sql.ErrNoRows):
+		h.ErrorLog.Println("error getting reservation:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	case len(entries) == 0:
+		h.ErrorStatus(w, http.StatusNotFound)
+		return
+	default:
+		stringData["deleted"] = "true"
+	}
+
+	d := make(map[string]interface{})
+	d["entries"] = entries
+	err = h.Render.Page(w, r, "admin-reservation-history.page.tmpl", nil, &render.TemplateData{
+		Data:       d,
+		StringData: stringData,
+		IntData:    map[string]int{"id": id},
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminShowReservation shows a reservation with the form to change the guest details
+func (h *Handlers) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.adminReservation(w, r)
+	if !ok {
+		return
+	}
+	h.renderAdminReservation(w, r, res, forms.New(nil))
+}
+
+func (h *Handlers) renderAdminReservation(w http.ResponseWriter, r *http.Request, res data.Reservation, form *forms.Form) {
+	d := make(map[string]interface{})
+	d["reservation"] = res
+	d["price"] = h.Emails.View(res)
+	if inv, err := h.Models.Invoices.GetByReservation(r.Context(), res.ID); err == nil {
+		d["invoice"] = h.Emails.InvoiceNumber(inv.Number)
+	}
+	err := h.Render.Page(w, r, "admin-reservation.page.tmpl", nil, &render.TemplateData{
+		Form: form,
+		Data: d,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminPostReservation saves changes to the guest details of a reservation
+func (h *Handlers) AdminPostReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.adminReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	form := forms.New(r.PostForm)
+	res.Validate(form)
+	if !form.Valid() {
+		h.renderAdminReservation(w, r, res, form)
+		return
+	}
+
+	err = h.Models.Transaction(r.Context(), func(tx *data.Tx) error {
+		err := h.Models.Reservations.UpdateTx(r.Context(), tx, res)
+		if err != nil {
+			return err
+		}
+		err = h.notifyGuestTx(r.Context(), tx, res, emails.Modification)
+		if err != nil {
+			return err
+		}
+		return h.notifyOwnersTx(r.Context(), tx, res, emails.NoticeModified)
+	})
+	if err != nil {
+		h.ErrorLog.Println("error updating reservation:", err)
+		h.Session.Put(r.Context(), "error", "Could not save the reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%d", res.ID), http.StatusSeeOther)
+		return
+	}
+
+	h.MailQueue.Flush()
+	h.Webhooks.Publish(r.Context(), data.EventReservationModified, newAPIReservation(res))
+
+	h.Session.Put(r.Context(), "flash", "Reservation saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%d", res.ID), http.StatusSeeOther)
+}
+
+// AdminProcessReservation marks a reservation as seen by staff
+func (h *Handlers) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.adminReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Models.Reservations.UpdateProcessedStatus(r.Context(), 1, res.ID)
+	if err != nil {
+		h.ErrorLog.Println("error processing reservation:", err)
+		h.Session.Put(r.Context(), "error", "Could not mark the reservation processed")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%d", res.ID), http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+	http.Redirect(w, r, "/admin/reservations?status=new", http.StatusSeeOther)
+}
+
+// AdminCancelReservation cancels a reservation and frees its room
+func (h *Handlers) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.adminReservation(w, r)
+	if !ok {
+		return
+	}
+
+	// the restriction of the reservation is deleted with it
+	err := h.Models.Transaction(r.Context(), func(tx *data.Tx) error {
+		err := h.Models.Reservations.DeleteTx(r.Context(), tx, res.ID)
+		if err != nil {
+			return err
+		}
+		err = h.notifyGuestTx(r.Context(), tx, res, emails.Cancellation)
+		if err != nil {
+			return err
+		}
+		return h.notifyOwnersTx(r.Context(), tx, res, emails.NoticeCancelled)
+	})
+	if err != nil {
+		h.ErrorLog.Println("error cancelling reservation:", err)
+		h.Session.Put(r.Context(), "error", "Could not cancel the reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%d", res.ID), http.StatusSeeOther)
+		return
+	}
+
+	h.MailQueue.Flush()
+	h.Webhooks.Publish(r.Context(), data.EventReservationCancelled, newAPIReservation(res))
+
+	h.Session.Put(r.Context(), "flash", "Reservation "+res.Code+" cancelled")
+	http.Redirect(w, r, "/admin/reservations", http.StatusSeeOther)
+}
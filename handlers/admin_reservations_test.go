@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// bookGuests books a night for each guest, one day after the other, in room 1
+func bookGuests(t *testing.T, a *testApp, names ...string) {
+	t.Helper()
+	for i, name := range names {
+		_, err := a.Models.Reservations.Create(context.Background(), data.Reservation{
+			FirstName: name, LastName: "Guest", Email: name + "@example.com", Phone: "555-01" + name,
+			StartDate: testDate(t, 10+i), EndDate: testDate(t, 11+i), RoomID: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAdminReservations_Pages(t *testing.T) {
+	a := newTestApp(t)
+	bookGuests(t, a, "ann", "bob", "cleo")
+
+	rr := a.get("/admin/reservations?limit=2&q=guest")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	expectBody(t, rr, "ann guest", "bob guest", "2 of 3 reservations", "Next &rarr;")
+	if strings.Contains(rr.Body.String(), "cleo guest") || strings.Contains(rr.Body.String(), "Previous") {
+		t.Error("expected only the first page")
+	}
+
+	// the next page keeps the filters
+	start := strings.Index(rr.Body.String(), `href="/admin/reservations?after=`)
+	next := rr.Body.String()[start+len(`href="`):]
+	next = strings.ReplaceAll(next[:strings.Index(next, `"`)], "&amp;", "&")
+	if !strings.Contains(next, "q=guest") || !strings.Contains(next, "limit=2") {
+		t.Errorf("expected the filters in the next link, got %s", next)
+	}
+	rr = a.get(next)
+	expectBody(t, rr, "cleo guest", "1 of 3 reservations", "&larr; Previous")
+}
+
+func TestAdminReservations_Problems(t *testing.T) {
+	a := newTestApp(t)
+
+	rr := a.get("/admin/reservations?from=yesterday&sort=price")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the page with the problems, got %d", rr.Code)
+	}
+	expectBody(t, rr, "Date must be in the form YYYY-MM-DD", "Sort must be one of")
+
+	rr = a.get("/admin/reservations?after=bogus")
+	expectBody(t, rr, "start again from the first page")
+}
+
+func TestAdminSearch(t *testing.T) {
+	a := newTestApp(t)
+	bookGuests(t, a, "ann", "bob", "annabel")
+
+	rr := a.get("/admin/search?q=ANN")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	expectBody(t, rr, ">ann guest</a>", ">annabel guest</a>", `href="/admin/reservations/1"`)
+	if strings.Contains(rr.Body.String(), "bob guest") {
+		t.Error("expected only the guests named ann")
+	}
+
+	// the whole name ranks above a similar one
+	body := a.get("/admin/search?q=ann+guest").Body.String()
+	ann, annabel := strings.Index(body, ">ann guest</a>"), strings.Index(body, ">annabel guest</a>")
+	if ann < 0 || annabel < 0 || ann > annabel {
+		t.Errorf("expected ann before annabel, got %s", body)
+	}
+
+	expectBody(t, a.get("/admin/search?q=a"), "Type at least 2 characters")
+	expectBody(t, a.get("/admin/search?q=zed"), "No guest matches <strong>zed</strong>")
+}
+
+func TestAdminReservationHistory(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+	staff, _ := a.Models.Users.Insert(ctx, data.User{FirstName: "Sam", LastName: "Staff", Email: "sam@example.com",
+		Password: "password", AccessLevel: 1})
+	bookGuests(t, a, "ann")
+	res, _ := a.Models.Reservations.GetByID(ctx, 1)
+
+	staffCtx := data.WithRequestID(data.WithActor(ctx, data.Actor{Type: data.ActorUser, ID: staff}), "host/abc-000042")
+	res.Phone = "555-0999"
+	if err := a.Models.Reservations.Update(staffCtx, res); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := a.get("/admin/reservations/1/history")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	expectBody(t, rr, res.Code, "Sam Staff", "request host/abc-000042", "update reservations #1",
+		"<del>555-01ann</del>", "555-0999", "create reservations #1", "system")
+
+	// the history outlives the reservation
+	if err := a.Models.Reservations.Delete(staffCtx, res.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectBody(t, a.get("/admin/reservations/1/history"), res.Code, "The reservation was cancelled", "delete reservations #1")
+
+	if rr := a.get("/admin/reservations/99/history"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a reservation that never was, got %d", rr.Code)
+	}
+}
+
+func TestAdminGuest(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+	var codes []string
+	for i, email := range []string{"ann@example.com", "ann@example.com", "ann.guest@example.com"} {
+		id, err := a.Models.Reservations.Create(ctx, data.Reservation{
+			FirstName: "ann", LastName: "guest", Email: email, Phone: "555-0100",
+			StartDate: testDate(t, 10+i), EndDate: testDate(t, 11+i), RoomID: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, _ := a.Models.Reservations.GetByID(ctx, id)
+		codes = append(codes, res.Code)
+	}
+	ann, _ := a.Models.Guests.GetByEmail(ctx, "ann@example.com")
+
+	rr := a.get(fmt.Sprintf("/admin/guests/%d", ann.ID))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	expectBody(t, rr, codes[0], codes[1], "ann.guest@example.com", "Merge into this guest")
+	if strings.Contains(rr.Body.String(), codes[2]) {
+		t.Error("expected the stay under the other email apart")
+	}
+
+	page := fmt.Sprintf("/admin/guests/%d", ann.ID)
+	expectRedirect(t, a.post(page+"/merge", url.Values{"email": {"ANN.guest@example.com"}}), page)
+	expectBody(t, a.get(page), codes[2], "were moved to this guest")
+	if merged, _ := a.Models.Guests.GetByEmail(ctx, "ann.guest@example.com"); merged.ID != ann.ID {
+		t.Errorf("expected the merged email to find guest %d, got %+v", ann.ID, merged)
+	}
+	expectRedirect(t, a.post(page+"/merge", url.Values{"email": {"ann.guest@example.com"}}), page)
+	expectBody(t, a.get(page), "That is the email of this guest")
+
+	expectRedirect(t, a.post(page+"/merge", url.Values{"email": {"nobody@example.com"}}), page)
+	expectBody(t, a.get(page), "No guest has booked with")
+
+	if rr := a.get("/admin/guests/99"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing guest, got %d", rr.Code)
+	}
+}
+
+func TestAPIReservations(t *testing.T) {
+	s := loadSpec(t)
+	a := newTestApp(t)
+	bookGuests(t, a, "ann", "bob", "cleo")
+
+	var body struct {
+		Data apiReservationPage `json:"data"`
+	}
+	query := url.Values{"limit": {"2"}, "sort": {"-arrival"}}
+	var names []string
+	for {
+		rr := a.get("/api/v1/reservations?" + query.Encode())
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		checkAgainstSpec(t, s, "/api/v1/reservations", "GET", rr)
+		body.Data = apiReservationPage{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.Total != 3 {
+			t.Errorf("expected a total of 3, got %d", body.Data.Total)
+		}
+		for _, res := range body.Data.Reservations {
+			names = append(names, res.FirstName)
+		}
+		if body.Data.NextCursor == "" {
+			break
+		}
+		query.Set("after", body.Data.NextCursor)
+	}
+	if strings.Join(names, ",") != "cleo,bob,ann" {
+		t.Errorf("expected every guest latest arrival first, got %v", names)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"bad date", "from=2030-13-01", http.StatusUnprocessableEntity},
+		{"period backwards", "from=2030-01-10&to=2030-01-01", http.StatusUnprocessableEntity},
+		{"unknown status", "status=cancelled", http.StatusUnprocessableEntity},
+		{"limit too high", "limit=1000", http.StatusUnprocessableEntity},
+		{"both cursors", "after=a&before=b", http.StatusUnprocessableEntity},
+		{"made up cursor", "after=bogus", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rr := a.get("/api/v1/reservations?" + tt.query)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		checkAgainstSpec(t, s, "/api/v1/reservations", "GET", rr)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"github.com/ahmedkhaeld/booking/data"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// login signs the user with email in, with the password every test user has
+func (a *testApp) login(t *testing.T, email string) {
+	t.Helper()
+	expectRedirect(t, a.post("/user/login", url.Values{"email": {email}, "password": {"password"}}), "/admin/dashboard")
+}
+
+func TestAdminPostAPIKey_AdminScope(t *testing.T) {
+	ctx := context.Background()
+	a := newTestApp(t)
+	staff, _ := a.Models.Users.Insert(ctx, data.User{FirstName: "Sam", LastName: "Staff", Email: "sam@example.com",
+		Password: "password", AccessLevel: data.AccessStaff})
+	admin, _ := a.Models.Users.Insert(ctx, data.User{FirstName: "Ada", LastName: "Admin", Email: "ada@example.com",
+		Password: "password", AccessLevel: data.AccessAdmin})
+
+	issue := func(userID int, scope string) *httptest.ResponseRecorder {
+		return a.post("/admin/api-keys", url.Values{"name": {"Partner site"}, "user_id": {strconv.Itoa(userID)}, "scopes": {scope}})
+	}
+
+	// staff issue keys with the other scopes, but not admin keys
+	a.login(t, "sam@example.com")
+	expectRedirect(t, issue(staff, data.ScopeReadAvailability), "/admin/api-keys")
+	expectBody(t, issue(admin, data.ScopeAdmin), "Only administrators can issue keys with the admin scope")
+
+	// administrators issue them, to administrators only
+	a.login(t, "ada@example.com")
+	expectBody(t, issue(staff, data.ScopeAdmin), "can only belong to an administrator")
+	expectRedirect(t, issue(admin, data.ScopeAdmin), "/admin/api-keys")
+
+	keys, _ := a.Models.APIKeys.GetAll(ctx)
+	if len(keys) != 2 || keys[0].UserID != admin || !keys[0].HasScope(data.ScopeAdmin) || keys[1].HasScope(data.ScopeAdmin) {
+		t.Errorf("expected the read key of the staff user and the admin key of the administrator, got %+v", keys)
+	}
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/forms"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+///-----------------JSON API v1-----------------///
+
+// apiEnvelope wraps every /api/v1 response; exactly one of Data or Error is set
+type apiEnvelope struct {
+	Data  interface{} `json:"data,omitempty"`
+	Error *apiError   `json:"error,omitempty"`
+}
+
+// apiError is the error body of an /api/v1 response.
+// Code is a stable identifier clients can switch on, Fields holds per-field validation messages
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// error codes specific to the api, on top of the date codes shared with the web handlers
+const (
+	errCodeNotFound      = "not_found"
+	errCodeValidation    = "validation_failed"
+	errCodeNotAvailable  = "room_not_available"
+	errCodeRoomNotFound  = "room_not_found"
+	errCodeInvalidFormat = "invalid_json"
+	errCodeMethod        = "method_not_allowed"
+)
+
+type apiRoom struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type apiRoomAvailability struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+type apiAvailability struct {
+	StartDate string                `json:"start_date"`
+	EndDate   string                `json:"end_date"`
+	Nights    int                   `json:"nights"`
+	Rooms     []apiRoomAvailability `json:"rooms"`
+}
+
+type apiReservation struct {
+	Code      string    `json:"code"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Room      apiRoom   `json:"room"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	Nights    int       `json:"nights"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiReservationRequest is the body of POST /api/v1/reservations
+type apiReservationRequest struct {
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+}
+
+// apiReservationPage is a page of GET /api/v1/reservations; the cursors are left out at either end
+type apiReservationPage struct {
+	Reservations []apiReservation `json:"reservations"`
+	Total        int              `json:"total"`
+	NextCursor   string           `json:"next_cursor,omitempty"`
+	PrevCursor   string           `json:"prev_cursor,omitempty"`
+}
+
+func newAPIReservation(res data.Reservation) apiReservation {
+	return apiReservation{
+		Code:      res.Code,
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+		Room:      apiRoom{ID: res.RoomID, Name: res.Room.Name},
+		StartDate: res.StartDate.Format(dateLayout),
+		EndDate:   res.EndDate.Format(dateLayout),
+		Nights:    nights(res.StartDate, res.EndDate),
+		CreatedAt: res.CreatedAt,
+	}
+}
+
+// apiData writes a successful api response
+func (h *Handlers) apiData(w http.ResponseWriter, status int, payload interface{}) {
+	err := h.WriteJSON(w, status, apiEnvelope{Data: payload})
+	if err != nil {
+		h.ErrorLog.Println("error writing json:", err)
+	}
+}
+
+// apiFail writes an api error response
+func (h *Handlers) apiFail(w http.ResponseWriter, status int, e apiError) {
+	err := h.WriteJSON(w, status, apiEnvelope{Error: &e})
+	if err != nil {
+		h.ErrorLog.Println("error writing json:", err)
+	}
+}
+
+// apiDateFail writes the api error for a rejected date range
+func (h *Handlers) apiDateFail(w http.ResponseWriter, dateErr *DateRangeError) {
+	h.apiFail(w, http.StatusBadRequest, apiError{
+		Code:    dateErr.Code,
+		Message: dateErr.Message,
+		Fields:  map[string]string{dateErr.Field: dateErr.Message},
+	})
+}
+
+// APIRooms returns every room
+//
+// GET /api/v1/rooms
+func (h *Handlers) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := h.Models.Rooms.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting rooms:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Error querying database"})
+		return
+	}
+
+	out := make([]apiRoom, 0, len(rooms))
+	for _, room := range rooms {
+		out = append(out, apiRoom{ID: room.ID, Name: room.Name})
+	}
+	h.apiData(w, http.StatusOK, out)
+}
+
+// APIAvailability reports for every room whether it is free for the requested dates
+//
+// GET /api/v1/availability?start=YYYY-MM-DD&end=YYYY-MM-DD
+func (h *Handlers) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	sd := r.URL.Query().Get("start")
+	ed := r.URL.Query().Get("end")
+	startDate, endDate, dateErr := parseDateRange(sd, ed)
+	if dateErr != nil {
+		h.apiDateFail(w, dateErr)
+		return
+	}
+
+	rooms, err := h.Models.Rooms.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting rooms:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Error querying database"})
+		return
+	}
+	free, err := h.Models.Rooms.GetAnyAvailable(r.Context(), startDate, endDate)
+	if err != nil {
+		h.ErrorLog.Println("error getting available rooms:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Error querying database"})
+		return
+	}
+
+	isFree := make(map[int]bool, len(free))
+	for _, room := range free {
+		isFree[room.ID] = true
+	}
+
+	out := apiAvailability{
+		StartDate: startDate.Format(dateLayout),
+		EndDate:   endDate.Format(dateLayout),
+		Nights:    nights(startDate, endDate),
+		Rooms:     make([]apiRoomAvailability, 0, len(rooms)),
+	}
+	for _, room := range rooms {
+		out.Rooms = append(out.Rooms, apiRoomAvailability{ID: room.ID, Name: room.Name, Available: isFree[room.ID]})
+	}
+	h.apiData(w, http.StatusOK, out)
+}
+
+// APICreateReservation books a room for a guest
+//
+// POST /api/v1/reservations
+func (h *Handlers) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	var req apiReservationRequest
+	err := h.ReadJSON(w, r, &req, false)
+	if err != nil {
+		h.apiFail(w, http.StatusBadRequest, apiError{Code: errCodeInvalidFormat, Message: err.Error()})
+		return
+	}
+
+	startDate, endDate, dateErr := parseDateRange(req.StartDate, req.EndDate)
+	if dateErr != nil {
+		// the api names the fields after the json keys
+		dateErr.Field += "_date"
+		h.apiDateFail(w, dateErr)
+		return
+	}
+
+	// reuse the web form validation rules for the guest details
+	form := forms.New(url.Values{
+		"first_name": {req.FirstName},
+		"last_name":  {req.LastName},
+		"email":      {req.Email},
+		"phone":      {req.Phone},
+	})
+	reservation := data.Reservation{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		StartDate: startDate,
+		EndDate:   endDate,
+		RoomID:    req.RoomID,
+	}
+	reservation.Validate(form)
+	if req.RoomID < 1 {
+		form.Errors.Add("room_id", "A room must be selected")
+	}
+	if !form.Valid() {
+		fields := make(map[string]string)
+		for field := range form.Errors {
+			fields[field] = form.Errors.Get(field)
+		}
+		h.apiFail(w, http.StatusUnprocessableEntity, apiError{
+			Code:    errCodeValidation,
+			Message: "Some fields are invalid",
+			Fields:  fields,
+		})
+		return
+	}
+
+	room, err := h.Models.Rooms.GetById(r.Context(), req.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.apiFail(w, http.StatusUnprocessableEntity, apiError{
+			Code:    errCodeRoomNotFound,
+			Message: "Room does not exist",
+			Fields:  map[string]string{"room_id": "Room does not exist"},
+		})
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Println("error getting room by id:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Error querying database"})
+		return
+	}
+	reservation.Room = room
+
+	available, err := h.Models.Rooms.IsAvailable(r.Context(), room.ID, startDate, endDate)
+	if err != nil {
+		h.ErrorLog.Println("error checking availability:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Error querying database"})
+		return
+	}
+	if !available {
+		h.apiFail(w, http.StatusConflict, apiError{Code: errCodeNotAvailable, Message: "Room is not available for these dates"})
+		return
+	}
+
+	reservation, err = h.bookReservation(r.Context(), reservation)
+	if errors.Is(err, data.ErrRoomNotAvailable) {
+		h.apiFail(w, http.StatusConflict, apiError{Code: errCodeNotAvailable, Message: "Room is not available for these dates"})
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Println("error booking reservation:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Could not save reservation"})
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/reservations/"+reservation.Code)
+	h.apiData(w, http.StatusCreated, newAPIReservation(reservation))
+}
+
+// APIReservations lists the reservations a page at a time, filtered and sorted like the admin listing
+//
+// GET /api/v1/reservations?from=&to=&room_id=&status=&q=&sort=&limit=&after=&before=
+func (h *Handlers) APIReservations(w http.ResponseWriter, r *http.Request) {
+	q, problems := reservationQuery(r.URL.Query())
+	if len(problems) > 0 {
+		h.apiFail(w, http.StatusUnprocessableEntity, apiError{
+			Code:    errCodeValidation,
+			Message: "Some parameters are invalid",
+			Fields:  problems,
+		})
+		return
+	}
+
+	page, err := h.Models.Reservations.List(r.Context(), q)
+	if errors.Is(err, data.ErrInvalidQuery) {
+		h.apiFail(w, http.StatusBadRequest, apiError{Code: errCodeInvalidInput, Message: "Invalid page cursor"})
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Println("error listing reservations:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Error querying database"})
+		return
+	}
+
+	out := apiReservationPage{
+		Reservations: make([]apiReservation, 0, len(page.Reservations)),
+		Total:        page.Total,
+		NextCursor:   page.Next,
+		PrevCursor:   page.Prev,
+	}
+	for _, res := range page.Reservations {
+		out.Reservations = append(out.Reservations, newAPIReservation(res))
+	}
+	h.apiData(w, http.StatusOK, out)
+}
+
+// APIReservation looks a reservation up by its confirmation code
+//
+// GET /api/v1/reservations/{code}
+func (h *Handlers) APIReservation(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	reservation, err := h.Models.Reservations.GetByCode(r.Context(), code)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.apiFail(w, http.StatusNotFound, apiError{Code: errCodeNotFound, Message: "Reservation not found"})
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Println("error getting reservation by code:", err)
+		h.apiFail(w, http.StatusInternalServerError, apiError{Code: errCodeServer, Message: "Error querying database"})
+		return
+	}
+
+	h.apiData(w, http.StatusOK, newAPIReservation(reservation))
+}
+
+// APINotFound answers unknown /api paths with a json error instead of an html page
+func (h *Handlers) APINotFound(w http.ResponseWriter, r *http.Request) {
+	h.apiFail(w, http.StatusNotFound, apiError{Code: errCodeNotFound, Message: "No such endpoint: " + r.Method + " " + r.URL.Path})
+}
+
+// APIMethodNotAllowed answers a known /api path called with the wrong method
+func (h *Handlers) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	h.apiFail(w, http.StatusMethodNotAllowed, apiError{Code: errCodeMethod, Message: r.Method + " is not allowed on " + r.URL.Path})
+}
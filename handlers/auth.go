@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"github.com/ahmedkhaeld/jazz/forms"
+	"github.com/ahmedkhaeld/jazz/render"
+	"net/http"
+	"time"
+)
+
+///-----------------Staff Authentication-----------------///
+
+// UserLogin shows the staff login page
+func (h *Handlers) UserLogin(w http.ResponseWriter, r *http.Request) {
+	defer h.LoadTime(time.Now())
+	err := h.Render.Page(w, r, "login.page.tmpl", nil, &render.TemplateData{
+		Form: forms.New(nil),
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// PostUserLogin logs a staff user in and sends them to the admin area
+func (h *Handlers) PostUserLogin(w http.ResponseWriter, r *http.Request) {
+	// prevent session fixation attacks by issuing a fresh token on every login
+	err := h.Session.RenewToken(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error renewing session token:", err)
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+	if !form.Valid() {
+		err = h.Render.Page(w, r, "login.page.tmpl", nil, &render.TemplateData{
+			Form: form,
+		})
+		if err != nil {
+			h.ErrorLog.Println("error rendering:", err)
+		}
+		return
+	}
+
+	id, _, err := h.Models.Users.Authenticate(r.Context(), form.Get("email"), form.Get("password"))
+	if err != nil {
+		h.InfoLog.Println("failed login:", err)
+		h.Session.Put(r.Context(), "error", "Invalid login credentials")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	user, err := h.Models.Users.GetByID(r.Context(), id)
+	if err != nil {
+		h.ErrorLog.Println("error getting user by id:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	h.Session.Put(r.Context(), "userID", user.ID)
+	h.Session.Put(r.Context(), "accessLevel", user.AccessLevel)
+	h.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// Logout ends the staff session
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	err := h.Session.Destroy(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error destroying session:", err)
+	}
+	err = h.Session.RenewToken(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error renewing session token:", err)
+	}
+	h.Session.Put(r.Context(), "flash", "Logged out")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
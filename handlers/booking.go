@@ -1,10 +1,12 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/emails"
+	"github.com/ahmedkhaeld/booking/jobs"
 	"github.com/ahmedkhaeld/jazz/forms"
-	"github.com/ahmedkhaeld/jazz/mailer"
 	"github.com/ahmedkhaeld/jazz/render"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -14,7 +16,23 @@ import (
 
 func (h *Handlers) Availability(w http.ResponseWriter, r *http.Request) {
 	defer h.LoadTime(time.Now())
-	err := h.Render.Page(w, r, "search-availability.page.tmpl", nil, nil)
+	td := &render.TemplateData{
+		Form: forms.New(nil),
+	}
+	err := h.Render.Page(w, r, "search-availability.page.tmpl", nil, td)
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// renderAvailabilityErrors re-renders the search-availability page with the submitted dates
+// and the field error that made the search fail
+func (h *Handlers) renderAvailabilityErrors(w http.ResponseWriter, r *http.Request, form *forms.Form, dateErr *DateRangeError) {
+	dateErr.AddTo(form)
+	w.WriteHeader(http.StatusBadRequest)
+	err := h.Render.Page(w, r, "search-availability.page.tmpl", nil, &render.TemplateData{
+		Form: form,
+	})
 	if err != nil {
 		h.ErrorLog.Println("error rendering:", err)
 	}
@@ -23,22 +41,20 @@ func (h *Handlers) Availability(w http.ResponseWriter, r *http.Request) {
 // PostAvailability is used to process the form submission from the search-availability page
 // It will parse the form, check the start date &end date if available then send the user to the make-reservation page.
 func (h *Handlers) PostAvailability(w http.ResponseWriter, r *http.Request) {
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
-
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
+	err := r.ParseForm()
 	if err != nil {
-		h.ErrorStatus(w, http.StatusInternalServerError)
+		h.ErrorStatus(w, http.StatusBadRequest)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
-	if err != nil {
-		h.ErrorStatus(w, http.StatusInternalServerError)
+
+	form := forms.New(r.PostForm)
+	startDate, endDate, dateErr := parseDateRange(form.Get("start"), form.Get("end"))
+	if dateErr != nil {
+		h.renderAvailabilityErrors(w, r, form, dateErr)
 		return
 	}
 
-	rooms, err := h.Models.Rooms.GetAnyAvailable(startDate, endDate)
+	rooms, err := h.Models.Rooms.GetAnyAvailable(r.Context(), startDate, endDate)
 	if err != nil {
 		h.ErrorStatus(w, http.StatusInternalServerError)
 		return
@@ -65,7 +81,9 @@ func (h *Handlers) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = h.Render.Page(w, r, "available-rooms.page.tmpl", nil, td)
-
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
 }
 
 func (h *Handlers) ChooseRoom(w http.ResponseWriter, r *http.Request) {
@@ -73,7 +91,7 @@ func (h *Handlers) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	roomID, err := strconv.Atoi(id)
 	if err != nil {
-		h.ErrorStatus(w, http.StatusInternalServerError)
+		h.ErrorStatus(w, http.StatusBadRequest)
 		return
 	}
 
@@ -84,7 +102,7 @@ func (h *Handlers) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	//get the room name by roomID and put it in the reservation
-	room, err := h.Models.Rooms.GetById(roomID)
+	room, err := h.Models.Rooms.GetById(r.Context(), roomID)
 	if err != nil {
 		h.ErrorStatus(w, http.StatusInternalServerError)
 		return
@@ -112,7 +130,7 @@ func (h *Handlers) Reservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//get the room from the database
-	room, err := h.Models.Rooms.GetById(reservation.RoomID)
+	room, err := h.Models.Rooms.GetById(r.Context(), reservation.RoomID)
 	if err != nil {
 		h.ErrorLog.Println("error getting room by id:", err)
 		return
@@ -177,57 +195,90 @@ func (h *Handlers) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//begin transaction
-
-	//insert the reservation into the database
-	newResID, err := h.Models.Reservations.Create(reservation)
+	reservation, err = h.bookReservation(r.Context(), reservation)
+	if errors.Is(err, data.ErrRoomNotAvailable) {
+		h.Session.Put(r.Context(), "error", "The room was booked by someone else in the meantime, please search again")
+		http.Redirect(w, r, "/check/rooms", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		h.ErrorLog.Println("error inserting reservation:", err)
+		h.ErrorLog.Println("error booking reservation:", err)
+		h.Session.Put(r.Context(), "error", "can't save the reservation, please try again")
+		http.Redirect(w, r, "/bookings/reservation", http.StatusSeeOther)
 		return
 	}
 
-	reservation.ID = newResID
-	// build a restriction related to the added reservation
-	restriction := data.Restriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newResID,
-	}
-	//insert the restriction into the database
-	err = h.Models.Restrictions.Create(restriction)
+	h.Session.Put(r.Context(), "reservation", reservation)
+	//redirect to prevent the client to submit the form again
+	//[good practice any time we are using post request]
+	http.Redirect(w, r, "/booking/reservation-summary", http.StatusSeeOther)
+}
+
+// bookReservation stores a validated reservation together with the restriction that blocks its room
+// and the confirmation mail to the guest, all in one transaction. It returns the reservation with its id
+// and confirmation code set, or data.ErrRoomNotAvailable when the room is taken; the mail is sent in the background
+func (h *Handlers) bookReservation(ctx context.Context, reservation data.Reservation) (data.Reservation, error) {
+	code, err := data.NewConfirmationCode()
 	if err != nil {
-		h.ErrorLog.Println("error inserting restriction:", err)
-		return
+		return reservation, err
 	}
+	reservation.Code = code
+	reservation.CreatedAt = time.Now()
 
-	//send notification to the guest and the owner
-	var content struct {
-		Name string
-		Body string
+	// the guest pays the rate of the room at the time of booking
+	room, err := h.Models.Rooms.GetById(ctx, reservation.RoomID)
+	if err != nil {
+		return reservation, err
 	}
-	content.Name = reservation.FirstName + " " + reservation.LastName
-	content.Body = fmt.Sprintf("This is confirm your resrvation from %s to %s. At %s",
-		reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"), reservation.Room.Name)
-	msg := mailer.Message{
-		From:        "breadandbreakfast@booking.com",
-		To:          reservation.Email,
-		Subject:     "Reservation Confirmation",
-		Template:    "mail",
-		Attachments: nil,
-		Data:        content,
+	reservation.Room = room
+	reservation.NightlyRate = room.NightlyRate
+
+	restriction := data.Restriction{
+		Type:      data.RestrictionReservation,
+		StartDate: reservation.StartDate,
+		EndDate:   reservation.EndDate,
+		RoomID:    reservation.RoomID,
 	}
 
-	h.Mailer.Jobs <- msg
-	res := <-h.Mailer.Results
-	if res.Error != nil {
-		h.ErrorLog.Println(res.Error)
+	err = h.Models.Transaction(ctx, func(tx *data.Tx) error {
+		// checked again with the room locked, another booking may have taken it since it was offered
+		available, err := h.Models.Rooms.IsAvailableTx(ctx, tx, reservation.RoomID, reservation.StartDate, reservation.EndDate)
+		if err != nil {
+			return err
+		}
+		if !available {
+			return data.ErrRoomNotAvailable
+		}
+
+		//insert the reservation into the database
+		newResID, err := h.Models.Reservations.CreateTx(ctx, tx, reservation)
+		if err != nil {
+			return err
+		}
+		reservation.ID = newResID
+
+		// the restriction blocks the room for the reservation
+		restriction.ReservationID = newResID
+		restriction.ID, err = h.Models.Restrictions.CreateTx(ctx, tx, restriction)
+		if err != nil {
+			return err
+		}
+
+		err = h.notifyGuestTx(ctx, tx, reservation, emails.Confirmation)
+		if err != nil {
+			return err
+		}
+		return h.notifyOwnersTx(ctx, tx, reservation, emails.NoticeNew)
+	})
+	if err != nil {
+		return reservation, err
 	}
+	h.MailQueue.Flush()
 
-	h.Session.Put(r.Context(), "reservation", reservation)
-	//redirect to prevent the client to submit the form again
-	//[good practice any time we are using post request]
-	http.Redirect(w, r, "/booking/reservation-summary", http.StatusSeeOther)
+	h.Webhooks.Publish(ctx, data.EventReservationCreated, newAPIReservation(reservation))
+	h.Webhooks.Publish(ctx, data.EventRestrictionCreated, jobs.NewRestrictionPayload(restriction))
+
+	return reservation, nil
 }
 
 // ReservationSummary displays the reservation summary page to the user
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBooking_Flow(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+
+	rr := a.get("/check/rooms")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	expectBody(t, rr, "Enter The Dates")
+
+	// search
+	rr = a.post("/check/rooms", url.Values{"start": {testDay(10)}, "end": {testDay(12)}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the available rooms, got %d: %s", rr.Code, rr.Body.String())
+	}
+	expectBody(t, rr, `<a href="/check/rooms/1">generals quarters</a>`, `<a href="/check/rooms/2">majors suite</a>`)
+
+	// choose room
+	expectRedirect(t, a.get("/check/rooms/1"), "/bookings/reservation")
+
+	// fill form
+	rr = a.get("/bookings/reservation")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the reservation form, got %d", rr.Code)
+	}
+	expectBody(t, rr, "Room: generals quarters", "Arrival: "+testDay(10), "Departure: "+testDay(12))
+
+	guest := url.Values{
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@example.com"},
+		"phone":      {"555-0100"},
+	}
+	expectRedirect(t, a.post("/bookings/reservation", guest), "/booking/reservation-summary")
+
+	reservations, _ := a.Models.Reservations.GetAll(ctx)
+	if len(reservations) != 1 {
+		t.Fatalf("expected one reservation, got %+v", reservations)
+	}
+	res := reservations[0]
+	if res.RoomID != 1 || res.Email != "john@example.com" || res.NightlyRate != 8900 || res.Code == "" {
+		t.Errorf("unexpected reservation %+v", res)
+	}
+	if available, _ := a.Models.Rooms.IsAvailable(ctx, 1, testDate(t, 10), testDate(t, 12)); available {
+		t.Error("expected the room to be blocked for the stay")
+	}
+
+	// summary
+	rr = a.get("/booking/reservation-summary")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the summary, got %d", rr.Code)
+	}
+	expectBody(t, rr, res.Code, "John Smith", "generals quarters", "john@example.com", testDay(10), testDay(12))
+
+	// the summary is shown once, the session forgets the reservation
+	expectRedirect(t, a.get("/booking/reservation-summary"), "/")
+
+	a.MailQueue.SendDue()
+	var to []string
+	for _, msg := range a.mail.messages() {
+		to = append(to, msg.To)
+	}
+	if len(to) != 2 || !strings.Contains(strings.Join(to, ","), "john@example.com") || !strings.Contains(strings.Join(to, ","), "owner@booking.example") {
+		t.Errorf("expected the confirmation and the owner notice, got mail to %v", to)
+	}
+
+	// a returning guest books again with the same email and phone
+	a.post("/check/rooms", url.Values{"start": {testDay(20)}, "end": {testDay(21)}})
+	expectRedirect(t, a.get("/check/rooms/2"), "/bookings/reservation")
+	expectRedirect(t, a.post("/bookings/reservation", guest), "/booking/reservation-summary")
+
+	reservations, _ = a.Models.Reservations.GetAll(ctx)
+	if len(reservations) != 2 || reservations[1].GuestID != res.GuestID {
+		t.Errorf("expected the second stay with the same guest, got %+v", reservations)
+	}
+}
+
+func TestPostAvailability_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{"missing dates", url.Values{}, "Arrival date is required"},
+		{"missing departure", url.Values{"start": {testDay(1)}}, "Departure date is required"},
+		{"bad format", url.Values{"start": {"01/02/2030"}, "end": {testDay(5)}}, "Arrival date must be in the form YYYY-MM-DD"},
+		{"end before start", url.Values{"start": {testDay(5)}, "end": {testDay(2)}}, "Departure must be after arrival"},
+		{"same day", url.Values{"start": {testDay(5)}, "end": {testDay(5)}}, "Departure must be after arrival"},
+		{"in the past", url.Values{"start": {testDay(-5)}, "end": {testDay(-1)}}, "Arrival date cannot be in the past"},
+		{"too long", url.Values{"start": {testDay(1)}, "end": {testDay(maxStayNights + 2)}}, "A stay cannot be longer than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t)
+			rr := a.post("/check/rooms", tt.form)
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", rr.Code)
+			}
+			expectBody(t, rr, "Enter The Dates", "is-invalid", tt.want)
+		})
+	}
+}
+
+func TestPostAvailability_NoRooms(t *testing.T) {
+	a := newTestApp(t)
+	a.block(t, 1, 9, 13)
+	a.block(t, 2, 11, 12)
+
+	expectRedirect(t, a.post("/check/rooms", url.Values{"start": {testDay(10)}, "end": {testDay(12)}}), "/check/rooms")
+	expectBody(t, a.get("/check/rooms"), `notify("No rooms available", "error")`)
+
+	// one night later the majors suite is free again
+	rr := a.post("/check/rooms", url.Values{"start": {testDay(12)}, "end": {testDay(14)}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the available rooms, got %d", rr.Code)
+	}
+	expectBody(t, rr, "majors suite")
+	if strings.Contains(rr.Body.String(), "generals quarters") {
+		t.Error("the generals quarters are booked on the first night")
+	}
+}
+
+func TestPostAvailability_DatabaseError(t *testing.T) {
+	a := newTestApp(t)
+	a.Models.Rooms = failingRooms{a.Models.Rooms}
+
+	rr := a.post("/check/rooms", url.Values{"start": {testDay(10)}, "end": {testDay(12)}})
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rr.Code)
+	}
+}
+
+func TestBookRoom(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"no room", "/bookings/room?s=" + testDay(3) + "&e=" + testDay(5), http.StatusBadRequest},
+		{"unknown room", "/bookings/room?id=9&s=" + testDay(3) + "&e=" + testDay(5), http.StatusNotFound},
+		{"bad dates", "/bookings/room?id=1&s=" + testDay(5) + "&e=" + testDay(3), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := newTestApp(t).get(tt.target)
+			if rr.Code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+
+	a := newTestApp(t)
+	expectRedirect(t, a.get("/bookings/room?id=2&s="+testDay(3)+"&e="+testDay(5)), "/bookings/reservation")
+	expectBody(t, a.get("/bookings/reservation"), "Room: majors suite", "Arrival: "+testDay(3), "Departure: "+testDay(5))
+}
+
+func TestReservation_WithoutSearch(t *testing.T) {
+	a := newTestApp(t)
+
+	if rr := a.get("/check/rooms/1"); rr.Code != http.StatusInternalServerError {
+		t.Errorf("choosing a room without dates: expected 500, got %d", rr.Code)
+	}
+	expectRedirect(t, a.get("/bookings/reservation"), "/")
+	expectRedirect(t, a.get("/booking/reservation-summary"), "/")
+}
+
+func TestPostReservation_ValidationErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value string
+		want  string
+	}{
+		{"missing first name", "first_name", "", "This field cannot be blank"},
+		{"short last name", "last_name", "Sm", "This field must be at least 3 characters"},
+		{"invalid email", "email", "john@", "Invalid email"},
+		{"missing phone", "phone", "", "This field cannot be blank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t)
+			a.post("/check/rooms", url.Values{"start": {testDay(10)}, "end": {testDay(12)}})
+			a.get("/check/rooms/1")
+
+			guest := url.Values{
+				"first_name": {"John"},
+				"last_name":  {"Smith"},
+				"email":      {"john@example.com"},
+				"phone":      {"555-0100"},
+			}
+			guest.Set(tt.field, tt.value)
+			rr := a.post("/bookings/reservation", guest)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected the form again, got %d", rr.Code)
+			}
+			expectBody(t, rr, "Make Reservation", tt.want, "is-invalid")
+
+			reservations, _ := a.Models.Reservations.GetAll(context.Background())
+			if len(reservations) != 0 {
+				t.Errorf("expected nothing to be booked, got %+v", reservations)
+			}
+		})
+	}
+}
+
+func TestPostReservation_SaveFails(t *testing.T) {
+	a := newTestApp(t)
+	a.Models.Reservations = failingReservations{a.Models.Reservations}
+
+	a.post("/check/rooms", url.Values{"start": {testDay(10)}, "end": {testDay(12)}})
+	a.get("/check/rooms/1")
+	guest := url.Values{
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@example.com"},
+		"phone":      {"555-0100"},
+	}
+	expectRedirect(t, a.post("/bookings/reservation", guest), "/bookings/reservation")
+	expectBody(t, a.get("/bookings/reservation"), `notify("can\u0027t save the reservation, please try again", "error")`, "Room: generals quarters")
+
+	if available, _ := a.Models.Rooms.IsAvailable(context.Background(), 1, testDate(t, 10), testDate(t, 12)); !available {
+		t.Error("a failed booking should not block the room")
+	}
+}
+
+func TestPostReservation_RoomTakenMeanwhile(t *testing.T) {
+	a := newTestApp(t)
+
+	a.post("/check/rooms", url.Values{"start": {testDay(10)}, "end": {testDay(12)}})
+	a.get("/check/rooms/1")
+	// another guest books the room while this one fills in the form
+	a.block(t, 1, 11, 13)
+	guest := url.Values{
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@example.com"},
+		"phone":      {"555-0100"},
+	}
+	expectRedirect(t, a.post("/bookings/reservation", guest), "/check/rooms")
+	expectBody(t, a.get("/check/rooms"), "booked by someone else in the meantime")
+
+	if reservations, _ := a.Models.Reservations.GetAll(context.Background()); len(reservations) != 0 {
+		t.Errorf("expected nothing to be booked, got %+v", reservations)
+	}
+}
+
+func TestAPICreateReservation_RoomTakenMeanwhile(t *testing.T) {
+	a := newTestApp(t)
+	// the check before the booking misses the reservation, the one inside it does not
+	a.Models.Rooms = staleRooms{a.Models.Rooms}
+	a.block(t, 1, 11, 13)
+
+	body := `{"room_id": 1, "start_date": "` + testDay(10) + `", "end_date": "` + testDay(12) + `",
+		"first_name": "John", "last_name": "Smith", "email": "john@example.com", "phone": "555-0100"}`
+	rr := httptest.NewRecorder()
+	a.APICreateReservation(rr, httptest.NewRequest("POST", "/api/v1/reservations", strings.NewReader(body)))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	expectBody(t, rr, `"room_not_available"`)
+}
+
+func TestBookReservation_Concurrent(t *testing.T) {
+	a := newTestApp(t)
+
+	// every request found the room free; only one of them gets it
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.bookReservation(context.Background(), data.Reservation{
+				FirstName: "John", LastName: "Smith", Email: "john@example.com", Phone: "555-0100",
+				StartDate: testDate(t, 10), EndDate: testDate(t, 12), RoomID: 1,
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	booked := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			booked++
+		case !errors.Is(err, data.ErrRoomNotAvailable):
+			t.Errorf("expected ErrRoomNotAvailable, got %v", err)
+		}
+	}
+	if booked != 1 {
+		t.Errorf("expected one booking, got %d", booked)
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/ical"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+///-----------------Calendar Feeds-----------------///
+
+// icalProdID identifies us as the producer of the calendars we publish
+const icalProdID = "-//Bread and Breakfast//Booking//EN"
+
+// icalDomain is the right hand side of the UIDs we generate; UIDs must never change for the same event
+func (h *Handlers) icalDomain() string {
+	if h.Server.ServerName != "" {
+		return h.Server.ServerName
+	}
+	if u, err := url.Parse(h.Server.URL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "booking.local"
+}
+
+// roomCalendarURL is the subscribable feed address of a room
+func (h *Handlers) roomCalendarURL(room data.Room) string {
+	return fmt.Sprintf("%s/calendars/rooms/%s.ics", strings.TrimRight(h.Server.URL, "/"), room.ICalToken)
+}
+
+// restrictionEvent turns a restriction into an all-day event.
+// guest details are never published, the summary only says whether the room is booked or blocked
+func (h *Handlers) restrictionEvent(rest data.Restriction) ical.Event {
+	summary := "Blocked"
+	if rest.ReservationID > 0 {
+		summary = "Reserved"
+	}
+	modified := rest.UpdatedAt
+	if modified.IsZero() {
+		modified = rest.CreatedAt
+	}
+	return ical.Event{
+		UID:          fmt.Sprintf("restriction-%d@%s", rest.ID, h.icalDomain()),
+		Summary:      summary,
+		Start:        rest.StartDate,
+		End:          rest.EndDate,
+		AllDay:       true,
+		Stamp:        modified,
+		LastModified: modified,
+	}
+}
+
+// RoomCalendar publishes the restrictions of a room as an iCalendar feed,
+// the secret token in the url is the only thing that gives access to it
+func (h *Handlers) RoomCalendar(w http.ResponseWriter, r *http.Request) {
+	room, err := h.Models.Rooms.GetByICalToken(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Println("error getting room by calendar token:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	restrictions, err := h.Models.Restrictions.GetAllForRoom(r.Context(), room.ID)
+	if err != nil {
+		h.ErrorLog.Println("error getting restrictions for room:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	cal := ical.Calendar{
+		ProdID: icalProdID,
+		Name:   room.Name,
+	}
+	for _, rest := range restrictions {
+		// the blocks imported from other platforms are already on their calendars; publishing them back
+		// would have each platform import its own bookings from us again
+		if rest.Type == data.RestrictionExternal {
+			continue
+		}
+		cal.Events = append(cal.Events, h.restrictionEvent(rest))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"room-%d.ics\"", room.ID))
+	err = cal.Encode(w)
+	if err != nil {
+		h.ErrorLog.Println("error writing calendar:", err)
+	}
+}
+
+// AdminRooms lists the rooms with their nightly rates and calendar feed urls
+func (h *Handlers) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := h.Models.Rooms.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting rooms:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	feeds := make(map[string]string)
+	rates := make(map[string]string)
+	for _, room := range rooms {
+		feeds[fmt.Sprint(room.ID)] = h.roomCalendarURL(room)
+		rates[fmt.Sprint(room.ID)] = fmt.Sprintf("%d.%02d", room.NightlyRate/100, room.NightlyRate%100)
+	}
+
+	d := make(map[string]interface{})
+	d["rooms"] = rooms
+	d["rates"] = rates
+	d["currency"] = h.Emails.Currency
+	err = h.Render.Page(w, r, "admin-rooms.page.tmpl", nil, &render.TemplateData{
+		Data:       d,
+		StringData: feeds,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminRegenerateRoomCalendar replaces a room's feed token; calendars subscribed to the old url stop updating
+func (h *Handlers) AdminRegenerateRoomCalendar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.Models.Rooms.RegenerateICalToken(r.Context(), id)
+	if err != nil {
+		h.ErrorLog.Println("error regenerating calendar token:", err)
+		h.Session.Put(r.Context(), "error", "Could not regenerate the calendar url")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Calendar url regenerated")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminPostRoomRate sets a room's nightly rate, entered in whole currency units with optional cents.
+// Existing reservations keep the rate they were booked at
+func (h *Handlers) AdminPostRoomRate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(r.Form.Get("nightly_rate")), 64)
+	if err != nil || rate < 0 {
+		h.Session.Put(r.Context(), "error", "The nightly rate must be an amount like 120 or 99.50")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	err = h.Models.Rooms.UpdateNightlyRate(r.Context(), id, int(math.Round(rate*100)))
+	if err != nil {
+		h.ErrorLog.Println("error updating nightly rate:", err)
+		h.Session.Put(r.Context(), "error", "Could not save the nightly rate")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Nightly rate saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/forms"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+///-----------------Calendar Imports-----------------///
+
+// syncLogPageSize is how many syncs the log page shows
+const syncLogPageSize = 100
+
+// AdminCalendarImports lists the calendar feeds imported from other platforms
+func (h *Handlers) AdminCalendarImports(w http.ResponseWriter, r *http.Request) {
+	h.renderCalendarImports(w, r, forms.New(nil))
+}
+
+func (h *Handlers) renderCalendarImports(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	imports, err := h.Models.ICalImports.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting calendar imports:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+	rooms, err := h.Models.Rooms.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting rooms:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["imports"] = imports
+	d["rooms"] = rooms
+	err = h.Render.Page(w, r, "admin-calendar-imports.page.tmpl", nil, &render.TemplateData{
+		Form: form,
+		Data: d,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminPostCalendarImport adds a feed to import for a room
+func (h *Handlers) AdminPostCalendarImport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "name", "url")
+
+	roomID, err := strconv.Atoi(form.Get("room_id"))
+	if err != nil && form.Has("room_id") {
+		form.Errors.Add("room_id", "Select a room")
+	}
+
+	feedURL := strings.TrimSpace(form.Get("url"))
+	if u, err := url.Parse(feedURL); form.Has("url") && (err != nil || u.Host == "" ||
+		(u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "webcal")) {
+		form.Errors.Add("url", "Enter the http, https or webcal address of the calendar")
+	}
+
+	if !form.Valid() {
+		h.renderCalendarImports(w, r, form)
+		return
+	}
+
+	_, err = h.Models.ICalImports.Insert(r.Context(), data.ICalImport{
+		RoomID: roomID,
+		Name:   strings.TrimSpace(form.Get("name")),
+		URL:    feedURL,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error adding calendar import:", err)
+		h.Session.Put(r.Context(), "error", "Could not add the calendar")
+		http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Calendar added, it is imported on the next sync")
+	http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+}
+
+// AdminSyncCalendarImport imports a feed right away instead of waiting for the scheduled sync
+func (h *Handlers) AdminSyncCalendarImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	imp, err := h.Models.ICalImports.GetByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Println("error getting calendar import:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	entry, err := h.CalendarImporter.Sync(r.Context(), imp)
+	if err != nil {
+		h.Session.Put(r.Context(), "error", "Sync failed: "+err.Error())
+		http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", fmt.Sprintf("Synced %s: %d created, %d updated, %d deleted",
+		imp.Name, entry.Created, entry.Updated, entry.Deleted))
+	http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+}
+
+// AdminDeleteCalendarImport stops importing a feed and frees the dates it blocked
+func (h *Handlers) AdminDeleteCalendarImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Models.ICalImports.Delete(r.Context(), id)
+	if err != nil {
+		h.ErrorLog.Println("error deleting calendar import:", err)
+		h.Session.Put(r.Context(), "error", "Could not remove the calendar")
+		http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Calendar removed")
+	http.Redirect(w, r, "/admin/calendar-imports", http.StatusSeeOther)
+}
+
+// AdminCalendarSyncLog shows the latest syncs of every imported calendar
+func (h *Handlers) AdminCalendarSyncLog(w http.ResponseWriter, r *http.Request) {
+	logs, err := h.Models.ICalSyncLogs.GetRecent(r.Context(), syncLogPageSize)
+	if err != nil {
+		h.ErrorLog.Println("error getting calendar sync log:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["logs"] = logs
+	err = h.Render.Page(w, r, "admin-calendar-sync-log.page.tmpl", nil, &render.TemplateData{
+		Data: d,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
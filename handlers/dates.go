@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/ahmedkhaeld/jazz/forms"
+	"strings"
+	"time"
+)
+
+// dateLayout is the format used for arrival and departure dates in forms, query strings and json
+const dateLayout = "2006-01-02"
+
+// maxStayNights is the longest range a guest can search for or book in one go
+const maxStayNights = 30
+
+// error codes sent back to json clients when a date range is rejected
+const (
+	errCodeDateMissing  = "date_missing"
+	errCodeDateFormat   = "date_invalid_format"
+	errCodeDateOrder    = "date_end_not_after_start"
+	errCodeDatePast     = "date_in_past"
+	errCodeDateTooLong  = "date_range_too_long"
+	errCodeInvalidRoom  = "invalid_room"
+	errCodeInvalidInput = "invalid_input"
+	errCodeServer       = "server_error"
+)
+
+// now returns the current time; tests may replace it to pin "today"
+var now = time.Now
+
+// DateRangeError describes why an arrival/departure pair was rejected.
+// Field is the form field the error belongs to ("start" or "end"),
+// Code is a stable identifier for json clients and Message is human-readable.
+type DateRangeError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *DateRangeError) Error() string {
+	return e.Message
+}
+
+// AddTo records the error against its field so the page can display it next to the input
+func (e *DateRangeError) AddTo(form *forms.Form) {
+	form.Errors.Add(e.Field, e.Message)
+}
+
+// parseDateRange parses and validates an arrival and departure date in YYYY-MM-DD format.
+//
+// the range must be present, well-formed, start today or later, end after it starts
+// and be no longer than maxStayNights
+func parseDateRange(start, end string) (time.Time, time.Time, *DateRangeError) {
+	var startDate, endDate time.Time
+
+	start = strings.TrimSpace(start)
+	end = strings.TrimSpace(end)
+
+	if start == "" {
+		return startDate, endDate, &DateRangeError{Field: "start", Code: errCodeDateMissing, Message: "Arrival date is required"}
+	}
+	if end == "" {
+		return startDate, endDate, &DateRangeError{Field: "end", Code: errCodeDateMissing, Message: "Departure date is required"}
+	}
+
+	startDate, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return startDate, endDate, &DateRangeError{Field: "start", Code: errCodeDateFormat, Message: "Arrival date must be in the form YYYY-MM-DD"}
+	}
+	endDate, err = time.Parse(dateLayout, end)
+	if err != nil {
+		return startDate, endDate, &DateRangeError{Field: "end", Code: errCodeDateFormat, Message: "Departure date must be in the form YYYY-MM-DD"}
+	}
+
+	if !endDate.After(startDate) {
+		return startDate, endDate, &DateRangeError{Field: "end", Code: errCodeDateOrder, Message: "Departure must be after arrival"}
+	}
+
+	y, m, d := now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if startDate.Before(today) {
+		return startDate, endDate, &DateRangeError{Field: "start", Code: errCodeDatePast, Message: "Arrival date cannot be in the past"}
+	}
+
+	if nights(startDate, endDate) > maxStayNights {
+		return startDate, endDate, &DateRangeError{
+			Field:   "end",
+			Code:    errCodeDateTooLong,
+			Message: fmt.Sprintf("A stay cannot be longer than %d nights", maxStayNights),
+		}
+	}
+
+	return startDate, endDate, nil
+}
+
+// nights returns the number of nights between arrival and departure
+func nights(start, end time.Time) int {
+	return int(end.Sub(start).Hours() / 24)
+}
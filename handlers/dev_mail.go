@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/devmail"
+	"github.com/ahmedkhaeld/booking/emails"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+)
+
+///-----------------Development Mail-----------------///
+
+// DevMail lists the mail caught by the mail catcher and the templates that can be previewed
+func (h *Handlers) DevMail(w http.ResponseWriter, r *http.Request) {
+	messages, err := h.MailCatcher.Store.List()
+	if err != nil {
+		h.ErrorLog.Println("error listing caught mail:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["messages"] = messages
+	d["templates"] = emails.Templates
+	err = h.Render.Page(w, r, "dev-mail.page.tmpl", nil, &render.TemplateData{
+		Data: d,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// caughtMessage is the caught message of the id in the url, false when the response was already written
+func (h *Handlers) caughtMessage(w http.ResponseWriter, r *http.Request) (devmail.Message, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return devmail.Message{}, false
+	}
+	msg, err := h.MailCatcher.Store.Get(id)
+	if errors.Is(err, devmail.ErrNotFound) {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return msg, false
+	}
+	if err != nil {
+		h.ErrorLog.Println("error getting caught mail:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return msg, false
+	}
+	return msg, true
+}
+
+// previewMessage renders the sample of the template in the url, false when the response was already written
+func (h *Handlers) previewMessage(w http.ResponseWriter, r *http.Request) (devmail.Message, bool) {
+	sample, ok := h.Emails.Sample(chi.URLParam(r, "name"))
+	if !ok {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return devmail.Message{}, false
+	}
+	msg, err := h.MailCatcher.Preview(sample)
+	if err != nil {
+		h.ErrorLog.Println("error previewing mail:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return msg, false
+	}
+	return msg, true
+}
+
+func (h *Handlers) renderDevMailMessage(w http.ResponseWriter, r *http.Request, msg devmail.Message, htmlURL string, preview bool) {
+	d := make(map[string]interface{})
+	d["message"] = msg
+	d["preview"] = preview
+	stringData := make(map[string]string)
+	stringData["html_url"] = htmlURL
+	err := h.Render.Page(w, r, "dev-mail-message.page.tmpl", nil, &render.TemplateData{
+		Data:       d,
+		StringData: stringData,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// writeMailHTML sends the html of a message on its own, the message page shows it in a sandboxed frame
+func (h *Handlers) writeMailHTML(w http.ResponseWriter, msg devmail.Message) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	_, err := w.Write([]byte(msg.HTML))
+	if err != nil {
+		h.ErrorLog.Println("error writing mail:", err)
+	}
+}
+
+// DevMailMessage shows a caught message
+func (h *Handlers) DevMailMessage(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.caughtMessage(w, r)
+	if !ok {
+		return
+	}
+	h.renderDevMailMessage(w, r, msg, fmt.Sprintf("/dev/mail/%d/html", msg.ID), false)
+}
+
+// DevMailHTML sends the html of a caught message
+func (h *Handlers) DevMailHTML(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.caughtMessage(w, r)
+	if !ok {
+		return
+	}
+	h.writeMailHTML(w, msg)
+}
+
+// DevMailAttachment downloads an attachment of a caught message by its position
+func (h *Handlers) DevMailAttachment(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.caughtMessage(w, r)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil || n < 0 || n >= len(msg.Attachments) {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return
+	}
+
+	attachment := msg.Attachments[n]
+	contentType := mime.TypeByExtension(filepath.Ext(attachment.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, attachment.Name))
+	_, err = w.Write(attachment.Content)
+	if err != nil {
+		h.ErrorLog.Println("error writing attachment:", err)
+	}
+}
+
+// DevMailTemplate shows a template rendered with the sample reservation
+func (h *Handlers) DevMailTemplate(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.previewMessage(w, r)
+	if !ok {
+		return
+	}
+	h.renderDevMailMessage(w, r, msg, fmt.Sprintf("/dev/mail/templates/%s/html", msg.Template), true)
+}
+
+// DevMailTemplateHTML sends the html of a template rendered with the sample reservation
+func (h *Handlers) DevMailTemplateHTML(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.previewMessage(w, r)
+	if !ok {
+		return
+	}
+	h.writeMailHTML(w, msg)
+}
+
+// DevClearMail deletes the caught mail
+func (h *Handlers) DevClearMail(w http.ResponseWriter, r *http.Request) {
+	err := h.MailCatcher.Store.Clear()
+	if err != nil {
+		h.ErrorLog.Println("error clearing caught mail:", err)
+		h.Session.Put(r.Context(), "error", "Could not clear the mail")
+		http.Redirect(w, r, "/dev/mail", http.StatusSeeOther)
+		return
+	}
+	h.Session.Put(r.Context(), "flash", "Mail cleared")
+	http.Redirect(w, r, "/dev/mail", http.StatusSeeOther)
+}
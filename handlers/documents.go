@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/forms"
+	"github.com/ahmedkhaeld/jazz/render"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+///-----------------Confirmations and Invoices-----------------///
+
+// lookupSessionKey holds the confirmation code of the reservation a guest looked up
+const lookupSessionKey = "lookup_code"
+
+// writePDF sends a document as a download
+func (h *Handlers) writePDF(w http.ResponseWriter, doc data.Attachment) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, doc.Name))
+	w.Header().Set("Content-Length", strconv.Itoa(len(doc.Content)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	_, err := w.Write(doc.Content)
+	if err != nil {
+		h.ErrorLog.Println("error writing pdf:", err)
+	}
+}
+
+// confirmationPDF sends the printable confirmation of res
+func (h *Handlers) confirmationPDF(w http.ResponseWriter, res data.Reservation) {
+	doc, err := h.Emails.ConfirmationPDF(res)
+	if err != nil {
+		h.ErrorLog.Println("error making confirmation:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+	h.writePDF(w, doc)
+}
+
+// invoicePDF sends the invoice of res, issuing it the first time it is asked for
+func (h *Handlers) invoicePDF(w http.ResponseWriter, r *http.Request, res data.Reservation) {
+	inv, err := h.Models.Invoices.Issue(r.Context(), h.Emails.NewInvoice(res))
+	if err != nil {
+		h.ErrorLog.Println("error issuing invoice:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+	doc, err := h.Emails.InvoicePDF(inv)
+	if err != nil {
+		h.ErrorLog.Println("error making invoice:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+	h.writePDF(w, doc)
+}
+
+// AdminReservationConfirmation downloads the printable confirmation of a reservation
+func (h *Handlers) AdminReservationConfirmation(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.adminReservation(w, r)
+	if !ok {
+		return
+	}
+	h.confirmationPDF(w, res)
+}
+
+// AdminReservationInvoice downloads the invoice of a reservation
+func (h *Handlers) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.adminReservation(w, r)
+	if !ok {
+		return
+	}
+	h.invoicePDF(w, r, res)
+}
+
+// AdminSendInvoice mails the invoice of a reservation to the guest
+func (h *Handlers) AdminSendInvoice(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.adminReservation(w, r)
+	if !ok {
+		return
+	}
+	back := fmt.Sprintf("/admin/reservations/%d", res.ID)
+
+	inv, err := h.Models.Invoices.Issue(r.Context(), h.Emails.NewInvoice(res))
+	if err != nil {
+		h.ErrorLog.Println("error issuing invoice:", err)
+		h.Session.Put(r.Context(), "error", "Could not issue the invoice")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	msg, attachments, err := h.Emails.Invoice(inv)
+	if err == nil {
+		err = h.MailQueue.Enqueue(r.Context(), msg, attachments...)
+	}
+	if err != nil {
+		h.ErrorLog.Println("error sending invoice:", err)
+		h.Session.Put(r.Context(), "error", "Could not send the invoice")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Invoice "+h.Emails.InvoiceNumber(inv.Number)+" sent to "+inv.Email)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// lookedUpReservation is the reservation the guest looked up in this session, false when there is none
+func (h *Handlers) lookedUpReservation(r *http.Request) (data.Reservation, bool) {
+	code := h.Session.GetString(r.Context(), lookupSessionKey)
+	if code == "" {
+		return data.Reservation{}, false
+	}
+	res, err := h.Models.Reservations.GetByCode(r.Context(), code)
+	if err != nil {
+		// cancelled since
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.ErrorLog.Println("error getting reservation by code:", err)
+		}
+		h.Session.Remove(r.Context(), lookupSessionKey)
+		return res, false
+	}
+	return res, true
+}
+
+// ReservationLookup shows the form to find a reservation by its confirmation code and email,
+// or the reservation found with it
+func (h *Handlers) ReservationLookup(w http.ResponseWriter, r *http.Request) {
+	d := make(map[string]interface{})
+	if res, ok := h.lookedUpReservation(r); ok {
+		d["reservation"] = h.Emails.View(res)
+		if inv, err := h.Models.Invoices.GetByReservation(r.Context(), res.ID); err == nil {
+			d["invoice"] = h.Emails.InvoiceNumber(inv.Number)
+		}
+	}
+	h.renderReservationLookup(w, r, d, forms.New(nil))
+}
+
+func (h *Handlers) renderReservationLookup(w http.ResponseWriter, r *http.Request, d map[string]interface{}, form *forms.Form) {
+	err := h.Render.Page(w, r, "reservation-lookup.page.tmpl", nil, &render.TemplateData{
+		Form: form,
+		Data: d,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// PostReservationLookup finds a reservation by its confirmation code and the email it was booked with
+func (h *Handlers) PostReservationLookup(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "email")
+	if form.Valid() {
+		code := strings.ToUpper(strings.TrimSpace(r.Form.Get("code")))
+		res, err := h.Models.Reservations.GetByCode(r.Context(), code)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			h.ErrorLog.Println("error getting reservation by code:", err)
+			h.ErrorStatus(w, http.StatusInternalServerError)
+			return
+		}
+		// the same answer whether the code or the email is wrong, so codes cannot be probed
+		if err != nil || !strings.EqualFold(res.Email, strings.TrimSpace(r.Form.Get("email"))) {
+			form.Errors.Add("code", "No reservation matches this confirmation code and email")
+		}
+		if form.Valid() {
+			err = h.Session.RenewToken(r.Context())
+			if err != nil {
+				h.ErrorLog.Println("error renewing session token:", err)
+			}
+			h.Session.Put(r.Context(), lookupSessionKey, res.Code)
+			http.Redirect(w, r, "/reservations/lookup", http.StatusSeeOther)
+			return
+		}
+	}
+
+	h.renderReservationLookup(w, r, make(map[string]interface{}), form)
+}
+
+// ForgetReservationLookup ends the lookup, on a shared computer the next person cannot see the reservation
+func (h *Handlers) ForgetReservationLookup(w http.ResponseWriter, r *http.Request) {
+	h.Session.Remove(r.Context(), lookupSessionKey)
+	http.Redirect(w, r, "/reservations/lookup", http.StatusSeeOther)
+}
+
+// LookupConfirmation downloads the printable confirmation of the looked up reservation
+func (h *Handlers) LookupConfirmation(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.lookedUpReservation(r)
+	if !ok {
+		http.Redirect(w, r, "/reservations/lookup", http.StatusSeeOther)
+		return
+	}
+	h.confirmationPDF(w, res)
+}
+
+// LookupInvoice downloads the invoice of the looked up reservation
+func (h *Handlers) LookupInvoice(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.lookedUpReservation(r)
+	if !ok {
+		http.Redirect(w, r, "/reservations/lookup", http.StatusSeeOther)
+		return
+	}
+	h.invoicePDF(w, r, res)
+}
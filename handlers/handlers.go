@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/devmail"
+	"github.com/ahmedkhaeld/booking/emails"
+	"github.com/ahmedkhaeld/booking/jobs"
 	"github.com/ahmedkhaeld/jazz"
 	"github.com/ahmedkhaeld/jazz/render"
 	"net/http"
@@ -11,6 +14,13 @@ import (
 type Handlers struct {
 	*jazz.Jazz
 	data.Models
+	CalendarImporter *jobs.CalendarImporter
+	Webhooks         *jobs.Webhooks
+	MailQueue        *jobs.MailQueue
+	// Emails builds the mail to guests and owners
+	Emails emails.Config
+	// MailCatcher keeps the mail instead of sending it in development, nil when mail is really sent
+	MailCatcher *devmail.Catcher
 }
 
 func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
@@ -40,7 +50,7 @@ func (h *Handlers) Contact(w http.ResponseWriter, r *http.Request) {
 func (h *Handlers) Rooms(w http.ResponseWriter, r *http.Request) {
 
 	//get all rooms
-	rooms, err := h.Models.Rooms.GetAll()
+	rooms, err := h.Models.Rooms.GetAll(r.Context())
 	if err != nil {
 		h.ErrorLog.Println("error getting rooms:", err)
 		return
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"context"
+	"github.com/ahmedkhaeld/booking/data"
+)
+
+///-----------------Notifications-----------------///
+
+// notifyGuestTx queues the mail of kind, one of the emails guest templates, about res for the guest as part of tx,
+// with the calendar invite of the stay where the kind has one
+func (h *Handlers) notifyGuestTx(ctx context.Context, tx *data.Tx, res data.Reservation, kind string) error {
+	attachments, err := h.Emails.Attachments(kind, res)
+	if err != nil {
+		return err
+	}
+	return h.MailQueue.EnqueueTx(ctx, tx, h.Emails.Guest(kind, res), attachments...)
+}
+
+// notifyOwnersTx queues the notice of kind about res for the owners as part of tx
+func (h *Handlers) notifyOwnersTx(ctx context.Context, tx *data.Tx, res data.Reservation, kind string) error {
+	for _, msg := range h.Emails.OwnerNotices(kind, res) {
+		err := h.MailQueue.EnqueueTx(ctx, tx, msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
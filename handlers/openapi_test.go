@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ahmedkhaeld/jazz"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// specDoc is the subset of an OpenAPI document the tests need
+type specDoc struct {
+	Paths      map[string]map[string]specOperation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*specSchema  `json:"schemas"`
+		Responses map[string]specResponse `json:"responses"`
+	} `json:"components"`
+}
+
+type specOperation struct {
+	Responses map[string]specResponse `json:"responses"`
+}
+
+type specResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *specSchema `json:"schema"`
+	} `json:"content"`
+}
+
+type specSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*specSchema `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *specSchema            `json:"items"`
+	Enum                 []string               `json:"enum"`
+}
+
+func loadSpec(t *testing.T) *specDoc {
+	t.Helper()
+	var s specDoc
+	if err := json.Unmarshal(openAPISpec, &s); err != nil {
+		t.Fatalf("openapi.json is not valid json: %s", err)
+	}
+	return &s
+}
+
+// responseSchema finds the schema documented for a path, method and status code
+func (s *specDoc) responseSchema(path, method string, status int) (*specSchema, error) {
+	op, ok := s.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not documented", method, path)
+	}
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return nil, fmt.Errorf("%s %s does not document status %d", method, path, status)
+	}
+	if ref := resp.Ref; ref != "" {
+		resp, ok = s.Components.Responses[strings.TrimPrefix(ref, "#/components/responses/")]
+		if !ok {
+			return nil, fmt.Errorf("unknown response %s", ref)
+		}
+	}
+	content, ok := resp.Content["application/json"]
+	if !ok {
+		return nil, fmt.Errorf("%s %s %d has no json content", method, path, status)
+	}
+	return content.Schema, nil
+}
+
+// validate checks value against sc, returning every mismatch found
+func (s *specDoc) validate(sc *specSchema, value interface{}, at string) []string {
+	if sc.Ref != "" {
+		ref, ok := s.Components.Schemas[strings.TrimPrefix(sc.Ref, "#/components/schemas/")]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", at, sc.Ref)}
+		}
+		return s.validate(ref, value, at)
+	}
+
+	var problems []string
+	switch sc.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %T", at, value)}
+		}
+		for _, field := range sc.Required {
+			if _, ok := obj[field]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required field %q", at, field))
+			}
+		}
+		var extra *specSchema
+		if len(sc.AdditionalProperties) > 0 && string(sc.AdditionalProperties) != "false" && string(sc.AdditionalProperties) != "true" {
+			extra = &specSchema{}
+			_ = json.Unmarshal(sc.AdditionalProperties, extra)
+		}
+		for field, v := range obj {
+			prop, ok := sc.Properties[field]
+			switch {
+			case ok:
+				problems = append(problems, s.validate(prop, v, at+"."+field)...)
+			case extra != nil:
+				problems = append(problems, s.validate(extra, v, at+"."+field)...)
+			case string(sc.AdditionalProperties) == "false":
+				problems = append(problems, fmt.Sprintf("%s: undocumented field %q", at, field))
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %T", at, value)}
+		}
+		for i, v := range arr {
+			problems = append(problems, s.validate(sc.Items, v, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected string, got %T", at, value)}
+		}
+		if len(sc.Enum) > 0 && !contains(sc.Enum, str) {
+			problems = append(problems, fmt.Sprintf("%s: %q is not one of %v", at, str, sc.Enum))
+		}
+		if sc.Format == "date" {
+			if _, err := time.Parse(dateLayout, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date", at, str))
+			}
+		}
+		if sc.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date-time", at, str))
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return []string{fmt.Sprintf("%s: expected integer, got %v", at, value)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: expected boolean, got %T", at, value)}
+		}
+	}
+	return problems
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAgainstSpec fails the test when the recorded response is not what the spec documents
+func checkAgainstSpec(t *testing.T, s *specDoc, path, method string, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	sc, err := s.responseSchema(path, method, rr.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: expected content type application/json, got %q", method, path, ct)
+	}
+	var body interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: response is not json: %s", method, path, err)
+	}
+	for _, p := range s.validate(sc, body, "$") {
+		t.Errorf("%s %s %d: %s", method, path, rr.Code, p)
+	}
+}
+
+func newTestHandlers() *Handlers {
+	return &Handlers{
+		Jazz: &jazz.Jazz{
+			ErrorLog: log.New(io.Discard, "", 0),
+			InfoLog:  log.New(io.Discard, "", 0),
+		},
+	}
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	h := newTestHandlers()
+	rr := httptest.NewRecorder()
+	h.OpenAPI(rr, httptest.NewRequest("GET", "/api/openapi.json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("served document is not json: %s", err)
+	}
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got version %q", v)
+	}
+}
+
+func TestOpenAPI_RefsResolve(t *testing.T) {
+	s := loadSpec(t)
+	for path, methods := range s.Paths {
+		for method, op := range methods {
+			for status := range op.Responses {
+				code, _ := strconv.Atoi(status)
+				sc, err := s.responseSchema(path, method, code)
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				if sc.Ref != "" {
+					if _, ok := s.Components.Schemas[strings.TrimPrefix(sc.Ref, "#/components/schemas/")]; !ok {
+						t.Errorf("%s %s %s: unknown schema %s", method, path, status, sc.Ref)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPI_AvailabilityJSON(t *testing.T) {
+	s := loadSpec(t)
+	h := newTestHandlers()
+	day := func(n int) string { return time.Now().AddDate(0, 0, n).Format(dateLayout) }
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{"missing dates", url.Values{"room_id": {"1"}}, http.StatusBadRequest},
+		{"bad format", url.Values{"start": {"01/02/2030"}, "end": {day(5)}, "room_id": {"1"}}, http.StatusBadRequest},
+		{"end before start", url.Values{"start": {day(5)}, "end": {day(2)}, "room_id": {"1"}}, http.StatusBadRequest},
+		{"in the past", url.Values{"start": {day(-5)}, "end": {day(-1)}, "room_id": {"1"}}, http.StatusBadRequest},
+		{"too long", url.Values{"start": {day(1)}, "end": {day(maxStayNights + 2)}, "room_id": {"1"}}, http.StatusBadRequest},
+		{"invalid room", url.Values{"start": {day(1)}, "end": {day(3)}, "room_id": {"x"}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/room/check-json", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			h.AvailabilityJSON(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			checkAgainstSpec(t, s, "/room/check-json", "POST", rr)
+		})
+	}
+}
+
+func TestOpenAPI_APIErrors(t *testing.T) {
+	s := loadSpec(t)
+	h := newTestHandlers()
+
+	t.Run("availability with bad dates", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.APIAvailability(rr, httptest.NewRequest("GET", "/api/v1/availability?start=2001-02-10&end=2001-02-01", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", rr.Code)
+		}
+		checkAgainstSpec(t, s, "/api/v1/availability", "GET", rr)
+	})
+
+	bodies := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"malformed json", `{"room_id":`, http.StatusBadRequest},
+		{"unknown field", `{"room": 1}`, http.StatusBadRequest},
+		{"missing dates", `{"room_id": 1}`, http.StatusBadRequest},
+		{"invalid guest", `{"room_id": 1, "start_date": "2099-01-01", "end_date": "2099-01-03", "email": "nope"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range bodies {
+		t.Run("create reservation: "+tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.APICreateReservation(rr, httptest.NewRequest("POST", "/api/v1/reservations", strings.NewReader(tt.body)))
+			if rr.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			checkAgainstSpec(t, s, "/api/v1/reservations", "POST", rr)
+		})
+	}
+}
+
+func TestOpenAPI_APISuccess(t *testing.T) {
+	s := loadSpec(t)
+	a := newTestApp(t)
+	a.block(t, 1, 10, 13)
+
+	rr := a.get("/api/v1/rooms")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("rooms: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	checkAgainstSpec(t, s, "/api/v1/rooms", "GET", rr)
+	expectBody(t, rr, `"generals quarters"`, `"majors suite"`)
+
+	rr = a.get("/api/v1/availability?start=" + testDay(10) + "&end=" + testDay(12))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("availability: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	checkAgainstSpec(t, s, "/api/v1/availability", "GET", rr)
+	var availability struct {
+		Data apiAvailability `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &availability); err != nil {
+		t.Fatal(err)
+	}
+	if rooms := availability.Data.Rooms; len(rooms) != 2 || rooms[0].Available || !rooms[1].Available {
+		t.Errorf("expected only the majors suite to be free, got %+v", rooms)
+	}
+
+	body := `{"room_id": 2, "start_date": "` + testDay(10) + `", "end_date": "` + testDay(12) + `",
+		"first_name": "John", "last_name": "Smith", "email": "john@example.com", "phone": "555-0100"}`
+	req := httptest.NewRequest("POST", "/api/v1/reservations", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr = a.do(req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create reservation: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	checkAgainstSpec(t, s, "/api/v1/reservations", "POST", rr)
+	var created struct {
+		Data apiReservation `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if location := rr.Header().Get("Location"); created.Data.Code == "" || location != "/api/v1/reservations/"+created.Data.Code {
+		t.Fatalf("expected the location of the new reservation, got %q for %+v", location, created.Data)
+	}
+
+	rr = a.get("/api/v1/reservations/" + created.Data.Code)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reservation: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	checkAgainstSpec(t, s, "/api/v1/reservations/{code}", "GET", rr)
+	expectBody(t, rr, `"john@example.com"`)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+///-----------------Mail Outbox-----------------///
+
+// outboxPageSize is how many messages the queue page shows
+const outboxPageSize = 100
+
+// AdminMailQueue shows the outgoing mail, optionally only the messages with ?status=pending, sent or dead
+func (h *Handlers) AdminMailQueue(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != data.OutboxPending && status != data.OutboxSent && status != data.OutboxDead {
+		status = ""
+	}
+
+	messages, err := h.Models.Outbox.GetRecent(r.Context(), status, outboxPageSize)
+	if err != nil {
+		h.ErrorLog.Println("error getting mail queue:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+	counts, err := h.Models.Outbox.CountByStatus(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error counting mail queue:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["messages"] = messages
+	d["counts"] = counts
+	stringData := make(map[string]string)
+	stringData["status"] = status
+	err = h.Render.Page(w, r, "admin-mail-queue.page.tmpl", nil, &render.TemplateData{
+		Data:       d,
+		StringData: stringData,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminRequeueMail gives a dead letter a fresh set of attempts
+func (h *Handlers) AdminRequeueMail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Models.Outbox.Requeue(r.Context(), id)
+	if err != nil {
+		h.ErrorLog.Println("error requeueing mail:", err)
+		h.Session.Put(r.Context(), "error", "Could not requeue the message")
+		http.Redirect(w, r, "/admin/mail?status=dead", http.StatusSeeOther)
+		return
+	}
+	h.MailQueue.Flush()
+
+	h.Session.Put(r.Context(), "flash", "Message queued to be sent again")
+	http.Redirect(w, r, "/admin/mail?status=dead", http.StatusSeeOther)
+}
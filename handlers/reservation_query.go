@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"github.com/ahmedkhaeld/booking/data"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reservationQuery reads the filters, sort and page of a reservation listing from the query string:
+// from, to, room_id, status, q, sort, limit, after and before. It returns a message for each parameter
+// it could not use
+func reservationQuery(values url.Values) (data.ReservationQuery, map[string]string) {
+	q := data.ReservationQuery{
+		Status: values.Get("status"),
+		Text:   strings.TrimSpace(values.Get("q")),
+		Sort:   values.Get("sort"),
+		After:  values.Get("after"),
+		Before: values.Get("before"),
+	}
+	problems := make(map[string]string)
+
+	for _, field := range []string{"from", "to"} {
+		value := strings.TrimSpace(values.Get(field))
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(dateLayout, value)
+		if err != nil {
+			problems[field] = "Date must be in the form YYYY-MM-DD"
+			continue
+		}
+		if field == "from" {
+			q.From = date
+		} else {
+			q.To = date
+		}
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.To.After(q.From) {
+		problems["to"] = "The end of the period must be after its start"
+	}
+
+	if value := values.Get("room_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			problems["room_id"] = "Room must be a room id"
+		}
+		q.RoomID = id
+	}
+
+	switch q.Status {
+	case "", data.StatusNew, data.StatusProcessed:
+	default:
+		problems["status"] = "Status must be new or processed"
+	}
+
+	switch q.Sort {
+	case "", data.SortArrival, data.SortArrivalDesc, data.SortBooked, data.SortBookedDesc, data.SortGuest:
+	default:
+		problems["sort"] = "Sort must be one of arrival, -arrival, booked, -booked or guest"
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > data.MaxPageSize {
+			problems["limit"] = "Limit must be between 1 and " + strconv.Itoa(data.MaxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if q.After != "" && q.Before != "" {
+		problems["before"] = "Only one of after and before can be given"
+	}
+
+	return q, problems
+}
@@ -1,16 +1,18 @@
 package handlers
 
 import (
-	"encoding/json"
+	"database/sql"
 	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/forms"
 	"net/http"
+	"net/url"
 	"strconv"
-	"time"
 )
 
 type response struct {
 	Ok        bool   `json:"ok"`
 	Message   string `json:"message"`
+	Error     string `json:"error,omitempty"`
 	StartDate string `json:"start_date"`
 	EndDate   string `json:"end_date"`
 	RoomID    string `json:"room_id"`
@@ -18,6 +20,8 @@ type response struct {
 
 // AvailabilityJSON handles request for availability from client side [Check availability button]
 // takes start and end date, process them, search the database, and send the response back to the client
+//
+// invalid input is answered with 400 and an error code, database failures with 500
 func (h *Handlers) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	//  parse request body
 	err := r.ParseForm()
@@ -25,34 +29,53 @@ func (h *Handlers) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		// can't parse form, so return appropriate json
 		resp := response{
 			Ok:      false,
-			Message: "Internal server error",
+			Message: "Invalid request body",
+			Error:   errCodeInvalidInput,
 		}
-
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
+		h.writeResponse(w, http.StatusBadRequest, resp)
 		return
 	}
 
 	sd := r.Form.Get("start")
 	ed := r.Form.Get("end")
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	startDate, endDate, dateErr := parseDateRange(sd, ed)
+	if dateErr != nil {
+		resp := response{
+			Ok:        false,
+			Message:   dateErr.Message,
+			Error:     dateErr.Code,
+			StartDate: sd,
+			EndDate:   ed,
+			RoomID:    r.Form.Get("room_id"),
+		}
+		h.writeResponse(w, http.StatusBadRequest, resp)
+		return
+	}
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil || roomID < 1 {
+		resp := response{
+			Ok:        false,
+			Message:   "Invalid room",
+			Error:     errCodeInvalidRoom,
+			StartDate: sd,
+			EndDate:   ed,
+			RoomID:    r.Form.Get("room_id"),
+		}
+		h.writeResponse(w, http.StatusBadRequest, resp)
+		return
+	}
 
-	available, err := h.Models.Rooms.IsAvailable(roomID, startDate, endDate)
+	available, err := h.Models.Rooms.IsAvailable(r.Context(), roomID, startDate, endDate)
 	if err != nil {
 		// got a database error, so return appropriate json
+		h.ErrorLog.Println("error checking availability:", err)
 		resp := response{
 			Ok:      false,
 			Message: "Error querying database",
+			Error:   errCodeServer,
 		}
-
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
+		h.writeResponse(w, http.StatusInternalServerError, resp)
 		return
 	}
 	resp := response{
@@ -63,22 +86,42 @@ func (h *Handlers) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		RoomID:    strconv.Itoa(roomID),
 	}
 
-	out, _ := json.MarshalIndent(resp, "", "    ")
+	h.writeResponse(w, http.StatusOK, resp)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
+// writeResponse writes resp as json with the given status
+func (h *Handlers) writeResponse(w http.ResponseWriter, status int, resp response) {
+	err := h.WriteJSON(w, status, resp)
+	if err != nil {
+		h.ErrorLog.Println("error writing json:", err)
+	}
 }
 
+// BookRoom takes the room and dates from the availability modal link,
+// and starts a reservation in the session for them
 func (h *Handlers) BookRoom(w http.ResponseWriter, r *http.Request) {
-	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	roomID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || roomID < 1 {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
 	sd := r.URL.Query().Get("s")
 	ed := r.URL.Query().Get("e")
 
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	startDate, endDate, dateErr := parseDateRange(sd, ed)
+	if dateErr != nil {
+		form := forms.New(url.Values{})
+		form.Set("start", sd)
+		form.Set("end", ed)
+		h.renderAvailabilityErrors(w, r, form, dateErr)
+		return
+	}
 
-	room, err := h.Models.Rooms.GetById(roomID)
+	room, err := h.Models.Rooms.GetById(r.Context(), roomID)
+	if err == sql.ErrNoRows {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		h.ErrorStatus(w, http.StatusInternalServerError)
 		return
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ahmedkhaeld/booking/data"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkJSON posts the dates of a stay in roomID to the availability endpoint
+func checkJSON(t *testing.T, a *testApp, roomID, start, end int) (int, response) {
+	t.Helper()
+	rr := a.post("/room/check-json", url.Values{
+		"start":   {testDay(start)},
+		"end":     {testDay(end)},
+		"room_id": {strconv.Itoa(roomID)},
+	})
+	checkAgainstSpec(t, loadSpec(t), "/room/check-json", "POST", rr)
+
+	var resp response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, resp
+}
+
+func TestAvailabilityJSON_Overlap(t *testing.T) {
+	a := newTestApp(t)
+	// the generals quarters are taken for the nights of day 10, 11 and 12
+	a.block(t, 1, 10, 13)
+
+	tests := []struct {
+		name       string
+		start, end int
+		available  bool
+	}{
+		{"well before", 2, 5, true},
+		{"leaving the day it starts", 7, 10, true},
+		{"arriving the day it ends", 13, 15, true},
+		{"arriving the day it starts", 10, 11, false},
+		{"leaving the day it ends", 12, 13, false},
+		{"the same nights", 10, 13, false},
+		{"inside", 11, 12, false},
+		{"overlapping the first night", 8, 11, false},
+		{"overlapping the last night", 12, 14, false},
+		{"around", 9, 14, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := checkJSON(t, a, 1, tt.start, tt.end)
+			if status != http.StatusOK {
+				t.Fatalf("expected 200, got %d", status)
+			}
+			if resp.Ok != tt.available {
+				t.Errorf("expected ok %v, got %v", tt.available, resp.Ok)
+			}
+			if resp.Error != "" || resp.StartDate != testDay(tt.start) || resp.EndDate != testDay(tt.end) || resp.RoomID != "1" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+
+			// the other room is not affected
+			if _, resp := checkJSON(t, a, 2, tt.start, tt.end); !resp.Ok {
+				t.Error("expected the majors suite to be free")
+			}
+		})
+	}
+}
+
+func TestAvailabilityJSON_Errors(t *testing.T) {
+	a := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		code   string
+	}{
+		{"missing dates", url.Values{"room_id": {"1"}}, http.StatusBadRequest, errCodeDateMissing},
+		{"bad format", url.Values{"start": {"01/02/2030"}, "end": {testDay(5)}, "room_id": {"1"}}, http.StatusBadRequest, errCodeDateFormat},
+		{"end before start", url.Values{"start": {testDay(5)}, "end": {testDay(2)}, "room_id": {"1"}}, http.StatusBadRequest, errCodeDateOrder},
+		{"in the past", url.Values{"start": {testDay(-5)}, "end": {testDay(-1)}, "room_id": {"1"}}, http.StatusBadRequest, errCodeDatePast},
+		{"too long", url.Values{"start": {testDay(1)}, "end": {testDay(maxStayNights + 2)}, "room_id": {"1"}}, http.StatusBadRequest, errCodeDateTooLong},
+		{"invalid room", url.Values{"start": {testDay(1)}, "end": {testDay(3)}, "room_id": {"x"}}, http.StatusBadRequest, errCodeInvalidRoom},
+		{"no room", url.Values{"start": {testDay(1)}, "end": {testDay(3)}, "room_id": {"0"}}, http.StatusBadRequest, errCodeInvalidRoom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := a.post("/room/check-json", tt.form)
+			if rr.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			checkAgainstSpec(t, loadSpec(t), "/room/check-json", "POST", rr)
+
+			var resp response
+			_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+			if resp.Ok || resp.Error != tt.code || resp.Message == "" {
+				t.Errorf("expected error %s, got %+v", tt.code, resp)
+			}
+			if resp.StartDate != tt.form.Get("start") || resp.EndDate != tt.form.Get("end") || resp.RoomID != tt.form.Get("room_id") {
+				t.Errorf("expected the request to be echoed, got %+v", resp)
+			}
+		})
+	}
+
+	t.Run("database error", func(t *testing.T) {
+		a := newTestApp(t)
+		a.Models.Rooms = failingRooms{a.Models.Rooms}
+
+		status, resp := checkJSON(t, a, 1, 3, 5)
+		if status != http.StatusInternalServerError || resp.Ok || resp.Error != errCodeServer {
+			t.Errorf("expected a server error, got %d %+v", status, resp)
+		}
+	})
+}
+
+func TestRoomCalendar_LeavesOutImportedBlocks(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+	a.block(t, 1, 10, 13)
+	// a booking another platform sent us through its calendar
+	_, err := a.Models.Restrictions.Create(ctx, data.Restriction{Type: data.RestrictionExternal, RoomID: 1,
+		ICalImportID: 1, ExternalUID: "abc@airbnb.com", StartDate: testDate(t, 20), EndDate: testDate(t, 22)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room, _ := a.Models.Rooms.GetById(ctx, 1)
+	rr := a.get("/calendars/rooms/" + room.ICalToken + ".ics")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if n := strings.Count(rr.Body.String(), "BEGIN:VEVENT"); n != 1 {
+		t.Errorf("expected only the owner block, got %d events:\n%s", n, rr.Body.String())
+	}
+	expectBody(t, rr, "SUMMARY:Blocked")
+}
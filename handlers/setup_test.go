@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/emails"
+	"github.com/ahmedkhaeld/booking/jobs"
+	"github.com/ahmedkhaeld/jazz"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errDatabase is what the failing fakes answer
+var errDatabase = errors.New("database is down")
+
+// testApp serves the guest pages of the handlers the way routes.go does, backed by the in-memory models,
+// a memory session store and the real views. It keeps the session cookie between requests like a browser
+type testApp struct {
+	*Handlers
+	router  *chi.Mux
+	mail    *recordingSender
+	cookies []*http.Cookie
+}
+
+// newTestApp returns a testApp with two rooms, generals quarters (id 1) and majors suite (id 2)
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	gob.Register(data.Reservation{})
+
+	session := scs.New()
+	logger := log.New(io.Discard, "", 0)
+	models := data.NewMemory()
+	mail := &recordingSender{}
+
+	h := &Handlers{
+		Jazz: &jazz.Jazz{
+			ErrorLog: logger,
+			InfoLog:  logger,
+			Session:  session,
+			Render: &render.Render{
+				Renderer: "go",
+				RootPath: "..",
+				Session:  session,
+			},
+		},
+		Models:    models,
+		MailQueue: jobs.NewMailQueue(models, mail, logger, logger),
+		Emails: emails.Config{
+			From:         "stay@booking.example",
+			SiteURL:      "https://booking.example/",
+			PropertyName: "Fort Smythe Bed and Breakfast",
+			Currency:     "USD",
+			CheckIn:      "15:00",
+			CheckOut:     "11:00",
+			Location:     time.UTC,
+			Owners:       []string{"owner@booking.example"},
+		},
+	}
+
+	ctx := context.Background()
+	for _, room := range []data.Room{{Name: "Generals Quarters", NightlyRate: 8900}, {Name: "Majors Suite", NightlyRate: 12900}} {
+		if _, err := models.Rooms.Create(ctx, room); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := chi.NewRouter()
+	router.Use(session.LoadAndSave)
+	router.Post("/room/check-json", h.AvailabilityJSON)
+	router.Get("/bookings/room", h.BookRoom)
+	router.Get("/check/rooms", h.Availability)
+	router.Post("/check/rooms", h.PostAvailability)
+	router.Get("/check/rooms/{id}", h.ChooseRoom)
+	router.Get("/bookings/reservation", h.Reservation)
+	router.Post("/bookings/reservation", h.PostReservation)
+	router.Get("/booking/reservation-summary", h.ReservationSummary)
+	router.Get("/calendars/rooms/{token}.ics", h.RoomCalendar)
+	// the staff pages and the api, without the login and api key checks in front of them
+	router.Get("/admin/reservations", h.AdminReservations)
+	router.Get("/admin/search", h.AdminSearch)
+	router.Get("/admin/reservations/{id}/history", h.AdminReservationHistory)
+	router.Get("/admin/guests/{id}", h.AdminShowGuest)
+	router.Post("/admin/guests/{id}/merge", h.AdminMergeGuest)
+	router.Post("/user/login", h.PostUserLogin)
+	router.Get("/admin/api-keys", h.AdminAPIKeys)
+	router.Post("/admin/api-keys", h.AdminPostAPIKey)
+	router.Get("/api/v1/rooms", h.APIRooms)
+	router.Get("/api/v1/availability", h.APIAvailability)
+	router.Post("/api/v1/reservations", h.APICreateReservation)
+	router.Get("/api/v1/reservations", h.APIReservations)
+	router.Get("/api/v1/reservations/{code}", h.APIReservation)
+
+	return &testApp{Handlers: h, router: router, mail: mail}
+}
+
+// get requests target with the session of the earlier requests
+func (a *testApp) get(target string) *httptest.ResponseRecorder {
+	return a.do(httptest.NewRequest("GET", target, nil))
+}
+
+// post submits form to target with the session of the earlier requests
+func (a *testApp) post(target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.do(req)
+}
+
+func (a *testApp) do(req *http.Request) *httptest.ResponseRecorder {
+	for _, c := range a.cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	a.router.ServeHTTP(rr, req)
+	if cookies := rr.Result().Cookies(); len(cookies) > 0 {
+		a.cookies = cookies
+	}
+	return rr
+}
+
+// block books roomID for the nights from start to end days from today, like another guest would
+func (a *testApp) block(t *testing.T, roomID, start, end int) {
+	t.Helper()
+	_, err := a.Models.Restrictions.Create(context.Background(), data.Restriction{
+		Type:      data.RestrictionOwner,
+		RoomID:    roomID,
+		StartDate: testDate(t, start),
+		EndDate:   testDate(t, end),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testDay formats the day n days from today the way the forms send dates
+func testDay(n int) string {
+	return time.Now().AddDate(0, 0, n).Format(dateLayout)
+}
+
+// testDate is the day n days from today as the handlers parse it
+func testDate(t *testing.T, n int) time.Time {
+	t.Helper()
+	d, err := time.Parse(dateLayout, testDay(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// expectRedirect fails the test unless rr redirects to location
+func expectRedirect(t *testing.T, rr *httptest.ResponseRecorder, location string) {
+	t.Helper()
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect to %s, got %d: %s", location, rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Location"); got != location {
+		t.Fatalf("expected a redirect to %s, got %s", location, got)
+	}
+}
+
+// expectBody fails the test unless the body of rr contains every one of want
+func expectBody(t *testing.T, rr *httptest.ResponseRecorder, want ...string) {
+	t.Helper()
+	for _, s := range want {
+		if !strings.Contains(rr.Body.String(), s) {
+			t.Errorf("expected the page to contain %q, got:\n%s", s, rr.Body.String())
+		}
+	}
+}
+
+// recordingSender keeps the mail the queue sends
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (s *recordingSender) Send(msg mailer.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func (s *recordingSender) messages() []mailer.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mailer.Message(nil), s.sent...)
+}
+
+// failingRooms is a room repository whose availability queries fail
+type failingRooms struct {
+	data.RoomRepository
+}
+
+func (failingRooms) IsAvailable(context.Context, int, time.Time, time.Time) (bool, error) {
+	return false, errDatabase
+}
+
+func (failingRooms) GetAnyAvailable(context.Context, time.Time, time.Time) ([]data.Room, error) {
+	return nil, errDatabase
+}
+
+// staleRooms is a room repository whose availability check outside the booking transaction always finds the room
+// free, like one made just before another booking took it
+type staleRooms struct {
+	data.RoomRepository
+}
+
+func (staleRooms) IsAvailable(context.Context, int, time.Time, time.Time) (bool, error) {
+	return true, nil
+}
+
+// failingReservations is a reservation repository that cannot store new reservations
+type failingReservations struct {
+	data.ReservationRepository
+}
+
+func (failingReservations) CreateTx(context.Context, *data.Tx, data.Reservation) (int, error) {
+	return 0, errDatabase
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/forms"
+	"github.com/ahmedkhaeld/jazz/render"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+///-----------------Webhooks-----------------///
+
+// deliveryLogPageSize is how many deliveries the log page shows
+const deliveryLogPageSize = 100
+
+// AdminWebhooks lists the webhook endpoints and shows the form to add one
+func (h *Handlers) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	h.renderWebhooks(w, r, forms.New(nil))
+}
+
+func (h *Handlers) renderWebhooks(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	hooks, err := h.Models.Webhooks.GetAll(r.Context())
+	if err != nil {
+		h.ErrorLog.Println("error getting webhooks:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["webhooks"] = hooks
+	d["events"] = data.AllWebhookEvents
+	err = h.Render.Page(w, r, "admin-webhooks.page.tmpl", nil, &render.TemplateData{
+		Form: form,
+		Data: d,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminPostWebhook adds a webhook endpoint with a new signing secret
+func (h *Handlers) AdminPostWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+
+	endpoint := strings.TrimSpace(form.Get("url"))
+	if u, err := url.Parse(endpoint); form.Has("url") && (err != nil || u.Host == "" ||
+		(u.Scheme != "http" && u.Scheme != "https")) {
+		form.Errors.Add("url", "Enter the http or https address of the endpoint")
+	}
+
+	events := make([]string, 0, len(data.AllWebhookEvents))
+	for _, e := range r.PostForm["events"] {
+		for _, known := range data.AllWebhookEvents {
+			if e == known {
+				events = append(events, e)
+			}
+		}
+	}
+	if len(events) == 0 {
+		form.Errors.Add("events", "Select at least one event")
+	}
+
+	if !form.Valid() {
+		h.renderWebhooks(w, r, form)
+		return
+	}
+
+	_, err = h.Models.Webhooks.Insert(r.Context(), data.Webhook{URL: endpoint, Events: events})
+	if err != nil {
+		h.ErrorLog.Println("error adding webhook:", err)
+		h.Session.Put(r.Context(), "error", "Could not add the webhook")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Webhook added")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminDeleteWebhook stops sending events to an endpoint
+func (h *Handlers) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Models.Webhooks.Delete(r.Context(), id)
+	if err != nil {
+		h.ErrorLog.Println("error deleting webhook:", err)
+		h.Session.Put(r.Context(), "error", "Could not remove the webhook")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", "Webhook removed")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminWebhookDeliveries shows the latest deliveries to every endpoint
+func (h *Handlers) AdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.Models.Deliveries.GetRecent(r.Context(), deliveryLogPageSize)
+	if err != nil {
+		h.ErrorLog.Println("error getting webhook deliveries:", err)
+		h.ErrorStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	d := make(map[string]interface{})
+	d["deliveries"] = deliveries
+	err = h.Render.Page(w, r, "admin-webhook-deliveries.page.tmpl", nil, &render.TemplateData{
+		Data: d,
+	})
+	if err != nil {
+		h.ErrorLog.Println("error rendering:", err)
+	}
+}
+
+// AdminReplayWebhookDelivery sends a delivery again, e.g. after the receiver fixed a bug
+func (h *Handlers) AdminReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.ErrorStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	newID, err := h.Webhooks.Replay(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.ErrorStatus(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Println("error replaying webhook delivery:", err)
+		h.Session.Put(r.Context(), "error", "Could not replay the delivery")
+		http.Redirect(w, r, "/admin/webhooks/deliveries", http.StatusSeeOther)
+		return
+	}
+
+	h.Session.Put(r.Context(), "flash", fmt.Sprintf("Delivery %d queued as %d", id, newID))
+	http.Redirect(w, r, "/admin/webhooks/deliveries", http.StatusSeeOther)
+}
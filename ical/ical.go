@@ -0,0 +1,149 @@
+// Package ical reads and writes the subset of iCalendar (RFC 5545) the booking app needs:
+// a calendar of VEVENTs with all-day or timed start and end.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// dateLayout and dateTimeLayout are the RFC 5545 DATE and UTC DATE-TIME formats
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405Z"
+)
+
+// maxLineOctets is the longest content line allowed before it has to be folded
+const maxLineOctets = 75
+
+// Calendar is a VCALENDAR object
+type Calendar struct {
+	ProdID string
+	Name   string
+	Method string
+	Events []Event
+}
+
+// Event is a VEVENT.
+//
+// when AllDay is set only the dates of Start and End are used, and End is exclusive (the checkout day)
+type Event struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Stamp        time.Time
+	LastModified time.Time
+	Sequence     int
+	Status       string
+	Organizer    string
+}
+
+// Encode writes the calendar in iCalendar format
+func (c *Calendar) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	l := &lineWriter{w: bw}
+
+	l.line("BEGIN:VCALENDAR")
+	l.line("VERSION:2.0")
+	l.line("PRODID:" + c.ProdID)
+	l.line("CALSCALE:GREGORIAN")
+	if c.Method != "" {
+		l.line("METHOD:" + c.Method)
+	}
+	if c.Name != "" {
+		l.line("X-WR-CALNAME:" + escapeText(c.Name))
+	}
+
+	for _, e := range c.Events {
+		l.line("BEGIN:VEVENT")
+		l.line("UID:" + e.UID)
+		stamp := e.Stamp
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+		l.line("DTSTAMP:" + stamp.UTC().Format(dateTimeLayout))
+		if e.AllDay {
+			l.line("DTSTART;VALUE=DATE:" + e.Start.Format(dateLayout))
+			l.line("DTEND;VALUE=DATE:" + e.End.Format(dateLayout))
+		} else {
+			l.line("DTSTART:" + e.Start.UTC().Format(dateTimeLayout))
+			l.line("DTEND:" + e.End.UTC().Format(dateTimeLayout))
+		}
+		if !e.LastModified.IsZero() {
+			l.line("LAST-MODIFIED:" + e.LastModified.UTC().Format(dateTimeLayout))
+		}
+		if e.Sequence > 0 {
+			l.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		}
+		l.line("SUMMARY:" + escapeText(e.Summary))
+		if e.Description != "" {
+			l.line("DESCRIPTION:" + escapeText(e.Description))
+		}
+		if e.Location != "" {
+			l.line("LOCATION:" + escapeText(e.Location))
+		}
+		if e.Organizer != "" {
+			l.line("ORGANIZER:mailto:" + e.Organizer)
+		}
+		if e.Status != "" {
+			l.line("STATUS:" + e.Status)
+		}
+		l.line("TRANSP:OPAQUE")
+		l.line("END:VEVENT")
+	}
+
+	l.line("END:VCALENDAR")
+	if l.err != nil {
+		return l.err
+	}
+	return bw.Flush()
+}
+
+// lineWriter writes CRLF terminated content lines, folding long ones, and remembers the first error
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (l *lineWriter) line(s string) {
+	if l.err != nil {
+		return
+	}
+	_, l.err = l.w.WriteString(fold(s) + "\r\n")
+}
+
+// fold splits a content line into chunks of at most 75 octets, continuation lines start with a space.
+// It never splits inside a multi-byte utf-8 character
+func fold(s string) string {
+	if len(s) <= maxLineOctets {
+		return s
+	}
+	var b strings.Builder
+	limit := maxLineOctets
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > limit {
+			b.WriteString("\r\n ")
+			// the leading space counts towards the next line
+			limit = maxLineOctets - 1
+			n = 0
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
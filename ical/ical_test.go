@@ -0,0 +1,130 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar_Encode(t *testing.T) {
+	c := Calendar{
+		ProdID: "-//Booking//EN",
+		Name:   "Room, one",
+		Events: []Event{{
+			UID:     "restriction-1@example.com",
+			Summary: "Reserved; guest",
+			Start:   time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC),
+			End:     time.Date(2030, 1, 5, 0, 0, 0, 0, time.UTC),
+			AllDay:  true,
+			Stamp:   time.Date(2029, 12, 1, 10, 30, 0, 0, time.UTC),
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := c.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Room\\, one\r\n",
+		"UID:restriction-1@example.com\r\n",
+		"DTSTAMP:20291201T103000Z\r\n",
+		"DTSTART;VALUE=DATE:20300102\r\n",
+		"DTEND;VALUE=DATE:20300105\r\n",
+		"SUMMARY:Reserved\\; guest\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q\n%s", want, out)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("é", 60)
+	folded := fold(long)
+	for i, line := range strings.Split(folded, "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line %d is %d octets long", i, len(line))
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d does not start with a space", i)
+		}
+	}
+	if strings.ReplaceAll(folded, "\r\n ", "") != long {
+		t.Error("unfolding does not give back the original line")
+	}
+}
+
+func TestParse(t *testing.T) {
+	feed := "BEGIN:VCALENDAR\r\n" +
+		"PRODID:-//Other Platform//EN\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:abc-1@other\r\n" +
+		"DTSTART;VALUE=DATE:20300102\r\n" +
+		"DTEND;VALUE=DATE:20300105\r\n" +
+		"SUMMARY:Reserved\\, thanks\r\n" +
+		"DESCRIPTION:a long description that was folded by the other platform because it is lo\r\n" +
+		" nger than seventy five octets\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"SUMMARY:not the event summary\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:abc-2@other\r\n" +
+		"DTSTART;TZID=Europe/Berlin:20300110T150000\r\n" +
+		"DTEND;TZID=Europe/Berlin:20300112T110000\r\n" +
+		"STATUS:cancelled\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:abc-3@other\r\n" +
+		"DTSTART;VALUE=DATE:20300201\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	cal, err := Parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(cal.Events))
+	}
+
+	first := cal.Events[0]
+	if first.UID != "abc-1@other" || first.Summary != "Reserved, thanks" || !first.AllDay {
+		t.Errorf("first event parsed wrong: %+v", first)
+	}
+	if !strings.HasSuffix(first.Description, "longer than seventy five octets") {
+		t.Errorf("folded description not unfolded: %q", first.Description)
+	}
+	start, end := first.Dates()
+	if start.Format("2006-01-02") != "2030-01-02" || end.Format("2006-01-02") != "2030-01-05" {
+		t.Errorf("expected 2030-01-02 to 2030-01-05, got %s to %s", start, end)
+	}
+
+	second := cal.Events[1]
+	if second.Status != "CANCELLED" {
+		t.Errorf("expected status CANCELLED, got %q", second.Status)
+	}
+	if second.Start.UTC().Hour() != 14 {
+		t.Errorf("expected TZID to be applied, got %s", second.Start.UTC())
+	}
+
+	// an all-day event without DTEND lasts one day
+	start, end = cal.Events[2].Dates()
+	if end.Sub(start) != 24*time.Hour {
+		t.Errorf("expected a one day event, got %s to %s", start, end)
+	}
+}
+
+func TestParse_NotCalendar(t *testing.T) {
+	_, err := Parse(strings.NewReader("<html>not found</html>"))
+	if err == nil {
+		t.Error("expected an error for html input")
+	}
+}
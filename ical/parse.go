@@ -0,0 +1,202 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned by Parse when the input has no VCALENDAR
+var ErrNotCalendar = errors.New("ical: not an iCalendar document")
+
+// Parse reads a calendar and its VEVENTs. Properties and components it does not know are skipped,
+// so feeds from other booking platforms with their own extensions still parse
+func Parse(r io.Reader) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cal *Calendar
+	var event *Event
+	// depth of components nested inside the current event, e.g. VALARM
+	nested := 0
+
+	for n, raw := range lines {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		name, params, value, err := splitLine(raw)
+		if err != nil {
+			return nil, fmt.Errorf("ical: line %d: %w", n+1, err)
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VCALENDAR":
+			cal = &Calendar{}
+		case cal == nil:
+			return nil, ErrNotCalendar
+		case name == "BEGIN" && value == "VEVENT" && event == nil:
+			event = &Event{}
+		case name == "BEGIN":
+			nested++
+		case name == "END" && nested > 0:
+			nested--
+		case name == "END" && value == "VEVENT" && event != nil:
+			if event.End.IsZero() {
+				event.End = event.Start
+				if event.AllDay {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+			}
+			cal.Events = append(cal.Events, *event)
+			event = nil
+		case name == "END" && value == "VCALENDAR":
+			return cal, nil
+		case nested > 0:
+			// property of a component we do not care about
+		case event != nil:
+			err = event.set(name, params, value)
+			if err != nil {
+				return nil, fmt.Errorf("ical: line %d: %w", n+1, err)
+			}
+		default:
+			cal.set(name, value)
+		}
+	}
+
+	if cal == nil {
+		return nil, ErrNotCalendar
+	}
+	return nil, errors.New("ical: missing END:VCALENDAR")
+}
+
+func (c *Calendar) set(name, value string) {
+	switch name {
+	case "PRODID":
+		c.ProdID = value
+	case "METHOD":
+		c.Method = value
+	case "X-WR-CALNAME":
+		c.Name = unescapeText(value)
+	}
+}
+
+func (e *Event) set(name string, params map[string]string, value string) error {
+	var err error
+	switch name {
+	case "UID":
+		e.UID = value
+	case "SUMMARY":
+		e.Summary = unescapeText(value)
+	case "DESCRIPTION":
+		e.Description = unescapeText(value)
+	case "LOCATION":
+		e.Location = unescapeText(value)
+	case "STATUS":
+		e.Status = strings.ToUpper(value)
+	case "SEQUENCE":
+		e.Sequence, err = strconv.Atoi(value)
+	case "DTSTART":
+		e.Start, e.AllDay, err = parseTime(params, value)
+	case "DTEND":
+		e.End, _, err = parseTime(params, value)
+	case "DTSTAMP":
+		e.Stamp, _, err = parseTime(params, value)
+	case "LAST-MODIFIED":
+		e.LastModified, _, err = parseTime(params, value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// Dates returns the nights the event covers as dates at midnight UTC, with the end exclusive.
+// Timed events cover every day they touch the night of, and always at least one night
+func (e *Event) Dates() (time.Time, time.Time) {
+	start := time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(e.End.Year(), e.End.Month(), e.End.Day(), 0, 0, 0, 0, time.UTC)
+	if !end.After(start) {
+		end = start.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// parseTime reads a DATE or DATE-TIME value, honouring a TZID parameter.
+// Floating times without a zone are read as UTC
+func parseTime(params map[string]string, value string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeLayout, value)
+		return t, false, err
+	}
+
+	loc := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(strings.Trim(tzid, `"`))
+		if err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// unfold joins folded content lines back together
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// splitLine splits "NAME;PARAM=VALUE:value" into its parts; parameter values may be quoted
+func splitLine(line string) (string, map[string]string, string, error) {
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		}
+		if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", fmt.Errorf("no ':' in %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = v
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], nil
+}
+
+// unescapeText reverses escapeText
+func unescapeText(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
@@ -0,0 +1,16 @@
+package jobs
+
+import "time"
+
+// backoff is how long to wait after the given number of failed attempts:
+// base after the first, doubling after every other one, and never more than max
+func backoff(attempts int, base, max time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= max {
+			return max
+		}
+	}
+	return wait
+}
@@ -0,0 +1,221 @@
+// Package jobs holds the background work the app runs on its scheduler
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/ical"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxFeedBytes caps how much of a feed is read, a room calendar is a few kilobytes
+const maxFeedBytes = 5 << 20
+
+// CalendarImporter keeps the external restrictions of each room in sync with the
+// calendar feeds of the other platforms the room is sold on
+type CalendarImporter struct {
+	Models   data.Models
+	Client   *http.Client
+	Webhooks *Webhooks
+	ErrorLog *log.Logger
+	InfoLog  *log.Logger
+}
+
+func NewCalendarImporter(models data.Models, webhooks *Webhooks, errorLog, infoLog *log.Logger) *CalendarImporter {
+	return &CalendarImporter{
+		Models:   models,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		Webhooks: webhooks,
+		ErrorLog: errorLog,
+		InfoLog:  infoLog,
+	}
+}
+
+// SyncAll syncs every import one after another; a broken feed does not stop the others
+func (c *CalendarImporter) SyncAll() {
+	ctx := context.Background()
+	imports, err := c.Models.ICalImports.GetAll(ctx)
+	if err != nil {
+		c.ErrorLog.Println("error getting calendar imports:", err)
+		return
+	}
+	for _, imp := range imports {
+		entry, err := c.Sync(ctx, imp)
+		if err != nil {
+			c.ErrorLog.Printf("error syncing calendar %d (%s): %s", imp.ID, imp.Name, err)
+			continue
+		}
+		c.InfoLog.Printf("synced calendar %d (%s): %d created, %d updated, %d deleted",
+			imp.ID, imp.Name, entry.Created, entry.Updated, entry.Deleted)
+	}
+}
+
+// Sync fetches the feed of imp and reconciles it with the restrictions made by earlier syncs.
+// Every run is written to the sync log, whether it worked or not
+func (c *CalendarImporter) Sync(ctx context.Context, imp data.ICalImport) (data.ICalSyncLog, error) {
+	entry := data.ICalSyncLog{
+		ICalImportID: imp.ID,
+		Status:       data.SyncStatusOK,
+		StartedAt:    time.Now(),
+	}
+
+	err := c.sync(ctx, imp, &entry)
+	if err != nil {
+		entry.Status = data.SyncStatusError
+		entry.Message = err.Error()
+	}
+	entry.FinishedAt = time.Now()
+
+	if logErr := c.Models.ICalSyncLogs.Insert(ctx, entry); logErr != nil {
+		c.ErrorLog.Println("error writing calendar sync log:", logErr)
+	}
+	if markErr := c.Models.ICalImports.MarkSynced(ctx, imp.ID, entry.Status, entry.FinishedAt); markErr != nil {
+		c.ErrorLog.Println("error marking calendar import synced:", markErr)
+	}
+	return entry, err
+}
+
+func (c *CalendarImporter) sync(ctx context.Context, imp data.ICalImport, entry *data.ICalSyncLog) error {
+	cal, err := c.fetch(ctx, imp.URL)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.Models.Restrictions.GetForImport(ctx, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	changes := plan(existing, cal.Events)
+
+	// the plan is applied whole or not at all, so a failure halfway does not leave the room
+	// half synced until the next run; the sync log counts only what was committed
+	var created []data.Restriction
+	err = c.Models.Transaction(ctx, func(tx *data.Tx) error {
+		for _, rest := range changes.create {
+			rest.Type = data.RestrictionExternal
+			rest.RoomID = imp.RoomID
+			rest.ICalImportID = imp.ID
+			rest.ID, err = c.Models.Restrictions.CreateTx(ctx, tx, rest)
+			if err != nil {
+				return fmt.Errorf("creating restriction for %s: %w", rest.ExternalUID, err)
+			}
+			created = append(created, rest)
+		}
+		for _, rest := range changes.update {
+			err = c.Models.Restrictions.UpdateDatesTx(ctx, tx, rest.ID, rest.StartDate, rest.EndDate)
+			if err != nil {
+				return fmt.Errorf("updating restriction %d: %w", rest.ID, err)
+			}
+		}
+		for _, id := range changes.delete {
+			err = c.Models.Restrictions.DeleteTx(ctx, tx, id)
+			if err != nil {
+				return fmt.Errorf("deleting restriction %d: %w", id, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	entry.Created = len(created)
+	entry.Updated = len(changes.update)
+	entry.Deleted = len(changes.delete)
+	// the webhooks go out once the restrictions are stored, never for a sync that was rolled back
+	for _, rest := range created {
+		c.Webhooks.Publish(ctx, data.EventRestrictionCreated, NewRestrictionPayload(rest))
+	}
+	return nil
+}
+
+// fetch downloads and parses a feed. webcal:// links, as most platforms hand them out, are fetched over https
+func (c *CalendarImporter) fetch(ctx context.Context, url string) (*ical.Calendar, error) {
+	if strings.HasPrefix(url, "webcal://") {
+		url = "https://" + strings.TrimPrefix(url, "webcal://")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %s", resp.Status)
+	}
+
+	cal, err := ical.Parse(io.LimitReader(resp.Body, maxFeedBytes))
+	if errors.Is(err, ical.ErrNotCalendar) {
+		return nil, fmt.Errorf("feed is not a calendar, check the url")
+	}
+	return cal, err
+}
+
+// changes is what a sync has to do to make the restrictions match the feed
+type changes struct {
+	create []data.Restriction
+	update []data.Restriction
+	delete []int
+}
+
+// plan compares the restrictions of an import with the events now in its feed, matching them by UID.
+// New events are created, moved ones updated, and restrictions whose event is gone or cancelled deleted
+func plan(existing []data.Restriction, events []ical.Event) changes {
+	var ch changes
+
+	byUID := make(map[string]data.Restriction, len(existing))
+	for _, rest := range existing {
+		byUID[rest.ExternalUID] = rest
+	}
+
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		// an event without a UID cannot be reconciled, and a UID repeats for changed instances of
+		// recurring events which room feeds do not use; the first one wins
+		if e.UID == "" || seen[e.UID] || e.Status == "CANCELLED" {
+			continue
+		}
+		seen[e.UID] = true
+
+		start, end := e.Dates()
+		rest, ok := byUID[e.UID]
+		switch {
+		case !ok:
+			ch.create = append(ch.create, data.Restriction{
+				StartDate:   start,
+				EndDate:     end,
+				ExternalUID: e.UID,
+			})
+		case !sameDay(rest.StartDate, start) || !sameDay(rest.EndDate, end):
+			rest.StartDate = start
+			rest.EndDate = end
+			ch.update = append(ch.update, rest)
+		}
+	}
+
+	for _, rest := range existing {
+		if !seen[rest.ExternalUID] {
+			ch.delete = append(ch.delete, rest.ID)
+		}
+	}
+	return ch
+}
+
+// sameDay compares dates only, the database hands dates back without a zone
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/ical"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const feed = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Other Platform//Hosting Calendar 1.0//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20300105\r\n" +
+	"DTEND;VALUE=DATE:20300108\r\n" +
+	"UID:abc-1@platform.example\r\n" +
+	"SUMMARY:Reserved\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20300110\r\n" +
+	"DTEND;VALUE=DATE:20300112\r\n" +
+	"UID:abc-2@platform.example\r\n" +
+	"SUMMARY:Not available\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func newTestImporter(client *http.Client) *CalendarImporter {
+	return &CalendarImporter{Client: client}
+}
+
+func TestCalendarImporter_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/room.ics":
+			w.Header().Set("Content-Type", "text/calendar")
+			w.Write([]byte(feed))
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>Sign in</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestImporter(srv.Client())
+
+	cal, err := c.fetch(context.Background(), srv.URL+"/room.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(cal.Events))
+	}
+	if cal.Events[0].UID != "abc-1@platform.example" {
+		t.Errorf("unexpected uid %q", cal.Events[0].UID)
+	}
+
+	_, err = c.fetch(context.Background(), srv.URL+"/missing.ics")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+
+	_, err = c.fetch(context.Background(), srv.URL+"/login")
+	if err == nil {
+		t.Error("expected an error for a page that is not a calendar")
+	}
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func event(uid, start, end string) ical.Event {
+	return ical.Event{UID: uid, Start: date(start), End: date(end), AllDay: true}
+}
+
+func TestPlan(t *testing.T) {
+	existing := []data.Restriction{
+		{ID: 1, ExternalUID: "same", StartDate: date("2030-01-05"), EndDate: date("2030-01-08")},
+		{ID: 2, ExternalUID: "moved", StartDate: date("2030-02-01"), EndDate: date("2030-02-03")},
+		{ID: 3, ExternalUID: "gone", StartDate: date("2030-03-01"), EndDate: date("2030-03-02")},
+		{ID: 4, ExternalUID: "cancelled", StartDate: date("2030-04-01"), EndDate: date("2030-04-02")},
+	}
+	cancelled := event("cancelled", "2030-04-01", "2030-04-02")
+	cancelled.Status = "CANCELLED"
+	events := []ical.Event{
+		event("same", "2030-01-05", "2030-01-08"),
+		event("moved", "2030-02-02", "2030-02-04"),
+		event("new", "2030-05-10", "2030-05-12"),
+		event("new", "2030-06-10", "2030-06-12"),
+		event("", "2030-07-01", "2030-07-02"),
+		cancelled,
+	}
+
+	ch := plan(existing, events)
+
+	if len(ch.create) != 1 || ch.create[0].ExternalUID != "new" || !ch.create[0].StartDate.Equal(date("2030-05-10")) {
+		t.Errorf("expected the first \"new\" event to be created, got %+v", ch.create)
+	}
+	if len(ch.update) != 1 || ch.update[0].ID != 2 ||
+		!ch.update[0].StartDate.Equal(date("2030-02-02")) || !ch.update[0].EndDate.Equal(date("2030-02-04")) {
+		t.Errorf("expected restriction 2 to move, got %+v", ch.update)
+	}
+	if len(ch.delete) != 2 || ch.delete[0] != 3 || ch.delete[1] != 4 {
+		t.Errorf("expected restrictions 3 and 4 to be deleted, got %v", ch.delete)
+	}
+}
+
+func TestPlan_Empty(t *testing.T) {
+	ch := plan(nil, nil)
+	if len(ch.create)+len(ch.update)+len(ch.delete) != 0 {
+		t.Errorf("expected no changes, got %+v", ch)
+	}
+}
+
+// failingDeletes is a restriction repository that cannot delete inside a transaction
+type failingDeletes struct {
+	data.RestrictionRepository
+}
+
+func (failingDeletes) DeleteTx(context.Context, *data.Tx, int) error {
+	return errors.New("database is down")
+}
+
+func TestCalendarImporter_SyncIsAllOrNothing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(feed))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	models := data.NewMemory()
+	room, _ := models.Rooms.Create(ctx, data.Room{Name: "Generals Quarters"})
+	id, err := models.ICalImports.Insert(ctx, data.ICalImport{RoomID: room, Name: "Platform", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp, _ := models.ICalImports.GetByID(ctx, id)
+	// a booking that was cancelled on the platform since the last sync
+	_, err = models.Restrictions.Create(ctx, data.Restriction{Type: data.RestrictionExternal, RoomID: room,
+		ICalImportID: id, ExternalUID: "gone@platform.example", StartDate: date("2030-02-01"), EndDate: date("2030-02-03")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestImporter(srv.Client())
+	c.Models = models
+	c.Models.Restrictions = failingDeletes{models.Restrictions}
+	entry, err := c.Sync(ctx, imp)
+	if err == nil {
+		t.Fatal("expected the sync to fail")
+	}
+	if entry.Status != data.SyncStatusError || entry.Created != 0 || entry.Deleted != 0 {
+		t.Errorf("expected a failed run that changed nothing, got %+v", entry)
+	}
+	restrictions, _ := models.Restrictions.GetForImport(ctx, id)
+	if len(restrictions) != 1 || restrictions[0].ExternalUID != "gone@platform.example" {
+		t.Errorf("expected the events of the feed to be rolled back, got %+v", restrictions)
+	}
+
+	c.Models = models
+	entry, err = c.Sync(ctx, imp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Created != 2 || entry.Deleted != 1 {
+		t.Errorf("expected 2 created and 1 deleted, got %+v", entry)
+	}
+	if restrictions, _ := models.Restrictions.GetForImport(ctx, id); len(restrictions) != 2 {
+		t.Errorf("expected the events of the feed, got %+v", restrictions)
+	}
+}
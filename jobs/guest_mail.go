@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"context"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/emails"
+	"log"
+	"sync"
+	"time"
+)
+
+// thankYouWindow is how many days after checkout a missed thank-you is still sent
+const thankYouWindow = 7
+
+// GuestMail sends the scheduled mail of a stay: a reminder before arrival and a thank-you after checkout.
+// Every mail is recorded per reservation in the same transaction that queues it, so each is sent once
+// however often the job runs
+type GuestMail struct {
+	Models    data.Models
+	MailQueue *MailQueue
+	Emails    emails.Config
+	// ReminderDays is how many days before arrival the reminder is sent, 0 sends none
+	ReminderDays int
+	ErrorLog     *log.Logger
+	InfoLog      *log.Logger
+
+	mu sync.Mutex
+}
+
+func NewGuestMail(models data.Models, queue *MailQueue, config emails.Config, reminderDays int, errorLog, infoLog *log.Logger) *GuestMail {
+	return &GuestMail{
+		Models:       models,
+		MailQueue:    queue,
+		Emails:       config,
+		ReminderDays: reminderDays,
+		ErrorLog:     errorLog,
+		InfoLog:      infoLog,
+	}
+}
+
+// RunDaily queues the reminders and thank-yous that are due; the scheduler runs it once a day
+func (g *GuestMail) RunDaily() {
+	g.runOn(startOfDay(time.Now()))
+}
+
+// runOn queues the reminders and thank-yous that are due on the day today
+func (g *GuestMail) runOn(today time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ctx := context.Background()
+
+	if g.ReminderDays > 0 {
+		reservations, err := g.Models.ReservationMails.GetArriving(ctx, today, g.ReminderDays, emails.Reminder)
+		if err != nil {
+			g.ErrorLog.Println("error getting reservations to remind:", err)
+		} else {
+			g.queue(ctx, emails.Reminder, reservations)
+		}
+	}
+
+	reservations, err := g.Models.ReservationMails.GetDeparted(ctx, today, thankYouWindow, emails.ThankYou)
+	if err != nil {
+		g.ErrorLog.Println("error getting reservations to thank:", err)
+	} else {
+		g.queue(ctx, emails.ThankYou, reservations)
+	}
+
+	g.MailQueue.Flush()
+}
+
+// queue records and queues the mail of kind for each reservation, skipping the ones that already have it
+func (g *GuestMail) queue(ctx context.Context, kind string, reservations []data.Reservation) {
+	sent := 0
+	for _, res := range reservations {
+		var recorded bool
+		err := g.Models.Transaction(ctx, func(tx *data.Tx) error {
+			var err error
+			recorded, err = g.Models.ReservationMails.RecordTx(ctx, tx, res.ID, kind)
+			if err != nil || !recorded {
+				return err
+			}
+			return g.MailQueue.EnqueueTx(ctx, tx, g.Emails.Guest(kind, res))
+		})
+		if err != nil {
+			g.ErrorLog.Printf("error queueing %s for reservation %s: %s", kind, res.Code, err)
+			continue
+		}
+		if recorded {
+			sent++
+		}
+	}
+	if sent > 0 {
+		g.InfoLog.Printf("queued %d %s mails", sent, kind)
+	}
+}
+
+// startOfDay is midnight of the day of t, in its location; reservation dates have no time of day
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/emails"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestStartOfDay(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	got := startOfDay(time.Date(2030, 1, 5, 23, 59, 30, 0, loc))
+	if !got.Equal(time.Date(2030, 1, 5, 0, 0, 0, 0, loc)) {
+		t.Errorf("expected midnight of the same day, got %s", got)
+	}
+}
+
+// newTestGuestMail returns the job on in-memory models, with a room to book and reminders 3 days ahead
+func newTestGuestMail(t *testing.T) (*GuestMail, int) {
+	t.Helper()
+	models := data.NewMemory()
+	room, err := models.Rooms.Create(context.Background(), data.Room{Name: "Generals Quarters"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	discard := log.New(io.Discard, "", 0)
+	queue := NewMailQueue(models, &recordingSender{files: make(map[string]string)}, discard, discard)
+	return NewGuestMail(models, queue, emails.Config{PropertyName: "Bread and Breakfast"}, 3, discard, discard), room
+}
+
+// book adds a reservation of the guest name for the nights from start to end; it is created now
+func book(t *testing.T, g *GuestMail, room int, name string, start, end time.Time) {
+	t.Helper()
+	_, err := g.Models.Reservations.Create(context.Background(), data.Reservation{FirstName: name, LastName: "Smith",
+		Email: name + "@example.com", StartDate: start, EndDate: end, RoomID: room})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queued lists the mail in the outbox as template and recipient
+func queued(t *testing.T, g *GuestMail) []string {
+	t.Helper()
+	messages, err := g.Models.Outbox.GetRecent(context.Background(), "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, msg := range messages {
+		got = append(got, msg.Template+" "+msg.To)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestGuestMail_OncePerReservation(t *testing.T) {
+	g, room := newTestGuestMail(t)
+
+	// the job runs a month from now, long after all of them booked
+	today := startOfDay(time.Now()).AddDate(0, 0, 30)
+	book(t, g, room, "ann", today, today.AddDate(0, 0, 2))                     // arrives today
+	book(t, g, room, "bob", today.AddDate(0, 0, 3), today.AddDate(0, 0, 5))    // last day of the window
+	book(t, g, room, "cleo", today.AddDate(0, 0, 4), today.AddDate(0, 0, 6))   // after the window
+	book(t, g, room, "dan", today.AddDate(0, 0, -1), today)                    // checks out today
+	book(t, g, room, "eve", today.AddDate(0, 0, -8), today.AddDate(0, 0, -6))  // last day of the window
+	book(t, g, room, "finn", today.AddDate(0, 0, -9), today.AddDate(0, 0, -7)) // left a week ago
+
+	g.runOn(today)
+	g.runOn(today)
+	want := []string{
+		"reminder ann@example.com",
+		"reminder bob@example.com",
+		"thankyou dan@example.com",
+		"thankyou eve@example.com",
+	}
+	if got := queued(t, g); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// the next day cleo is due, the others still are in their windows but already have their mail
+	g.runOn(today.AddDate(0, 0, 1))
+	want = append(want, "reminder cleo@example.com")
+	sort.Strings(want)
+	if got := queued(t, g); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestGuestMail_BookedLate(t *testing.T) {
+	g, room := newTestGuestMail(t)
+
+	// booked two days before arriving, the confirmation is recent enough
+	today := startOfDay(time.Now())
+	book(t, g, room, "ann", today.AddDate(0, 0, 2), today.AddDate(0, 0, 4))
+	book(t, g, room, "bob", today.AddDate(0, 0, 4), today.AddDate(0, 0, 6))
+
+	// bob booked four days ahead, more than the 3 of the reminder
+	want := []string{"reminder bob@example.com"}
+	for i := 0; i <= 2; i++ {
+		g.runOn(today.AddDate(0, 0, i))
+	}
+	if got := queued(t, g); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
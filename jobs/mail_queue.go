@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// retry schedule of an outbox message, see backoff; after mailMaxAttempts it becomes a dead letter
+const (
+	mailMaxAttempts = 8
+	mailBaseBackoff = time.Minute
+	mailMaxBackoff  = time.Hour
+)
+
+// mailBatchSize is how many due messages one run sends
+const mailBatchSize = 20
+
+// MailSender sends one message; *mailer.Mail is the real one
+type MailSender interface {
+	Send(msg mailer.Message) error
+}
+
+// MailQueue sends mail through the outbox: messages are stored with the change they belong to
+// and sent afterwards by a worker, so a slow or broken mail server never holds up a request
+type MailQueue struct {
+	Models   data.Models
+	Sender   MailSender
+	ErrorLog *log.Logger
+	InfoLog  *log.Logger
+
+	// one run at a time, so a message is never sent twice by the scheduler and Flush at once
+	mu sync.Mutex
+}
+
+func NewMailQueue(models data.Models, sender MailSender, errorLog, infoLog *log.Logger) *MailQueue {
+	return &MailQueue{
+		Models:   models,
+		Sender:   sender,
+		ErrorLog: errorLog,
+		InfoLog:  infoLog,
+	}
+}
+
+// EnqueueTx stores msg and its attachments in the outbox as part of tx;
+// call Flush after tx commits to send it straight away
+func (q *MailQueue) EnqueueTx(ctx context.Context, tx *data.Tx, msg mailer.Message, attachments ...data.Attachment) error {
+	out, err := outboxMessage(msg, attachments)
+	if err != nil {
+		return err
+	}
+	_, err = q.Models.Outbox.InsertTx(ctx, tx, out)
+	return err
+}
+
+// Enqueue stores msg and its attachments in the outbox and starts sending it in the background
+func (q *MailQueue) Enqueue(ctx context.Context, msg mailer.Message, attachments ...data.Attachment) error {
+	out, err := outboxMessage(msg, attachments)
+	if err != nil {
+		return err
+	}
+	_, err = q.Models.Outbox.Insert(ctx, out)
+	if err != nil {
+		return err
+	}
+	q.Flush()
+	return nil
+}
+
+// Flush starts sending the due messages in the background
+func (q *MailQueue) Flush() {
+	go q.SendDue()
+}
+
+// SendDue sends the messages whose next attempt is due; the scheduler runs it every minute
+func (q *MailQueue) SendDue() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ctx := context.Background()
+	messages, err := q.Models.Outbox.GetDue(ctx, mailBatchSize)
+	if err != nil {
+		q.ErrorLog.Println("error getting due mail:", err)
+		return
+	}
+
+	for _, out := range messages {
+		attempts := out.Attempts + 1
+		err := q.send(out)
+		if err == nil {
+			err = q.Models.Outbox.MarkSent(ctx, out.ID, attempts)
+			if err != nil {
+				q.ErrorLog.Println("error marking mail sent:", err)
+			}
+			continue
+		}
+
+		var next time.Time
+		if attempts < mailMaxAttempts {
+			next = time.Now().Add(backoff(attempts, mailBaseBackoff, mailMaxBackoff))
+		} else {
+			q.ErrorLog.Printf("giving up on mail %d to %s: %s", out.ID, out.To, err)
+		}
+		err = q.Models.Outbox.MarkAttemptFailed(ctx, out.ID, attempts, err.Error(), next)
+		if err != nil {
+			q.ErrorLog.Println("error marking mail failed:", err)
+		}
+	}
+}
+
+func (q *MailQueue) send(out data.OutboxMessage) error {
+	msg, err := mailerMessage(out)
+	if err != nil {
+		return err
+	}
+
+	// the mailer attaches files from disk
+	if len(out.Attachments) > 0 {
+		dir, err := os.MkdirTemp("", "mail-outbox-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		for _, a := range out.Attachments {
+			path := filepath.Join(dir, filepath.Base(a.Name))
+			err := os.WriteFile(path, a.Content, 0600)
+			if err != nil {
+				return err
+			}
+			msg.Attachments = append(msg.Attachments, path)
+		}
+	}
+
+	return q.Sender.Send(msg)
+}
+
+// outboxMessage turns a message into an outbox row; Data is stored as json.
+// Attachments are given by content, the file paths of msg are not kept
+func outboxMessage(msg mailer.Message, attachments []data.Attachment) (data.OutboxMessage, error) {
+	b, err := json.Marshal(msg.Data)
+	if err != nil {
+		return data.OutboxMessage{}, err
+	}
+	return data.OutboxMessage{
+		To:          msg.To,
+		From:        msg.From,
+		FromName:    msg.FromName,
+		Subject:     msg.Subject,
+		Template:    msg.Template,
+		Data:        string(b),
+		Attachments: attachments,
+	}, nil
+}
+
+// mailerMessage turns an outbox row back into a message. Data comes back as a map,
+// which the mail templates read the same way as the struct it was made from
+func mailerMessage(out data.OutboxMessage) (mailer.Message, error) {
+	var d map[string]interface{}
+	err := json.Unmarshal([]byte(out.Data), &d)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	return mailer.Message{
+		From:     out.From,
+		FromName: out.FromName,
+		To:       out.To,
+		Subject:  out.Subject,
+		Template: out.Template,
+		Data:     d,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"bytes"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func TestOutboxMessage_RoundTrip(t *testing.T) {
+	var content struct {
+		Name string
+		Body string
+	}
+	content.Name = "John Smith"
+	content.Body = "See you soon"
+
+	msg := mailer.Message{
+		From:     "breadandbreakfast@booking.com",
+		To:       "john@example.com",
+		Subject:  "Reservation Confirmation",
+		Template: "mail",
+		Data:     content,
+	}
+
+	out, err := outboxMessage(msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Data != `{"Name":"John Smith","Body":"See you soon"}` {
+		t.Errorf("unexpected data %s", out.Data)
+	}
+
+	back, err := mailerMessage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.To != msg.To || back.From != msg.From || back.Subject != msg.Subject || back.Template != msg.Template {
+		t.Errorf("headers changed: %+v", back)
+	}
+
+	// templates written against the struct still work with the map that comes back
+	tmpl := template.Must(template.New("body").Parse("{{.Name}}: {{.Body}}"))
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, back.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "John Smith: See you soon" {
+		t.Errorf("unexpected render %q", buf.String())
+	}
+}
+
+// recordingSender keeps the messages it is given, with the content of their attachments
+type recordingSender struct {
+	sent  []mailer.Message
+	files map[string]string
+}
+
+func (s *recordingSender) Send(msg mailer.Message) error {
+	s.sent = append(s.sent, msg)
+	for _, path := range msg.Attachments {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s.files[filepath.Base(path)] = string(b)
+	}
+	return nil
+}
+
+func TestMailQueue_SendAttachments(t *testing.T) {
+	msg := mailer.Message{To: "john@example.com", Subject: "Your reservation", Template: "confirmation"}
+	out, err := outboxMessage(msg, []data.Attachment{{Name: "reservation.ics", Content: []byte("BEGIN:VCALENDAR")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &recordingSender{files: make(map[string]string)}
+	q := &MailQueue{Sender: sender}
+	err = q.send(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sender.sent) != 1 || len(sender.sent[0].Attachments) != 1 {
+		t.Fatalf("expected one message with one attachment, got %+v", sender.sent)
+	}
+	if sender.files["reservation.ics"] != "BEGIN:VCALENDAR" {
+		t.Errorf("unexpected attachments %v", sender.files)
+	}
+	// the files only exist while the message is sent
+	if _, err := os.Stat(sender.sent[0].Attachments[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the attachment to be removed after sending, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// headers sent with every delivery
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// retry schedule of a delivery: the wait doubles after every failed attempt, starting at
+// webhookBaseBackoff and capped at webhookMaxBackoff, until webhookMaxAttempts is reached
+const (
+	webhookMaxAttempts = 12
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+// ErrNoWebhooks is returned by a nil *Webhooks, which the app uses on databases without the webhook tables
+var ErrNoWebhooks = errors.New("jobs: webhooks need postgres")
+
+// webhookBatchSize is how many due deliveries one run sends
+const webhookBatchSize = 50
+
+// WebhookEvent is the json body of every delivery
+type WebhookEvent struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// RestrictionPayload is the data of restriction events
+type RestrictionPayload struct {
+	ID            int    `json:"id"`
+	Type          string `json:"type"`
+	RoomID        int    `json:"room_id"`
+	ReservationID int    `json:"reservation_id,omitempty"`
+	StartDate     string `json:"start_date"`
+	EndDate       string `json:"end_date"`
+}
+
+func NewRestrictionPayload(rest data.Restriction) RestrictionPayload {
+	return RestrictionPayload{
+		ID:            rest.ID,
+		Type:          rest.Type,
+		RoomID:        rest.RoomID,
+		ReservationID: rest.ReservationID,
+		StartDate:     rest.StartDate.Format("2006-01-02"),
+		EndDate:       rest.EndDate.Format("2006-01-02"),
+	}
+}
+
+// Webhooks queues events for the webhooks subscribed to them and delivers them with retries.
+// Every delivery is kept in the delivery log
+type Webhooks struct {
+	Models   data.Models
+	Client   *http.Client
+	ErrorLog *log.Logger
+	InfoLog  *log.Logger
+
+	// one run at a time, so a delivery is never sent twice by the scheduler and Publish at once
+	mu sync.Mutex
+}
+
+func NewWebhooks(models data.Models, errorLog, infoLog *log.Logger) *Webhooks {
+	return &Webhooks{
+		Models:   models,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		ErrorLog: errorLog,
+		InfoLog:  infoLog,
+	}
+}
+
+// Publish queues event for every webhook subscribed to it and starts sending in the background.
+// It never fails the caller; problems are logged. A nil *Webhooks publishes nothing
+func (wh *Webhooks) Publish(ctx context.Context, event string, payload interface{}) {
+	if wh == nil {
+		return
+	}
+
+	hooks, err := wh.Models.Webhooks.GetForEvent(ctx, event)
+	if err != nil {
+		wh.ErrorLog.Println("error getting webhooks for", event+":", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(WebhookEvent{Event: event, CreatedAt: time.Now().UTC(), Data: payload})
+	if err != nil {
+		wh.ErrorLog.Println("error encoding webhook payload:", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		_, err = wh.Models.Deliveries.Insert(ctx, data.WebhookDelivery{
+			WebhookID: hook.ID,
+			Event:     event,
+			Payload:   string(body),
+		})
+		if err != nil {
+			wh.ErrorLog.Printf("error queueing %s for webhook %d: %s", event, hook.ID, err)
+		}
+	}
+
+	go wh.DeliverDue()
+}
+
+// Replay queues a copy of a delivery to be sent again, the original stays in the log as it was
+func (wh *Webhooks) Replay(ctx context.Context, deliveryID int) (int, error) {
+	if wh == nil {
+		return 0, ErrNoWebhooks
+	}
+
+	delivery, err := wh.Models.Deliveries.GetByID(ctx, deliveryID)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := wh.Models.Deliveries.Insert(ctx, data.WebhookDelivery{
+		WebhookID: delivery.WebhookID,
+		Event:     delivery.Event,
+		Payload:   delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	go wh.DeliverDue()
+	return newID, nil
+}
+
+// DeliverDue sends the pending deliveries whose next attempt is due; the scheduler runs it every minute
+func (wh *Webhooks) DeliverDue() {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	ctx := context.Background()
+	deliveries, err := wh.Models.Deliveries.GetDue(ctx, webhookBatchSize)
+	if err != nil {
+		wh.ErrorLog.Println("error getting due webhook deliveries:", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		attempts := delivery.Attempts + 1
+		code, err := wh.send(delivery)
+		if err == nil {
+			err = wh.Models.Deliveries.MarkDelivered(ctx, delivery.ID, attempts, code)
+			if err != nil {
+				wh.ErrorLog.Println("error marking webhook delivery delivered:", err)
+			}
+			continue
+		}
+
+		var next time.Time
+		if attempts < webhookMaxAttempts {
+			next = time.Now().Add(backoff(attempts, webhookBaseBackoff, webhookMaxBackoff))
+		} else {
+			wh.ErrorLog.Printf("giving up on webhook delivery %d to %s: %s", delivery.ID, delivery.Webhook.URL, err)
+		}
+		err = wh.Models.Deliveries.MarkAttemptFailed(ctx, delivery.ID, attempts, code, err.Error(), next)
+		if err != nil {
+			wh.ErrorLog.Println("error marking webhook delivery failed:", err)
+		}
+	}
+}
+
+// send posts a delivery and returns the response status; anything but a 2xx is an error
+func (wh *Webhooks) send(delivery data.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "booking-webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(delivery.Webhook.Secret, timestamp, body))
+
+	resp, err := wh.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// read a little of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the signature header of a delivery: "t=<unix time>,v1=<hex hmac>".
+// The hmac is HMAC-SHA256 keyed with the webhook secret over "<unix time>.<body>"; receivers
+// recompute it and reject old timestamps so a captured delivery cannot be replayed against them
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
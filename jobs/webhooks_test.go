@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"reservation.created"}`)
+
+	sig := SignWebhook("whsec_test", 1700000000, body)
+	if !strings.HasPrefix(sig, "t=1700000000,v1=") || len(sig) != len("t=1700000000,v1=")+64 {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+	if sig != SignWebhook("whsec_test", 1700000000, body) {
+		t.Error("signature is not stable")
+	}
+	if sig == SignWebhook("whsec_other", 1700000000, body) {
+		t.Error("signature does not depend on the secret")
+	}
+	if sig == SignWebhook("whsec_test", 1700000001, body) {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts, webhookBaseBackoff, webhookMaxBackoff); got != tt.want {
+			t.Errorf("after %d attempts: expected %s, got %s", tt.attempts, tt.want, got)
+		}
+	}
+}
+
+func TestWebhooks_Send(t *testing.T) {
+	var gotSignature, gotEvent, gotDelivery, gotBody string
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		gotSignature = r.Header.Get(WebhookSignatureHeader)
+		gotEvent = r.Header.Get(WebhookEventHeader)
+		gotDelivery = r.Header.Get(WebhookDeliveryHeader)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	wh := &Webhooks{Client: srv.Client()}
+	delivery := data.WebhookDelivery{
+		ID:      42,
+		Event:   data.EventReservationCreated,
+		Payload: `{"event":"reservation.created","data":{"code":"ABCDE23456"}}`,
+		Webhook: data.Webhook{URL: srv.URL, Secret: "whsec_test"},
+	}
+
+	code, err := wh.send(delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if gotBody != delivery.Payload || gotEvent != delivery.Event || gotDelivery != "42" {
+		t.Errorf("unexpected request: body %q, event %q, delivery %q", gotBody, gotEvent, gotDelivery)
+	}
+
+	// the receiver can check the signature with the timestamp it was sent
+	ts := strings.TrimPrefix(strings.SplitN(gotSignature, ",", 2)[0], "t=")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		t.Fatalf("bad timestamp in %q", gotSignature)
+	}
+	if gotSignature != SignWebhook("whsec_test", unix, []byte(gotBody)) {
+		t.Errorf("signature %q does not match the body", gotSignature)
+	}
+
+	status = http.StatusInternalServerError
+	code, err = wh.send(delivery)
+	if err == nil || code != http.StatusInternalServerError {
+		t.Errorf("expected an error with 500, got %d %v", code, err)
+	}
+}
+
+func TestWebhooks_PublishNil(t *testing.T) {
+	// handlers and jobs publish without checking whether webhooks are configured
+	var wh *Webhooks
+	wh.Publish(context.Background(), data.EventReservationCreated, nil)
+
+	if _, err := wh.Replay(context.Background(), 1); !errors.Is(err, ErrNoWebhooks) {
+		t.Errorf("expected ErrNoWebhooks, got %v", err)
+	}
+}
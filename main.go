@@ -1,6 +1,12 @@
 package main
 
+import "os"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(newApplication().migrateCommand(os.Args[2:]))
+	}
+
 	j := run()
 	j.Jazz.ListenAndServe()
 
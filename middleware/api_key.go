@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type contextKey string
+
+const apiKeyContextKey = contextKey("apiKey")
+
+// lastUsedResolution limits how often last_used_at is written for a busy key
+const lastUsedResolution = time.Minute
+
+// APIKeyFromContext returns the api key that authenticated the request, if any
+func APIKeyFromContext(ctx context.Context) (data.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(data.APIKey)
+	return key, ok
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[7:])
+}
+
+// apiKeyError writes an error in the same envelope the json api uses
+func (m *Middleware) apiKeyError(w http.ResponseWriter, status int, code, message string) {
+	var payload struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	payload.Error.Code = code
+	payload.Error.Message = message
+
+	var headers http.Header
+	if status == http.StatusUnauthorized {
+		headers = http.Header{"WWW-Authenticate": {`Bearer realm="api"`}}
+	}
+	err := m.WriteJSON(w, status, payload, headers)
+	if err != nil {
+		m.ErrorLog.Println("error writing json:", err)
+	}
+}
+
+// APIKey authenticates the request with a Bearer api key that was granted scope.
+// The key is stored in the request context, see APIKeyFromContext.
+//
+// requests without a valid key get 401, keys without the scope get 403
+func (m *Middleware) APIKey(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				m.apiKeyError(w, http.StatusUnauthorized, "unauthorized", "An api key is required")
+				return
+			}
+
+			key, err := m.Models.APIKeys.Authenticate(r.Context(), token)
+			if errors.Is(err, data.ErrInvalidAPIKey) {
+				m.apiKeyError(w, http.StatusUnauthorized, "unauthorized", "Invalid or revoked api key")
+				return
+			}
+			if err != nil {
+				m.ErrorLog.Println("error authenticating api key:", err)
+				m.apiKeyError(w, http.StatusInternalServerError, "server_error", "Could not check the api key")
+				return
+			}
+
+			if !key.HasScope(scope) {
+				m.apiKeyError(w, http.StatusForbidden, "forbidden", "This api key is not allowed to "+scope)
+				return
+			}
+
+			if !key.LastUsedAt.Valid || time.Since(key.LastUsedAt.Time) > lastUsedResolution {
+				err = m.Models.APIKeys.TouchLastUsed(r.Context(), key.ID)
+				if err != nil {
+					m.ErrorLog.Println("error updating api key last use:", err)
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+			ctx = data.WithActor(ctx, data.Actor{Type: data.ActorUser, ID: key.UserID})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/ahmedkhaeld/booking/data"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"net/http"
+)
+
+// Actor tells the models who makes the request and its id, for the audit log: the staff user who is logged in,
+// or else a guest. Requests with an api key are made by the user of the key, see APIKey
+func (m *Middleware) Actor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := data.Actor{Type: data.ActorGuest}
+		if id := m.Session.GetInt(r.Context(), "userID"); id > 0 {
+			actor = data.Actor{Type: data.ActorUser, ID: id}
+		}
+
+		ctx := data.WithActor(r.Context(), actor)
+		ctx = data.WithRequestID(ctx, chimw.GetReqID(r.Context()))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import "net/http"
+
+// Auth lets only logged-in staff through; everyone else is sent to the login page
+func (m *Middleware) Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Session.Exists(r.Context(), "userID") {
+			m.Session.Put(r.Context(), "error", "Log in first!")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -7,5 +7,6 @@ import (
 
 type Middleware struct {
 	*jazz.Jazz
-	Models data.Models
+	Models      data.Models
+	RateLimiter *RateLimiter
 }
@@ -0,0 +1,268 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// route groups that get their own rate limit
+const (
+	RateLimitSearch  = "search"
+	RateLimitBooking = "booking"
+)
+
+// RateLimit is a token bucket: it refills at Rate tokens per second and holds at most Burst tokens
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseRateLimit reads a limit written as "<requests>/<unit>", e.g. "30/m".
+// The unit is s, m or h; the bucket holds the full number of requests
+func ParseRateLimit(s string) (RateLimit, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("rate limit %q must look like 30/m", s)
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q must start with a positive number", s)
+	}
+
+	var period time.Duration
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return RateLimit{}, fmt.Errorf("rate limit %q must end in /s, /m or /h", s)
+	}
+
+	return RateLimit{Rate: float64(n) / period.Seconds(), Burst: n}, nil
+}
+
+// RateLimitStore holds the token buckets
+type RateLimitStore interface {
+	// Take removes a token from the bucket named key. When the bucket is empty it returns false
+	// and how long the client has to wait for the next token
+	Take(key string, limit RateLimit) (bool, time.Duration, error)
+}
+
+// RateLimiter applies a limit per route group, with one bucket per client in each group
+type RateLimiter struct {
+	Store  RateLimitStore
+	Limits map[string]RateLimit
+	// TrustedProxies are the reverse proxies whose X-Real-IP and X-Forwarded-For headers name the client.
+	// Anyone else could change those headers on every request, so their own address is used instead
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxies reads a comma separated list of ip addresses and networks, e.g. "127.0.0.1, 10.0.0.0/8"
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %q is not an ip address or a network", item)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			item = fmt.Sprintf("%s/%d", item, bits)
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an ip address or a network", item)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// NewRateLimiter returns a limiter backed by backend: "memory" (the default) or "redis".
+// redisHost, redisPassword and redisPrefix are only used by the redis backend
+func NewRateLimiter(backend string, limits map[string]RateLimit, redisHost, redisPassword, redisPrefix string) (*RateLimiter, error) {
+	var store RateLimitStore
+	switch backend {
+	case "", "memory":
+		store = NewMemoryRateLimitStore()
+	case "redis":
+		if redisHost == "" {
+			return nil, fmt.Errorf("the redis rate limit backend needs REDIS_HOST")
+		}
+		store = NewRedisRateLimitStore(redisHost, redisPassword, redisPrefix)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q; use memory or redis", backend)
+	}
+	return &RateLimiter{Store: store, Limits: limits}, nil
+}
+
+const peerAddrContextKey = contextKey("peerAddr")
+
+// PeerAddr keeps the address the connection came from for the rate limits. It has to come before the RealIP
+// middleware of the router, which replaces RemoteAddr with the address in the request headers
+func PeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), peerAddrContextKey, r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// hostOf is the ip address of addr, which may have a port
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// client identifies who is calling: the api key when there is one, otherwise the ip address the connection
+// came from. Only a trusted proxy may name another client in its headers, which RealIP put in RemoteAddr
+func (l *RateLimiter) client(r *http.Request) string {
+	if key, ok := APIKeyFromContext(r.Context()); ok {
+		return "key:" + strconv.Itoa(key.ID)
+	}
+	peer, ok := r.Context().Value(peerAddrContextKey).(string)
+	if !ok {
+		peer = r.RemoteAddr
+	}
+	ip := hostOf(peer)
+	if l.trusts(ip) {
+		ip = hostOf(r.RemoteAddr)
+	}
+	return "ip:" + ip
+}
+
+// trusts reports whether ip is one of the trusted proxies
+func (l *RateLimiter) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range l.TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimit throttles the routes of a group. Clients over the limit get 429 with a Retry-After header.
+//
+// on api routes it must come after APIKey so partners are limited by key rather than by ip
+func (m *Middleware) RateLimit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m.RateLimiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limit, ok := m.RateLimiter.Limits[group]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, wait, err := m.RateLimiter.Store.Take(group+":"+m.RateLimiter.client(r), limit)
+			if err != nil {
+				// a broken limiter backend should not take the site down with it
+				m.ErrorLog.Println("error checking rate limit:", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+			// browsers get a plain error page, scripts and api clients get json
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				m.ErrorStatus(w, http.StatusTooManyRequests)
+				return
+			}
+			m.apiKeyError(w, http.StatusTooManyRequests, "rate_limited",
+				fmt.Sprintf("Too many requests, retry in %d seconds", retryAfter))
+		})
+	}
+}
+
+// MemoryRateLimitStore keeps buckets in process memory; limits are per instance of the app
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// sweepInterval is how often full buckets are dropped from memory
+const sweepInterval = time.Minute
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep forgets buckets that have refilled completely, they are the same as a new bucket
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"time"
+)
+
+// takeScript refills and takes from a bucket atomically, so every app instance shares the same limit.
+// The bucket is a hash of tokens (t) and last refill in milliseconds (ts) that expires once it would be full again
+var takeScript = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, wait}
+`)
+
+// RedisRateLimitStore keeps buckets in redis, so limits hold across several instances of the app
+type RedisRateLimitStore struct {
+	Pool   *redis.Pool
+	Prefix string
+}
+
+func NewRedisRateLimitStore(host, password, prefix string) *RedisRateLimitStore {
+	return &RedisRateLimitStore{
+		Pool: &redis.Pool{
+			MaxIdle:     10,
+			MaxActive:   50,
+			IdleTimeout: 240 * time.Second,
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", host, redis.DialPassword(password))
+			},
+			TestOnBorrow: func(conn redis.Conn, t time.Time) error {
+				_, err := conn.Do("PING")
+				return err
+			},
+		},
+		Prefix: prefix,
+	}
+}
+
+func (s *RedisRateLimitStore) Take(key string, limit RateLimit) (bool, time.Duration, error) {
+	conn := s.Pool.Get()
+	defer conn.Close()
+
+	res, err := redis.Int64s(takeScript.Do(conn,
+		s.Prefix+"ratelimit:"+key,
+		limit.Rate,
+		limit.Burst,
+		time.Now().UnixMilli(),
+	))
+	if err != nil {
+		return false, 0, err
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"github.com/ahmedkhaeld/jazz"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in    string
+		rate  float64
+		burst int
+		ok    bool
+	}{
+		{"10/s", 10, 10, true},
+		{"60/m", 1, 60, true},
+		{"3600/h", 1, 3600, true},
+		{"10", 0, 0, false},
+		{"0/m", 0, 0, false},
+		{"10/d", 0, 0, false},
+		{"x/m", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		limit, err := ParseRateLimit(tt.in)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %s", tt.in, err)
+			continue
+		}
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.in)
+			}
+			continue
+		}
+		if limit.Rate != tt.rate || limit.Burst != tt.burst {
+			t.Errorf("%s: expected %v/%d, got %v/%d", tt.in, tt.rate, tt.burst, limit.Rate, limit.Burst)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore_Take(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	limit := RateLimit{Rate: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := s.Take("a", limit); !ok {
+			t.Fatalf("request %d should be allowed within the burst", i+1)
+		}
+	}
+	ok, wait, _ := s.Take("a", limit)
+	if ok {
+		t.Fatal("third request should be limited")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("expected a wait of at most a second, got %s", wait)
+	}
+
+	if ok, _, _ := s.Take("b", limit); !ok {
+		t.Error("another client should have its own bucket")
+	}
+}
+
+func TestMiddleware_RateLimit(t *testing.T) {
+	m := &Middleware{
+		Jazz: &jazz.Jazz{ErrorLog: log.New(io.Discard, "", 0)},
+		RateLimiter: &RateLimiter{
+			Store:  NewMemoryRateLimitStore(),
+			Limits: map[string]RateLimit{RateLimitBooking: {Rate: 0.1, Burst: 1}},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := m.RateLimit(RateLimitBooking)(next)
+
+	req := httptest.NewRequest("POST", "/bookings/reservation", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "10" {
+		t.Errorf("expected Retry-After 10, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	// a different ip is not affected
+	req.RemoteAddr = "10.0.0.2:5555"
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("other client: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestMiddleware_RateLimitForwardedFor(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.1, 192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Middleware{
+		Jazz: &jazz.Jazz{ErrorLog: log.New(io.Discard, "", 0)},
+		RateLimiter: &RateLimiter{
+			Store:          NewMemoryRateLimitStore(),
+			Limits:         map[string]RateLimit{RateLimitBooking: {Rate: 0.1, Burst: 1}},
+			TrustedProxies: proxies,
+		},
+	}
+
+	// put together like routes.go: the peer address is kept before the router's RealIP replaces it
+	router := chi.NewRouter()
+	router.Use(chimw.RealIP)
+	router.With(m.RateLimit(RateLimitBooking)).Post("/bookings/reservation", func(http.ResponseWriter, *http.Request) {})
+	root := chi.NewRouter()
+	root.Use(PeerAddr)
+	root.Mount("/", router)
+
+	post := func(peer, forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/bookings/reservation", nil)
+		req.RemoteAddr = peer
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rr := httptest.NewRecorder()
+		root.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// a client that makes up the header every time is still one client
+	if code := post("203.0.113.7:5555", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", code)
+	}
+	if code := post("203.0.113.7:5555", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("spoofed header: expected 429, got %d", code)
+	}
+
+	// behind a trusted proxy every client has its own bucket
+	if code := post("10.0.0.1:5555", "198.51.100.1"); code != http.StatusOK {
+		t.Errorf("first client of the proxy: expected 200, got %d", code)
+	}
+	if code := post("192.168.1.20:5555", "198.51.100.2"); code != http.StatusOK {
+		t.Errorf("second client of the proxy: expected 200, got %d", code)
+	}
+	if code := post("10.0.0.1:5555", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("first client again: expected 429, got %d", code)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 127.0.0.1 , ::1, 10.0.0.0/8,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxies) != 3 || proxies[0].String() != "127.0.0.1/32" || proxies[1].String() != "::1/128" {
+		t.Errorf("unexpected proxies %v", proxies)
+	}
+	if _, err := ParseTrustedProxies("localhost"); err == nil {
+		t.Error("expected an error for a host name")
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Unsupported answers every request with 501, for a feature whose tables the database of DATABASE_TYPE does not
+// have. The json api gets the message in its error envelope, the pages as text
+func (m *Middleware) Unsupported(feature string) func(http.Handler) http.Handler {
+	message := feature + " need postgres, the " + os.Getenv("DATABASE_TYPE") + " schema has no tables for them"
+	return func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				m.apiKeyError(w, http.StatusNotImplemented, "not_implemented", message)
+				return
+			}
+			http.Error(w, message, http.StatusNotImplemented)
+		})
+	}
+}
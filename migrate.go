@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+)
+
+// the schema is embedded in the binary, see the migrations package. It is brought up to date when the app
+// starts, and the migrate command runs them by hand
+
+// migrator returns the migrations of the database of DATABASE_TYPE, on a pool of their own that Close closes
+func (a *application) migrator() (*migrations.Migrator, error) {
+	var db *sql.DB
+	var err error
+	switch data.DialectOf(os.Getenv("DATABASE_TYPE")) {
+	case data.MySQL:
+		cfg := mysqlConfig()
+		// a migration is a file of several statements
+		cfg.MultiStatements = true
+		db, err = sql.Open("mysql", cfg.FormatDSN())
+	case data.SQLite:
+		db, err = sql.Open("sqlite", data.SQLiteDSN(a.sqliteFile()))
+	default:
+		db, err = sql.Open("pgx", a.BuildDSN())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrations.New(db, os.Getenv("DATABASE_TYPE"))
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// migrateOnStart applies the migrations that are missing before the app uses the database, unless
+// AUTO_MIGRATE is false. There is nothing to migrate without a database or in memory
+func (a *application) migrateOnStart() {
+	if a.DB.SqlPool == nil {
+		return
+	}
+	value := os.Getenv("AUTO_MIGRATE")
+	if value != "" {
+		auto, err := strconv.ParseBool(value)
+		if err != nil {
+			a.ErrorLog.Fatal("AUTO_MIGRATE: expected true or false, got ", value)
+		}
+		if !auto {
+			return
+		}
+	}
+
+	m, err := a.migrator()
+	if err != nil {
+		a.ErrorLog.Fatal("error migrating the database: ", err)
+	}
+	defer m.Close()
+
+	err = m.Up()
+	if errors.Is(err, migrate.ErrNoChange) {
+		return
+	}
+	if err != nil {
+		a.ErrorLog.Fatal("error migrating the database: ", err)
+	}
+	version, _, _ := m.Version()
+	a.InfoLog.Println("migrated the database to version", version)
+}
+
+const migrateUsage = `usage: %s migrate <command>
+
+	up [n]         apply all migrations that have not been applied, or the next n
+	down [n]       undo the last migration, or the last n
+	status         list the migrations and whether they have been applied
+	force VERSION  record VERSION as applied and clean, after a failed migration was fixed by hand`
+
+// migrateCommand runs the migrate command of the binary with args and returns the exit code
+func (a *application) migrateCommand(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintf(os.Stderr, migrateUsage+"\n", filepath.Base(os.Args[0]))
+		return 2
+	}
+	if a.DB.SqlPool == nil {
+		fmt.Fprintln(os.Stderr, "migrate: DATABASE_TYPE has no database to migrate")
+		return 1
+	}
+
+	n := 0
+	if len(args) == 2 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || (n < 1 && args[0] != "force") {
+			fmt.Fprintf(os.Stderr, migrateUsage+"\n", filepath.Base(os.Args[0]))
+			return 2
+		}
+	}
+
+	m, err := a.migrator()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	defer m.Close()
+
+	switch {
+	case args[0] == "up" && n == 0:
+		err = m.Up()
+	case args[0] == "up":
+		err = m.Steps(n)
+	case args[0] == "down":
+		if n == 0 {
+			n = 1
+		}
+		err = m.Steps(-n)
+	case args[0] == "force" && len(args) == 2:
+		err = m.Force(n)
+	case args[0] == "status" && len(args) == 1:
+		// the list below is all there is to it
+	default:
+		fmt.Fprintf(os.Stderr, migrateUsage+"\n", filepath.Base(os.Args[0]))
+		return 2
+	}
+	if errors.Is(err, migrate.ErrNoChange) {
+		err = nil
+	}
+	if err == nil {
+		err = printStatus(m)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	return 0
+}
+
+// printStatus lists the migrations of m and whether each has been applied
+func printStatus(m *migrations.Migrator) error {
+	list, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, migration := range list {
+		status := "pending"
+		if migration.Dirty {
+			status = "dirty"
+		} else if migration.Applied {
+			status = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, status)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_reservation_code;
+
+ALTER TABLE reservations
+    DROP COLUMN IF EXISTS code;
+
+--pgcrypto is left installed, other databases on the server may use it
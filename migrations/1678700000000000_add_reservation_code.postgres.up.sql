@@ -0,0 +1,13 @@
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE reservations
+    ADD COLUMN code VARCHAR(20);
+
+UPDATE reservations SET code = UPPER(encode(gen_random_bytes(5), 'hex')) WHERE code IS NULL;
+
+ALTER TABLE reservations
+    ALTER COLUMN code SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_reservation_code ON reservations (code);
+
+--the codes of the existing reservations come from pgcrypto's secure random bytes, random() can be guessed
@@ -0,0 +1,22 @@
+CREATE TABLE api_keys (
+                          id SERIAL PRIMARY KEY,
+                          user_id INTEGER NOT NULL,
+                          name VARCHAR(100) NOT NULL,
+                          prefix VARCHAR(16) UNIQUE NOT NULL,
+                          key_hash VARCHAR(64) NOT NULL,
+                          scopes VARCHAR(255) NOT NULL DEFAULT '',
+                          last_used_at TIMESTAMP,
+                          revoked_at TIMESTAMP,
+                          created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                          updated_at TIMESTAMP
+);
+
+ALTER TABLE api_keys
+    ADD CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+            REFERENCES users (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+--scopes: comma separated list, e.g. availability:read,reservations:write
+--key_hash: sha256 of the full token; the token itself is never stored
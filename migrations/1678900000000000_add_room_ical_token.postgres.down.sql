@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_room_ical_token;
+
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS ical_token;
+
+--pgcrypto is left installed, other databases on the server may use it
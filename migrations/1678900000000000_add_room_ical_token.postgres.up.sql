@@ -0,0 +1,14 @@
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE rooms
+    ADD COLUMN ical_token VARCHAR(64);
+
+UPDATE rooms SET ical_token = encode(gen_random_bytes(32), 'hex') WHERE ical_token IS NULL;
+
+ALTER TABLE rooms
+    ALTER COLUMN ical_token SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_room_ical_token ON rooms (ical_token);
+
+--ical_token: secret part of the room's calendar feed url, regenerate it to revoke old subscriptions. The tokens of the
+--  existing rooms come from pgcrypto's secure random bytes
@@ -0,0 +1,12 @@
+--the old schema cannot hold restrictions without a reservation, so owner blocks and external bookings are dropped
+DELETE FROM restrictions WHERE reservation_id IS NULL;
+DROP INDEX IF EXISTS idx_restriction_external_uid;
+ALTER TABLE restrictions DROP CONSTRAINT IF EXISTS fk_ical_import_id;
+ALTER TABLE restrictions
+    DROP COLUMN IF EXISTS external_uid,
+    DROP COLUMN IF EXISTS ical_import_id,
+    DROP COLUMN IF EXISTS restriction_type,
+    ALTER COLUMN reservation_id SET DEFAULT 0,
+    ALTER COLUMN reservation_id SET NOT NULL;
+DROP TABLE IF EXISTS ical_sync_logs;
+DROP TABLE IF EXISTS ical_imports;
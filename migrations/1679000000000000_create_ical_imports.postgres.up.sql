@@ -0,0 +1,61 @@
+CREATE TABLE ical_imports (
+                              id SERIAL PRIMARY KEY,
+                              room_id INTEGER NOT NULL,
+                              name VARCHAR(100) NOT NULL,
+                              url VARCHAR(1024) NOT NULL,
+                              last_synced_at TIMESTAMP,
+                              last_status VARCHAR(20) NOT NULL DEFAULT '',
+                              created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                              updated_at TIMESTAMP
+);
+
+ALTER TABLE ical_imports
+    ADD CONSTRAINT fk_room_id
+        FOREIGN KEY (room_id)
+            REFERENCES rooms (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+CREATE TABLE ical_sync_logs (
+                                id SERIAL PRIMARY KEY,
+                                ical_import_id INTEGER NOT NULL,
+                                status VARCHAR(20) NOT NULL,
+                                created INTEGER NOT NULL DEFAULT 0,
+                                updated INTEGER NOT NULL DEFAULT 0,
+                                deleted INTEGER NOT NULL DEFAULT 0,
+                                message TEXT NOT NULL DEFAULT '',
+                                started_at TIMESTAMP NOT NULL,
+                                finished_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE ical_sync_logs
+    ADD CONSTRAINT fk_ical_import_id
+        FOREIGN KEY (ical_import_id)
+            REFERENCES ical_imports (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+CREATE INDEX idx_ical_sync_logs_started ON ical_sync_logs (started_at);
+
+ALTER TABLE restrictions
+    ADD COLUMN restriction_type VARCHAR(20) NOT NULL DEFAULT 'reservation',
+    ADD COLUMN ical_import_id INTEGER,
+    ADD COLUMN external_uid VARCHAR(255),
+    ALTER COLUMN reservation_id DROP NOT NULL,
+    ALTER COLUMN reservation_id DROP DEFAULT;
+
+UPDATE restrictions SET reservation_id = NULL WHERE reservation_id = 0;
+UPDATE restrictions SET restriction_type = 'owner' WHERE reservation_id IS NULL;
+
+ALTER TABLE restrictions
+    ADD CONSTRAINT fk_ical_import_id
+        FOREIGN KEY (ical_import_id)
+            REFERENCES ical_imports (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX idx_restriction_external_uid ON restrictions (ical_import_id, external_uid);
+
+--restriction_type: reservation (booked with us), owner (blocked by staff) or external (booked on another platform)
+--reservation_id: null unless restriction_type is reservation
+--external_uid: UID of the event in the imported feed, used to reconcile the feed on every sync
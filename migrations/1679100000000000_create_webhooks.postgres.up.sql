@@ -0,0 +1,36 @@
+CREATE TABLE webhooks (
+                          id SERIAL PRIMARY KEY,
+                          url VARCHAR(1024) NOT NULL,
+                          secret VARCHAR(100) NOT NULL,
+                          events VARCHAR(255) NOT NULL DEFAULT '',
+                          created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                          updated_at TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+                                    id SERIAL PRIMARY KEY,
+                                    webhook_id INTEGER NOT NULL,
+                                    event VARCHAR(50) NOT NULL,
+                                    payload TEXT NOT NULL,
+                                    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+                                    attempts INTEGER NOT NULL DEFAULT 0,
+                                    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                    response_code INTEGER NOT NULL DEFAULT 0,
+                                    last_error TEXT NOT NULL DEFAULT '',
+                                    delivered_at TIMESTAMP,
+                                    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                    updated_at TIMESTAMP
+);
+
+ALTER TABLE webhook_deliveries
+    ADD CONSTRAINT fk_webhook_id
+        FOREIGN KEY (webhook_id)
+            REFERENCES webhooks (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+
+--events: comma separated list of the events the endpoint wants, e.g. reservation.created,reservation.cancelled
+--secret: signs every delivery with HMAC-SHA256 so the receiver can check it came from us
+--status: pending (waiting for its next attempt), delivered, or failed (gave up after the last retry)
@@ -0,0 +1,21 @@
+CREATE TABLE mail_outbox (
+                             id SERIAL PRIMARY KEY,
+                             to_address VARCHAR(255) NOT NULL,
+                             from_address VARCHAR(255) NOT NULL DEFAULT '',
+                             from_name VARCHAR(255) NOT NULL DEFAULT '',
+                             subject VARCHAR(255) NOT NULL,
+                             template VARCHAR(100) NOT NULL,
+                             data TEXT NOT NULL DEFAULT '{}',
+                             status VARCHAR(20) NOT NULL DEFAULT 'pending',
+                             attempts INTEGER NOT NULL DEFAULT 0,
+                             next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                             last_error TEXT NOT NULL DEFAULT '',
+                             sent_at TIMESTAMP,
+                             created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                             updated_at TIMESTAMP
+);
+
+CREATE INDEX idx_mail_outbox_due ON mail_outbox (status, next_attempt_at);
+
+--data: json given to the mail template
+--status: pending (waiting to be sent or retried), sent, or dead (gave up after the last retry)
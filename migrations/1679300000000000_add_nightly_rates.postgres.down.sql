@@ -0,0 +1,2 @@
+ALTER TABLE reservations DROP COLUMN IF EXISTS nightly_rate;
+ALTER TABLE rooms DROP COLUMN IF EXISTS nightly_rate;
@@ -0,0 +1,7 @@
+ALTER TABLE rooms
+    ADD COLUMN nightly_rate INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE reservations
+    ADD COLUMN nightly_rate INTEGER NOT NULL DEFAULT 0;
+
+--nightly_rate: price of one night in cents; reservations keep the rate they were booked at
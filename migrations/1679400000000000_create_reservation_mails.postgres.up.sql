@@ -0,0 +1,10 @@
+CREATE TABLE reservation_mails (
+                                   id SERIAL PRIMARY KEY,
+                                   reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON DELETE CASCADE,
+                                   kind VARCHAR(50) NOT NULL,
+                                   created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_reservation_mails_kind ON reservation_mails (reservation_id, kind);
+
+--kind: the scheduled mail that was queued for the reservation, reminder or thankyou; each is sent at most once
@@ -0,0 +1,3 @@
+ALTER TABLE mail_outbox ADD COLUMN attachments TEXT NOT NULL DEFAULT '[]';
+
+--attachments: json list of the files sent with the message, with their content, since the mailer attaches files from disk
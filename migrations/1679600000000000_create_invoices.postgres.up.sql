@@ -0,0 +1,30 @@
+CREATE TABLE invoice_sequence (
+                                  id INTEGER PRIMARY KEY CHECK (id = 1),
+                                  last_number INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO invoice_sequence (id, last_number) VALUES (1, 0);
+
+CREATE TABLE invoices (
+                          id SERIAL PRIMARY KEY,
+                          number INTEGER NOT NULL UNIQUE,
+                          reservation_id INTEGER UNIQUE REFERENCES reservations (id) ON DELETE SET NULL,
+                          code VARCHAR(20) NOT NULL,
+                          guest_name VARCHAR(255) NOT NULL,
+                          email VARCHAR(255) NOT NULL,
+                          room_name VARCHAR(255) NOT NULL,
+                          start_date DATE NOT NULL,
+                          end_date DATE NOT NULL,
+                          nightly_rate INTEGER NOT NULL,
+                          subtotal INTEGER NOT NULL,
+                          tax_name VARCHAR(50) NOT NULL DEFAULT '',
+                          tax_rate INTEGER NOT NULL DEFAULT 0,
+                          tax INTEGER NOT NULL DEFAULT 0,
+                          total INTEGER NOT NULL,
+                          currency VARCHAR(3) NOT NULL,
+                          issued_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+--invoice_sequence: one row holding the last invoice number. It is taken in the same transaction as the invoice
+--  is inserted, so a failed insert gives the number back and the numbers have no gaps
+--invoices: never deleted, and a copy of what was billed so cancelling or changing the reservation leaves them as issued
+--amounts are in cents, tax_rate in hundredths of a percent
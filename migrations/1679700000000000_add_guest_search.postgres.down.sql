@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_reservation_phone_trgm;
+DROP INDEX IF EXISTS idx_reservation_code_trgm;
+DROP INDEX IF EXISTS idx_reservation_email_local_trgm;
+DROP INDEX IF EXISTS idx_reservation_email_trgm;
+DROP INDEX IF EXISTS idx_reservation_last_name_trgm;
+DROP INDEX IF EXISTS idx_reservation_first_name_trgm;
+DROP INDEX IF EXISTS idx_reservation_name_trgm;
+
+--pg_trgm is left installed, other databases on the server may use it
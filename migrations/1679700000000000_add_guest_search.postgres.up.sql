@@ -0,0 +1,14 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_reservation_name_trgm ON reservations USING gin (lower(first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX idx_reservation_first_name_trgm ON reservations USING gin (lower(first_name) gin_trgm_ops);
+CREATE INDEX idx_reservation_last_name_trgm ON reservations USING gin (lower(last_name) gin_trgm_ops);
+CREATE INDEX idx_reservation_email_trgm ON reservations USING gin (lower(email) gin_trgm_ops);
+CREATE INDEX idx_reservation_email_local_trgm ON reservations USING gin (split_part(lower(email), '@', 1) gin_trgm_ops);
+CREATE INDEX idx_reservation_code_trgm ON reservations USING gin (lower(code) gin_trgm_ops);
+CREATE INDEX idx_reservation_phone_trgm ON reservations USING gin (
+    (replace(replace(replace(replace(replace(replace(phone, ' ', ''), '-', ''), '(', ''), ')', ''), '.', ''), '+', ''))
+    gin_trgm_ops);
+
+--the trigram indexes serve the guest search: like patterns, prefixes included, and the % similarity operator.
+--the expressions must stay the same as in data/guest_search.go for the planner to use them
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_reservation_guest_id;
+
+ALTER TABLE reservations DROP COLUMN IF EXISTS guest_id;
+
+DROP TABLE IF EXISTS guests;
+
+-- fails while a guest has booked twice with the same email or phone
+ALTER TABLE reservations
+    ADD CONSTRAINT reservations_email_key UNIQUE (email),
+    ADD CONSTRAINT reservations_phone_key UNIQUE (phone);
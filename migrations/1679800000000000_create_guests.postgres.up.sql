@@ -0,0 +1,34 @@
+CREATE TABLE guests (
+                        id SERIAL PRIMARY KEY,
+                        first_name VARCHAR(50) NOT NULL,
+                        last_name VARCHAR(50) NOT NULL,
+                        email VARCHAR(100) NOT NULL,
+                        phone VARCHAR(60) NOT NULL DEFAULT '',
+                        created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                        updated_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_guest_email ON guests (email);
+
+-- a guest for every email booked so far, with the details of the latest booking
+INSERT INTO guests (first_name, last_name, email, phone, created_at, updated_at)
+SELECT DISTINCT ON (LOWER(email)) first_name, last_name, LOWER(email), phone, created_at, NOW()
+FROM reservations
+ORDER BY LOWER(email), id DESC;
+
+ALTER TABLE reservations
+    ADD COLUMN guest_id INTEGER REFERENCES guests (id) ON UPDATE CASCADE;
+
+UPDATE reservations r SET guest_id = g.id FROM guests g WHERE g.email = LOWER(r.email);
+
+ALTER TABLE reservations
+    ALTER COLUMN guest_id SET NOT NULL;
+
+ALTER TABLE reservations
+    DROP CONSTRAINT IF EXISTS reservations_email_key,
+    DROP CONSTRAINT IF EXISTS reservations_phone_key;
+
+CREATE INDEX idx_reservation_guest_id ON reservations (guest_id);
+
+--email: lower case, returning guests are matched by it
+--reservations keep the guest details they were booked with, the guest has the latest ones
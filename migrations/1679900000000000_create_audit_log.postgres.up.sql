@@ -0,0 +1,20 @@
+CREATE TABLE audit_log (
+                           id SERIAL PRIMARY KEY,
+                           actor_type VARCHAR(20) NOT NULL,
+                           actor_id INTEGER NOT NULL DEFAULT 0,
+                           action VARCHAR(20) NOT NULL,
+                           entity VARCHAR(50) NOT NULL,
+                           entity_id INTEGER NOT NULL,
+                           reservation_id INTEGER NOT NULL DEFAULT 0,
+                           changes TEXT NOT NULL DEFAULT '{}',
+                           request_id VARCHAR(255) NOT NULL DEFAULT '',
+                           created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_reservation_id ON audit_log (reservation_id);
+CREATE INDEX idx_audit_log_entity ON audit_log (entity, entity_id);
+
+--actor_type: user, guest or system; actor_id is the user or guest, 0 for the system
+--entity: the table of the row that changed
+--reservation_id: 0 when the change is not about a reservation. There are no foreign keys, the log outlives the rows
+--changes: json of the fields that changed, {"field": {"before": ..., "after": ...}}
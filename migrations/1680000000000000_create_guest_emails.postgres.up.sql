@@ -0,0 +1,9 @@
+CREATE TABLE guest_emails (
+                              email VARCHAR(100) PRIMARY KEY,
+                              guest_id INTEGER NOT NULL REFERENCES guests (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                              created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_guest_emails_guest_id ON guest_emails (guest_id);
+
+--email: lower case, the email of a guest merged into guest_id; new bookings with it go to guest_id
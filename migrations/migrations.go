@@ -0,0 +1,99 @@
+// Package migrations carries the database schema in the binary: the postgres migrations of this directory,
+// and those of MySQL and MariaDB in mysql/ and of SQLite in sqlite/, each run with golang-migrate
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"io/fs"
+)
+
+//go:embed *.sql mysql/*.sql sqlite/*.sql
+var files embed.FS
+
+// Migrator runs the migrations of one database
+type Migrator struct {
+	*migrate.Migrate
+	source source.Driver
+}
+
+// Migration is one migration of the database and whether it has been applied
+type Migration struct {
+	Version uint
+	Name    string
+	Applied bool
+	// Dirty is set on the migration that failed halfway. It has to be finished or undone by hand,
+	// and the version forced, before the migrations run again
+	Dirty bool
+}
+
+// New returns the Migrator of db, a database of databaseType. db is used by the Migrator alone:
+// MySQL needs a connection with multiStatements, and Close closes it
+func New(db *sql.DB, databaseType string) (*Migrator, error) {
+	dir := "."
+	var driver database.Driver
+	var err error
+	switch data.DialectOf(databaseType) {
+	case data.MySQL:
+		dir = "mysql"
+		driver, err = mysql.WithInstance(db, &mysql.Config{})
+	case data.SQLite:
+		dir = "sqlite"
+		driver, err = sqlite.WithInstance(db, &sqlite.Config{})
+	default:
+		driver, err = postgres.WithInstance(db, &postgres.Config{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := iofs.New(files, dir)
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", src, databaseType, driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{Migrate: m, source: src}, nil
+}
+
+// Status returns every migration, oldest first
+func (m *Migrator) Status() ([]Migration, error) {
+	current, dirty, err := m.Version()
+	applied := err == nil
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return nil, err
+	}
+
+	var migrations []Migration
+	version, err := m.source.First()
+	for err == nil {
+		up, name, readErr := m.source.ReadUp(version)
+		if readErr != nil {
+			return migrations, readErr
+		}
+		_ = up.Close()
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    name,
+			Applied: applied && version <= current,
+			Dirty:   dirty && version == current,
+		})
+		version, err = m.source.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return migrations, err
+	}
+	return migrations, nil
+}
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"database/sql"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	for _, dir := range []string{".", "mysql", "sqlite"} {
+		src, err := iofs.New(files, dir)
+		if err != nil {
+			t.Errorf("%s: %s", dir, err)
+			continue
+		}
+
+		version, err := src.First()
+		if err != nil {
+			t.Errorf("%s: no migrations: %s", dir, err)
+		}
+		for err == nil {
+			if _, _, err := src.ReadUp(version); err != nil {
+				t.Errorf("%s: %d has no up migration", dir, version)
+			}
+			if _, _, err := src.ReadDown(version); err != nil {
+				t.Errorf("%s: %d has no down migration", dir, version)
+			}
+			version, err = src.Next(version)
+		}
+	}
+
+	// the postgres migrations do not pick up those of the other databases
+	names, _ := fs.Glob(files, "*.sql")
+	for _, name := range names {
+		if !strings.Contains(name, ".postgres.") {
+			t.Errorf("%s is not a postgres migration", name)
+		}
+	}
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", data.SQLiteDSN(filepath.Join(t.TempDir(), "booking.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) < 2 || status[0].Applied {
+		t.Fatalf("expected pending migrations, got %+v", status)
+	}
+
+	err = m.Steps(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ = m.Status()
+	if !status[0].Applied || status[1].Applied || status[0].Name != "init_schema.sqlite" {
+		t.Errorf("expected only the first migration applied, got %+v", status)
+	}
+
+	err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables int
+	err = db.QueryRow("select count(*) from sqlite_master where type = 'table' and name in ('rooms', 'mail_outbox')").Scan(&tables)
+	if err != nil || tables != 2 {
+		t.Errorf("expected the tables to be created, got %d, %v", tables, err)
+	}
+
+	err = m.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ = m.Status()
+	for _, migration := range status {
+		if migration.Applied {
+			t.Errorf("expected %d to be undone", migration.Version)
+		}
+	}
+
+	// forcing records a version as applied and clean without running it
+	err = m.Force(int(status[0].Version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ = m.Status()
+	if !status[0].Applied || status[0].Dirty {
+		t.Errorf("expected the forced version to be applied and clean, got %+v", status[0])
+	}
+}
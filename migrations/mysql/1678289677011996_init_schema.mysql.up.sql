@@ -0,0 +1,85 @@
+CREATE TABLE users (
+                       id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+                       first_name VARCHAR(50) NOT NULL,
+                       last_name VARCHAR(50) NOT NULL,
+                       email VARCHAR(100) NOT NULL,
+                       password VARCHAR(100) NOT NULL,
+                       access_level INTEGER NOT NULL DEFAULT 1,
+                       created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                       updated_at DATETIME
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+
+CREATE TABLE rooms (
+                       id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+                       name VARCHAR(255) NOT NULL,
+                       nightly_rate INTEGER NOT NULL DEFAULT 0,
+                       ical_token VARCHAR(64) NOT NULL,
+                       created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at DATETIME
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+
+CREATE TABLE reservations (
+                              id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+                              code VARCHAR(20) NOT NULL,
+                              first_name VARCHAR(50) NOT NULL,
+                              last_name VARCHAR(50) NOT NULL,
+                              email VARCHAR(50) UNIQUE NOT NULL,
+                              phone VARCHAR(60) UNIQUE NOT NULL,
+                              start_date DATE NOT NULL,
+                              end_date DATE NOT NULL,
+                              processed INTEGER DEFAULT 0,
+                              room_id INT UNSIGNED NOT NULL,
+                              nightly_rate INTEGER NOT NULL DEFAULT 0,
+                              created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                              updated_at DATETIME
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+
+CREATE TABLE restrictions (
+                              id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+                              restriction_type VARCHAR(20) NOT NULL DEFAULT 'reservation',
+                              start_date DATE NOT NULL,
+                              end_date DATE NOT NULL,
+                              reservation_id INT UNSIGNED,
+                              room_id INT UNSIGNED NOT NULL,
+                              ical_import_id INT UNSIGNED,
+                              external_uid VARCHAR(255),
+                              created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                              updated_at DATETIME
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+
+ALTER TABLE reservations
+    ADD CONSTRAINT fk_reservations_room_id
+        FOREIGN KEY (room_id)
+            REFERENCES rooms (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+ALTER TABLE restrictions
+    ADD CONSTRAINT fk_restrictions_room_id
+        FOREIGN KEY (room_id)
+            REFERENCES rooms (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+ALTER TABLE restrictions
+    ADD CONSTRAINT fk_restrictions_reservation_id
+        FOREIGN KEY (reservation_id)
+            REFERENCES reservations (id)
+            ON UPDATE CASCADE
+            ON DELETE CASCADE;
+
+
+CREATE INDEX idx_users_email ON users (email);
+CREATE UNIQUE INDEX idx_room_ical_token ON rooms (ical_token);
+CREATE UNIQUE INDEX idx_reservation_code ON reservations (code);
+CREATE INDEX idx_reservation_last_name ON reservations (last_name);
+CREATE INDEX idx_sd_ed ON restrictions (start_date, end_date);
+CREATE UNIQUE INDEX idx_restriction_external_uid ON restrictions (ical_import_id, external_uid);
+
+-- the schema the postgres migrations build up to, for the models MySQL and MariaDB support.
+-- Foreign key names are unique per database in MySQL, so they carry the table name.
+-- Calendar imports need postgres: ical_import_id has no foreign key here
@@ -0,0 +1,9 @@
+CREATE TABLE sessions (
+                          token CHAR(43) PRIMARY KEY,
+                          data BLOB NOT NULL,
+                          expiry TIMESTAMP(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+
+--the table of the scs mysql store, used when SESSION_TYPE is mysql or mariadb
@@ -0,0 +1,24 @@
+CREATE TABLE mail_outbox (
+                             id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+                             to_address VARCHAR(255) NOT NULL,
+                             from_address VARCHAR(255) NOT NULL DEFAULT '',
+                             from_name VARCHAR(255) NOT NULL DEFAULT '',
+                             subject VARCHAR(255) NOT NULL,
+                             template VARCHAR(100) NOT NULL,
+                             data MEDIUMTEXT NOT NULL DEFAULT ('{}'),
+                             attachments LONGTEXT NOT NULL DEFAULT ('[]'),
+                             status VARCHAR(20) NOT NULL DEFAULT 'pending',
+                             attempts INTEGER NOT NULL DEFAULT 0,
+                             next_attempt_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             last_error TEXT NOT NULL DEFAULT (''),
+                             sent_at DATETIME,
+                             created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             updated_at DATETIME
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_mail_outbox_due ON mail_outbox (status, next_attempt_at);
+
+--data: json given to the mail template
+--attachments: json list of the files sent with the message, with their content
+--status: pending (waiting to be sent or retried), sent, or dead (gave up after the last retry)
+--text columns take their default as an expression, which needs MySQL 8.0.13 or MariaDB 10.2
@@ -0,0 +1,13 @@
+ALTER TABLE reservations
+    DROP FOREIGN KEY fk_reservations_guest_id;
+
+ALTER TABLE reservations
+    DROP INDEX idx_reservation_guest_id,
+    DROP COLUMN guest_id;
+
+DROP TABLE IF EXISTS guests;
+
+-- fails while a guest has booked twice with the same email or phone
+ALTER TABLE reservations
+    ADD UNIQUE INDEX email (email),
+    ADD UNIQUE INDEX phone (phone);
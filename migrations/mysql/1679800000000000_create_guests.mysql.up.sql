@@ -0,0 +1,38 @@
+CREATE TABLE guests (
+                        id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+                        first_name VARCHAR(50) NOT NULL,
+                        last_name VARCHAR(50) NOT NULL,
+                        email VARCHAR(100) NOT NULL,
+                        phone VARCHAR(60) NOT NULL DEFAULT '',
+                        created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                        updated_at DATETIME
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE UNIQUE INDEX idx_guest_email ON guests (email);
+
+-- a guest for every email booked so far, with the details of the latest booking
+INSERT INTO guests (first_name, last_name, email, phone, created_at, updated_at)
+SELECT r.first_name, r.last_name, LOWER(r.email), r.phone, r.created_at, NOW()
+FROM reservations r
+WHERE r.id IN (SELECT MAX(id) FROM reservations GROUP BY LOWER(email));
+
+ALTER TABLE reservations
+    ADD COLUMN guest_id INT UNSIGNED;
+
+UPDATE reservations r JOIN guests g ON g.email = LOWER(r.email) SET r.guest_id = g.id;
+
+ALTER TABLE reservations
+    MODIFY guest_id INT UNSIGNED NOT NULL,
+    DROP INDEX email,
+    DROP INDEX phone;
+
+ALTER TABLE reservations
+    ADD CONSTRAINT fk_reservations_guest_id
+        FOREIGN KEY (guest_id)
+            REFERENCES guests (id)
+            ON UPDATE CASCADE;
+
+CREATE INDEX idx_reservation_guest_id ON reservations (guest_id);
+
+--email: lower case, returning guests are matched by it
+--reservations keep the guest details they were booked with, the guest has the latest ones
@@ -0,0 +1,13 @@
+CREATE TABLE guest_emails (
+                              email VARCHAR(100) PRIMARY KEY,
+                              guest_id INT UNSIGNED NOT NULL,
+                              created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                              CONSTRAINT fk_guest_emails_guest_id
+                                  FOREIGN KEY (guest_id)
+                                      REFERENCES guests (id)
+                                      ON UPDATE CASCADE ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX idx_guest_emails_guest_id ON guest_emails (guest_id);
+
+-- email: lower case, the email of a guest merged into guest_id; new bookings with it go to guest_id
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS restrictions;
+DROP TABLE IF EXISTS reservations;
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS users;
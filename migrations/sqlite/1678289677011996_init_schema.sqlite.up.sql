@@ -0,0 +1,66 @@
+CREATE TABLE users (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       first_name VARCHAR(50) NOT NULL,
+                       last_name VARCHAR(50) NOT NULL,
+                       email VARCHAR(100) NOT NULL,
+                       password VARCHAR(100) NOT NULL,
+                       access_level INTEGER NOT NULL DEFAULT 1,
+                       created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                       updated_at DATETIME
+);
+
+
+CREATE TABLE rooms (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       name VARCHAR(255) NOT NULL,
+                       nightly_rate INTEGER NOT NULL DEFAULT 0,
+                       ical_token VARCHAR(64) NOT NULL,
+                       created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at DATETIME
+);
+
+
+CREATE TABLE reservations (
+                              id INTEGER PRIMARY KEY AUTOINCREMENT,
+                              code VARCHAR(20) NOT NULL,
+                              first_name VARCHAR(50) NOT NULL,
+                              last_name VARCHAR(50) NOT NULL,
+                              email VARCHAR(50) UNIQUE NOT NULL,
+                              phone VARCHAR(60) UNIQUE NOT NULL,
+                              start_date DATE NOT NULL,
+                              end_date DATE NOT NULL,
+                              processed INTEGER DEFAULT 0,
+                              room_id INTEGER NOT NULL REFERENCES rooms (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                              nightly_rate INTEGER NOT NULL DEFAULT 0,
+                              created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                              updated_at DATETIME
+);
+
+
+CREATE TABLE restrictions (
+                              id INTEGER PRIMARY KEY AUTOINCREMENT,
+                              restriction_type VARCHAR(20) NOT NULL DEFAULT 'reservation',
+                              start_date DATE NOT NULL,
+                              end_date DATE NOT NULL,
+                              reservation_id INTEGER REFERENCES reservations (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                              room_id INTEGER NOT NULL REFERENCES rooms (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                              ical_import_id INTEGER,
+                              external_uid VARCHAR(255),
+                              created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                              updated_at DATETIME
+);
+
+
+CREATE INDEX idx_users_email ON users (email);
+CREATE UNIQUE INDEX idx_room_ical_token ON rooms (ical_token);
+CREATE UNIQUE INDEX idx_reservation_code ON reservations (code);
+CREATE INDEX idx_reservation_last_name ON reservations (last_name);
+CREATE INDEX idx_sd_ed ON restrictions (start_date, end_date);
+CREATE UNIQUE INDEX idx_restriction_external_uid ON restrictions (ical_import_id, external_uid);
+
+-- the schema the postgres migrations build up to, for the models SQLite supports.
+-- SQLite cannot add a foreign key to a table, so they are declared with the columns; they are only checked
+-- on connections with PRAGMA foreign_keys = ON, which the app turns on.
+-- Dates and times are kept as text in UTC. The DATE and DATETIME types tell the driver to read them back
+-- as times, and the text sorts like the dates, so the overlap checks compare them as they are.
+-- Calendar imports need postgres: ical_import_id has no foreign key here
@@ -0,0 +1,54 @@
+-- built again the way the up migration does it, with the unique constraints and without guest_id.
+-- Fails while a guest has booked twice with the same email or phone
+CREATE TABLE reservations_old (
+                                  id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                  code VARCHAR(20) NOT NULL,
+                                  first_name VARCHAR(50) NOT NULL,
+                                  last_name VARCHAR(50) NOT NULL,
+                                  email VARCHAR(50) UNIQUE NOT NULL,
+                                  phone VARCHAR(60) UNIQUE NOT NULL,
+                                  start_date DATE NOT NULL,
+                                  end_date DATE NOT NULL,
+                                  processed INTEGER DEFAULT 0,
+                                  room_id INTEGER NOT NULL REFERENCES rooms (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  nightly_rate INTEGER NOT NULL DEFAULT 0,
+                                  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  updated_at DATETIME
+);
+
+INSERT INTO reservations_old (id, code, first_name, last_name, email, phone, start_date, end_date,
+                              processed, room_id, nightly_rate, created_at, updated_at)
+SELECT id, code, first_name, last_name, email, phone, start_date, end_date,
+       processed, room_id, nightly_rate, created_at, updated_at
+FROM reservations;
+
+CREATE TABLE restrictions_old (
+                                  id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                  restriction_type VARCHAR(20) NOT NULL DEFAULT 'reservation',
+                                  start_date DATE NOT NULL,
+                                  end_date DATE NOT NULL,
+                                  reservation_id INTEGER REFERENCES reservations_old (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  room_id INTEGER NOT NULL REFERENCES rooms (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  ical_import_id INTEGER,
+                                  external_uid VARCHAR(255),
+                                  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  updated_at DATETIME
+);
+
+INSERT INTO restrictions_old (id, restriction_type, start_date, end_date, reservation_id, room_id, ical_import_id,
+                              external_uid, created_at, updated_at)
+SELECT id, restriction_type, start_date, end_date, reservation_id, room_id, ical_import_id,
+       external_uid, created_at, updated_at
+FROM restrictions;
+
+DROP TABLE restrictions;
+DROP TABLE reservations;
+ALTER TABLE reservations_old RENAME TO reservations;
+ALTER TABLE restrictions_old RENAME TO restrictions;
+
+CREATE UNIQUE INDEX idx_reservation_code ON reservations (code);
+CREATE INDEX idx_reservation_last_name ON reservations (last_name);
+CREATE INDEX idx_sd_ed ON restrictions (start_date, end_date);
+CREATE UNIQUE INDEX idx_restriction_external_uid ON restrictions (ical_import_id, external_uid);
+
+DROP TABLE IF EXISTS guests;
@@ -0,0 +1,77 @@
+CREATE TABLE guests (
+                        id INTEGER PRIMARY KEY AUTOINCREMENT,
+                        first_name VARCHAR(50) NOT NULL,
+                        last_name VARCHAR(50) NOT NULL,
+                        email VARCHAR(100) NOT NULL,
+                        phone VARCHAR(60) NOT NULL DEFAULT '',
+                        created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                        updated_at DATETIME
+);
+
+CREATE UNIQUE INDEX idx_guest_email ON guests (email);
+
+-- a guest for every email booked so far, with the details of the latest booking
+INSERT INTO guests (first_name, last_name, email, phone, created_at, updated_at)
+SELECT r.first_name, r.last_name, LOWER(r.email), r.phone, r.created_at, r.updated_at
+FROM reservations r
+WHERE r.id IN (SELECT MAX(id) FROM reservations GROUP BY LOWER(email));
+
+-- SQLite cannot drop the unique constraints of a column, so reservations is built again without them. Dropping
+-- it would delete the restrictions of its reservations through their foreign key, so they are built again too,
+-- pointing at the new table; renaming it moves their foreign key along
+CREATE TABLE reservations_new (
+                                  id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                  code VARCHAR(20) NOT NULL,
+                                  guest_id INTEGER NOT NULL REFERENCES guests (id) ON UPDATE CASCADE,
+                                  first_name VARCHAR(50) NOT NULL,
+                                  last_name VARCHAR(50) NOT NULL,
+                                  email VARCHAR(50) NOT NULL,
+                                  phone VARCHAR(60) NOT NULL,
+                                  start_date DATE NOT NULL,
+                                  end_date DATE NOT NULL,
+                                  processed INTEGER DEFAULT 0,
+                                  room_id INTEGER NOT NULL REFERENCES rooms (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  nightly_rate INTEGER NOT NULL DEFAULT 0,
+                                  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  updated_at DATETIME
+);
+
+INSERT INTO reservations_new (id, code, guest_id, first_name, last_name, email, phone, start_date, end_date,
+                              processed, room_id, nightly_rate, created_at, updated_at)
+SELECT r.id, r.code, g.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+       r.processed, r.room_id, r.nightly_rate, r.created_at, r.updated_at
+FROM reservations r
+JOIN guests g ON g.email = LOWER(r.email);
+
+CREATE TABLE restrictions_new (
+                                  id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                  restriction_type VARCHAR(20) NOT NULL DEFAULT 'reservation',
+                                  start_date DATE NOT NULL,
+                                  end_date DATE NOT NULL,
+                                  reservation_id INTEGER REFERENCES reservations_new (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  room_id INTEGER NOT NULL REFERENCES rooms (id) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  ical_import_id INTEGER,
+                                  external_uid VARCHAR(255),
+                                  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  updated_at DATETIME
+);
+
+INSERT INTO restrictions_new (id, restriction_type, start_date, end_date, reservation_id, room_id, ical_import_id,
+                              external_uid, created_at, updated_at)
+SELECT id, restriction_type, start_date, end_date, reservation_id, room_id, ical_import_id,
+       external_uid, created_at, updated_at
+FROM restrictions;
+
+DROP TABLE restrictions;
+DROP TABLE reservations;
+ALTER TABLE reservations_new RENAME TO reservations;
+ALTER TABLE restrictions_new RENAME TO restrictions;
+
+CREATE UNIQUE INDEX idx_reservation_code ON reservations (code);
+CREATE INDEX idx_reservation_last_name ON reservations (last_name);
+CREATE INDEX idx_reservation_guest_id ON reservations (guest_id);
+CREATE INDEX idx_sd_ed ON restrictions (start_date, end_date);
+CREATE UNIQUE INDEX idx_restriction_external_uid ON restrictions (ical_import_id, external_uid);
+
+--email: lower case, returning guests are matched by it
+--reservations keep the guest details they were booked with, the guest has the latest ones
@@ -0,0 +1,223 @@
+// Package pdf writes simple PDF documents: pages of text in the standard Helvetica fonts, lines and
+// filled rectangles. It is enough for the confirmations and invoices of the booking app and needs no fonts
+// or other files, every PDF reader has the standard fonts built in.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Font is one of the standard fonts
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = map[Font]string{
+	Helvetica:     "Helvetica",
+	HelveticaBold: "Helvetica-Bold",
+}
+
+// Color is an RGB colour with components from 0 to 1
+type Color struct {
+	R, G, B float64
+}
+
+var Black = Color{0, 0, 0}
+
+// Document is a PDF being built. Positions are in points from the top left corner of the page
+type Document struct {
+	Title string
+	pages []*bytes.Buffer
+}
+
+func New(title string) *Document {
+	return &Document{Title: title}
+}
+
+// AddPage starts a new page, everything drawn after goes on it
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Text writes s with its baseline at y, starting at x
+func (d *Document) Text(x, y float64, font Font, size float64, color Color, s string) {
+	fmt.Fprintf(d.page(), "BT %s rg /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		color.String(), font+1, num(size), num(x), num(PageHeight-y), escape(encode(s)))
+}
+
+// TextRight writes s with its baseline at y, ending at x
+func (d *Document) TextRight(x, y float64, font Font, size float64, color Color, s string) {
+	d.Text(x-TextWidth(font, size, s), y, font, size, color, s)
+}
+
+// Line draws a line of the given width from x1,y1 to x2,y2
+func (d *Document) Line(x1, y1, x2, y2, width float64, color Color) {
+	fmt.Fprintf(d.page(), "%s RG %s w %s %s m %s %s l S\n",
+		color.String(), num(width), num(x1), num(PageHeight-y1), num(x2), num(PageHeight-y2))
+}
+
+// Rect fills a rectangle whose top left corner is at x,y
+func (d *Document) Rect(x, y, w, h float64, color Color) {
+	fmt.Fprintf(d.page(), "%s rg %s %s %s %s re f\n",
+		color.String(), num(x), num(PageHeight-y-h), num(w), num(h))
+}
+
+// Bytes returns the finished document
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	err := d.Write(&buf)
+	return buf.Bytes(), err
+}
+
+// Write writes the finished document to w
+func (d *Document) Write(w io.Writer) error {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// objects: 1 catalog, 2 page tree, 3 info, 4 and 5 fonts, then a page and its content for each page
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+2*i))
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	objects = append(objects, fmt.Sprintf("<< /Title (%s) /Producer (booking) >>", escape(encode(d.Title))))
+	for _, f := range []Font{Helvetica, HelveticaBold} {
+		objects = append(objects, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", fontNames[f]))
+	}
+
+	for i, p := range d.pages {
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents %d 0 R >>",
+			num(PageWidth), num(PageHeight), 7+2*i))
+
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		_, err := zw.Write(p.Bytes())
+		if err != nil {
+			return err
+		}
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.String()))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func (c Color) String() string {
+	return fmt.Sprintf("%s %s %s", num(c.R), num(c.G), num(c.B))
+}
+
+// num writes a number the short way, without trailing zeros
+func num(f float64) string {
+	s := strings.TrimRight(fmt.Sprintf("%.3f", f), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// encode turns s into WinAnsi bytes, the encoding of the standard fonts; characters it does not have become ?
+func encode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case winAnsi[r] != 0:
+			b.WriteByte(winAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// winAnsi are the characters of WinAnsiEncoding outside latin-1
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '–': 0x96, '—': 0x97,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '™': 0x99,
+}
+
+// escape escapes the delimiters of a literal string
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+	return r.Replace(s)
+}
+
+// TextWidth is how wide s is in points when written in font at size
+func TextWidth(font Font, size float64, s string) float64 {
+	widths := helveticaWidths
+	if font == HelveticaBold {
+		widths = helveticaBoldWidths
+	}
+	total := 0
+	for _, c := range []byte(encode(s)) {
+		if c >= 0x20 && c < 0x7f {
+			total += widths[c-0x20]
+		} else {
+			// accented letters and symbols are about as wide as a digit
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// helveticaWidths and helveticaBoldWidths are the widths of the printable ascii characters,
+// from space to tilde, in thousandths of the font size (Adobe font metrics)
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,81 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestDocument_Write(t *testing.T) {
+	d := New("Invoice (INV-000001)")
+	d.Text(40, 60, HelveticaBold, 18, Black, "Invoice")
+	d.TextRight(555, 60, Helvetica, 10, Black, "Total: €1,250.00 (paid)")
+	d.Line(40, 70, 555, 70, 0.5, Color{0.8, 0.8, 0.8})
+	d.AddPage()
+	d.Rect(40, 40, 100, 20, Color{0.4, 0.2, 0.6})
+
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatalf("not a pdf:\n%s", b)
+	}
+
+	// every xref entry points at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(b)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(b[xref:], []byte("xref\n0 10\n")) {
+		t.Fatalf("startxref does not point at an xref table of 10 entries: %q", b[xref:xref+20])
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(b[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("expected 9 objects, got %d", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		want := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !bytes.HasPrefix(b[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, b[off:off+10])
+		}
+	}
+
+	// the first page has the text, encoded and escaped
+	streams := regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(b, -1)
+	if len(streams) != 2 {
+		t.Fatalf("expected a content stream per page, got %d", len(streams))
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(streams[0][1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte("/F2 18 Tf 40 781.89 Td (Invoice) Tj")) {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+	if !bytes.Contains(content, []byte("(Total: \x801,250.00 \\(paid\\)) Tj")) {
+		t.Errorf("text is not encoded and escaped:\n%q", content)
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if helveticaWidths[94] != 584 || helveticaBoldWidths[94] != 584 {
+		t.Fatal("the width tables do not reach the tilde")
+	}
+	if got := TextWidth(Helvetica, 10, "100"); got != 16.68 {
+		t.Errorf("expected 16.68, got %v", got)
+	}
+	if TextWidth(HelveticaBold, 10, "Invoice") <= TextWidth(Helvetica, 10, "Invoice") {
+		t.Error("bold text should be wider")
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/middleware"
 	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
 	"net/http"
 )
 
 func (a *application) routes() *chi.Mux {
 	// middleware must come before any routes
+	a.Routes.Use(a.Middleware.Actor)
 
 	// add routes here
 	a.Get("/", a.Handlers.Home)
@@ -16,21 +20,154 @@ func (a *application) routes() *chi.Mux {
 	a.Get("/rooms", a.Handlers.Rooms)
 	a.Get("/rooms/generals-quarters", a.Handlers.Generals)
 	a.Get("/rooms/majors-suite", a.Handlers.Majors)
-	a.Post("/room/check-json", a.Handlers.AvailabilityJSON)
+	a.Routes.With(a.Middleware.RateLimit(middleware.RateLimitSearch)).Post("/room/check-json", a.Handlers.AvailabilityJSON)
 	a.Get("/bookings/room", a.Handlers.BookRoom)
 
 	a.Get("/check/rooms", a.Handlers.Availability)
-	a.Post("/check/rooms", a.Handlers.PostAvailability)
+	a.Routes.With(a.Middleware.RateLimit(middleware.RateLimitSearch)).Post("/check/rooms", a.Handlers.PostAvailability)
 	a.Get("/check/rooms/{id}", a.Handlers.ChooseRoom)
 
 	a.Get("/bookings/reservation", a.Handlers.Reservation)
-	a.Post("/bookings/reservation", a.Handlers.PostReservation)
+	a.Routes.With(a.Middleware.RateLimit(middleware.RateLimitBooking)).Post("/bookings/reservation", a.Handlers.PostReservation)
 
 	a.Get("/booking/reservation-summary", a.Handlers.ReservationSummary)
 
+	// guests find their reservation by confirmation code and email
+	a.Get("/reservations/lookup", a.Handlers.ReservationLookup)
+	a.Routes.With(a.Middleware.RateLimit(middleware.RateLimitSearch)).Post("/reservations/lookup", a.Handlers.PostReservationLookup)
+	a.Post("/reservations/lookup/forget", a.Handlers.ForgetReservationLookup)
+	a.Get("/reservations/lookup/confirmation.pdf", a.Handlers.LookupConfirmation)
+	a.Routes.With(a.requiresFullSchema("Invoices")).Get("/reservations/lookup/invoice.pdf", a.Handlers.LookupInvoice)
+
+	// subscribable calendar feed of a room, the token is the secret
+	a.Get("/calendars/rooms/{token}.ics", a.Handlers.RoomCalendar)
+
+	a.Get("/user/login", a.Handlers.UserLogin)
+	a.Post("/user/login", a.Handlers.PostUserLogin)
+	a.Get("/user/logout", a.Handlers.Logout)
+
+	// staff only pages
+	a.Routes.Route("/admin", func(r chi.Router) {
+		r.Use(a.Middleware.Auth)
+
+		r.Get("/dashboard", a.Handlers.AdminDashboard)
+
+		r.Get("/search", a.Handlers.AdminSearch)
+		r.Get("/reservations", a.Handlers.AdminReservations)
+		r.Get("/reservations/{id}", a.Handlers.AdminShowReservation)
+		r.Get("/reservations/{id}/history", a.Handlers.AdminReservationHistory)
+		r.Post("/reservations/{id}", a.Handlers.AdminPostReservation)
+		r.Post("/reservations/{id}/processed", a.Handlers.AdminProcessReservation)
+		r.Post("/reservations/{id}/cancel", a.Handlers.AdminCancelReservation)
+		r.Get("/reservations/{id}/confirmation.pdf", a.Handlers.AdminReservationConfirmation)
+		r.With(a.requiresFullSchema("Invoices")).Get("/reservations/{id}/invoice.pdf", a.Handlers.AdminReservationInvoice)
+		r.With(a.requiresFullSchema("Invoices")).Post("/reservations/{id}/invoice/send", a.Handlers.AdminSendInvoice)
+
+		r.Get("/guests/{id}", a.Handlers.AdminShowGuest)
+		r.Post("/guests/{id}/merge", a.Handlers.AdminMergeGuest)
+
+		r.Get("/rooms", a.Handlers.AdminRooms)
+		r.Post("/rooms/{id}/rate", a.Handlers.AdminPostRoomRate)
+		r.Post("/rooms/{id}/calendar/regenerate", a.Handlers.AdminRegenerateRoomCalendar)
+
+		r.Route("/calendar-imports", func(r chi.Router) {
+			r.Use(a.requiresFullSchema("Calendar imports"))
+			r.Get("/", a.Handlers.AdminCalendarImports)
+			r.Post("/", a.Handlers.AdminPostCalendarImport)
+			r.Post("/{id}/sync", a.Handlers.AdminSyncCalendarImport)
+			r.Post("/{id}/delete", a.Handlers.AdminDeleteCalendarImport)
+			r.Get("/log", a.Handlers.AdminCalendarSyncLog)
+		})
+
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(a.requiresFullSchema("API keys"))
+			r.Get("/", a.Handlers.AdminAPIKeys)
+			r.Post("/", a.Handlers.AdminPostAPIKey)
+			r.Post("/{id}/revoke", a.Handlers.AdminRevokeAPIKey)
+		})
+
+		r.Get("/mail", a.Handlers.AdminMailQueue)
+		r.Post("/mail/{id}/requeue", a.Handlers.AdminRequeueMail)
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(a.requiresFullSchema("Webhooks"))
+			r.Get("/", a.Handlers.AdminWebhooks)
+			r.Post("/", a.Handlers.AdminPostWebhook)
+			r.Post("/{id}/delete", a.Handlers.AdminDeleteWebhook)
+			r.Get("/deliveries", a.Handlers.AdminWebhookDeliveries)
+			r.Post("/deliveries/{id}/replay", a.Handlers.AdminReplayWebhookDelivery)
+		})
+	})
+
+	// caught mail and template previews, only in development
+	if a.Handlers.MailCatcher != nil && a.Debug {
+		a.Routes.Route("/dev/mail", func(r chi.Router) {
+			r.Get("/", a.Handlers.DevMail)
+			r.Post("/clear", a.Handlers.DevClearMail)
+			r.Get("/{id}", a.Handlers.DevMailMessage)
+			r.Get("/{id}/html", a.Handlers.DevMailHTML)
+			r.Get("/{id}/attachments/{n}", a.Handlers.DevMailAttachment)
+			r.Get("/templates/{name}", a.Handlers.DevMailTemplate)
+			r.Get("/templates/{name}/html", a.Handlers.DevMailTemplateHTML)
+		})
+	}
+
 	// static routes
 	fileServer := http.FileServer(http.Dir("./public"))
 	a.Routes.Handle("/public/*", http.StripPrefix("/public", fileServer))
 
-	return a.Routes
+	// json api for the mobile app and partner sites. It is served beside the routes of jazz, not on them:
+	// partners send an api key instead of a session and a csrf token, and the csrf check of jazz only
+	// exempts the paths one level below /api
+	api := chi.NewRouter()
+	api.Use(chimw.RequestID)
+	api.Use(chimw.RealIP)
+	if a.Debug {
+		api.Use(chimw.Logger)
+	}
+	api.Use(chimw.Recoverer)
+	api.Use(a.Trace)
+	api.Get("/openapi.json", a.Handlers.OpenAPI)
+	api.Route("/v1", func(r chi.Router) {
+		r.NotFound(a.Handlers.APINotFound)
+		r.MethodNotAllowed(a.Handlers.APIMethodNotAllowed)
+		r.Use(a.requiresFullSchema("The api and its keys"))
+
+		// every endpoint needs a partner api key with the matching scope,
+		// and is rate limited per key
+		r.Group(func(r chi.Router) {
+			r.Use(a.Middleware.APIKey(data.ScopeReadAvailability))
+			r.Use(a.Middleware.RateLimit(middleware.RateLimitSearch))
+			r.Get("/rooms", a.Handlers.APIRooms)
+			r.Get("/availability", a.Handlers.APIAvailability)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(a.Middleware.APIKey(data.ScopeCreateReservations))
+			r.Use(a.Middleware.RateLimit(middleware.RateLimitBooking))
+			r.Post("/reservations", a.Handlers.APICreateReservation)
+		})
+		// the reservations hold the contact details of the guests, reading them is a scope of its own
+		r.Group(func(r chi.Router) {
+			r.Use(a.Middleware.APIKey(data.ScopeReadReservations))
+			r.Use(a.Middleware.RateLimit(middleware.RateLimitSearch))
+			r.Get("/reservations", a.Handlers.APIReservations)
+			r.Get("/reservations/{code}", a.Handlers.APIReservation)
+		})
+	})
+
+	// the rate limits need the address the connection came from, before the RealIP middleware of the router
+	// replaces it with the one in the request headers
+	root := chi.NewRouter()
+	root.Use(middleware.PeerAddr)
+	root.Mount("/api", api)
+	root.Mount("/", a.Routes)
+	return root
+}
+
+// requiresFullSchema answers the routes of feature with 501 when the database has no tables for it, see fullSchema
+func (a *application) requiresFullSchema(feature string) func(http.Handler) http.Handler {
+	if a.fullSchema() {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return a.Middleware.Unsupported(feature)
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"github.com/ahmedkhaeld/booking/data"
+	"github.com/ahmedkhaeld/booking/emails"
+	"github.com/ahmedkhaeld/booking/handlers"
+	"github.com/ahmedkhaeld/booking/jobs"
+	"github.com/ahmedkhaeld/booking/middleware"
+	"github.com/ahmedkhaeld/jazz"
+	"github.com/ahmedkhaeld/jazz/mailer"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// discardSender drops the mail the queue sends
+type discardSender struct{}
+
+func (discardSender) Send(mailer.Message) error { return nil }
+
+// newTestApplication returns the app on in-memory models with one room, behind the same session and csrf
+// middleware jazz puts in front of its routes
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	j := &jazz.Jazz{ErrorLog: logger, InfoLog: logger, Session: scs.New()}
+	mux := chi.NewRouter()
+	mux.Use(j.SessionLoad)
+	mux.Use(j.NoSurf)
+	j.Routes = mux
+
+	models := data.NewMemory()
+	if _, err := models.Rooms.Create(context.Background(), data.Room{Name: "Generals Quarters", NightlyRate: 8900}); err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		Jazz:   j,
+		Models: models,
+		Handlers: &handlers.Handlers{
+			Jazz:      j,
+			Models:    models,
+			MailQueue: jobs.NewMailQueue(models, discardSender{}, logger, logger),
+			Emails: emails.Config{PropertyName: "Fort Smythe Bed and Breakfast", Currency: "USD", CheckIn: "15:00",
+				CheckOut: "11:00", Location: time.UTC},
+		},
+		Middleware: &middleware.Middleware{Jazz: j, Models: models},
+	}
+	app.Jazz.Routes = app.routes()
+	return app
+}
+
+func TestRoutes_APIPostWithoutCSRFToken(t *testing.T) {
+	a := newTestApplication(t)
+	ctx := context.Background()
+	user, _ := a.Models.Users.Insert(ctx, data.User{Email: "partner@example.com", Password: "secret"})
+	_, token, err := a.Models.APIKeys.Issue(ctx, data.APIKey{UserID: user, Name: "partner",
+		Scopes: []string{data.ScopeCreateReservations}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().AddDate(0, 0, 10).Format("2006-01-02")
+	end := time.Now().AddDate(0, 0, 12).Format("2006-01-02")
+	body := `{"room_id": 1, "start_date": "` + start + `", "end_date": "` + end + `",
+		"first_name": "John", "last_name": "Smith", "email": "john@example.com", "phone": "555-0100"}`
+	req := httptest.NewRequest("POST", "/api/v1/reservations", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	a.Routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if reservations, _ := a.Models.Reservations.GetAll(ctx); len(reservations) != 1 {
+		t.Errorf("expected the reservation to be booked, got %+v", reservations)
+	}
+
+	// the pages still need the token
+	rr = httptest.NewRecorder()
+	a.Routes.ServeHTTP(rr, httptest.NewRequest("POST", "/user/login", strings.NewReader("")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected the csrf check to reject the form, got %d", rr.Code)
+	}
+}
+
+func TestRoutes_ReservationNeedsReadScope(t *testing.T) {
+	a := newTestApplication(t)
+	ctx := context.Background()
+	user, _ := a.Models.Users.Insert(ctx, data.User{Email: "partner@example.com", Password: "secret"})
+	id, _ := a.Models.Reservations.Create(ctx, data.Reservation{FirstName: "John", LastName: "Smith",
+		Email: "john@example.com", RoomID: 1})
+	res, _ := a.Models.Reservations.GetByID(ctx, id)
+
+	tests := []struct {
+		scope  string
+		status int
+	}{
+		{data.ScopeCreateReservations, http.StatusForbidden},
+		{data.ScopeReadReservations, http.StatusOK},
+	}
+	for _, tt := range tests {
+		_, token, _ := a.Models.APIKeys.Issue(ctx, data.APIKey{UserID: user, Name: tt.scope, Scopes: []string{tt.scope}})
+		req := httptest.NewRequest("GET", "/api/v1/reservations/"+res.Code, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		a.Routes.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.scope, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+}